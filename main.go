@@ -5,8 +5,6 @@ import (
 	"embed"
 	"log"
 	"math/rand"
-	"os"
-	"os/signal"
 	"time"
 
 	"github.com/ostcar/bieterrunde/server"
@@ -30,7 +28,7 @@ var defaultStatic embed.FS
 
 func main() {
 	rand.Seed(time.Now().Unix())
-	ctx, cancel := withShutdown(context.Background())
+	ctx, cancel := server.WithShutdown(context.Background())
 	defer cancel()
 
 	defaultFiles := server.DefaultFiles{
@@ -43,18 +41,3 @@ func main() {
 		log.Fatalf("Error: %v", err)
 	}
 }
-
-func withShutdown(ctx context.Context) (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
-		cancel()
-
-		// If the signal was send for the second time, make a hard cut.
-		<-sigint
-		os.Exit(1)
-	}()
-	return ctx, cancel
-}
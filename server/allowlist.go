@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// errAdminNotAllowed is returned, when an admin request comes from an ip
+// address outside of Config.AdminAllowlist.
+var errAdminNotAllowed = clientError{msg: "Admin-Zugang ist von dieser Adresse nicht erlaubt", status: 403, code: "ADMIN_IP_NOT_ALLOWED"}
+
+// parseNetworks parses a list of CIDRs like 192.0.2.0/24. A single ip address
+// is a network with only this address.
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address %q", cidr)
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// parseAllowlist parses AdminAllowlist and TrustedProxies, so the networks
+// are not parsed on each request.
+func (c *Config) parseAllowlist() error {
+	adminNetworks, err := parseNetworks(c.AdminAllowlist)
+	if err != nil {
+		return fmt.Errorf("admin_allowlist: %w", err)
+	}
+
+	proxyNetworks, err := parseNetworks(c.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("trusted_proxies: %w", err)
+	}
+
+	c.adminNetworks = adminNetworks
+	c.proxyNetworks = proxyNetworks
+	return nil
+}
+
+func networksContain(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIP returns the ip address of the client.
+//
+// If the request comes from a trusted proxy, the address is taken from the
+// X-Forwarded-For header. The header is read from the right, so a client can
+// not fake its address by sending the header itself.
+func requestIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil || !networksContain(trustedProxies, ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+		if !networksContain(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// adminIPAllowed returns true, if the request comes from an ip address in
+// the AdminAllowlist. Without an allowlist, all addresses are allowed.
+//
+// If the allowlist was not parsed with parseAllowlist, no address is allowed.
+func (c Config) adminIPAllowed(r *http.Request) bool {
+	if len(c.AdminAllowlist) == 0 {
+		return true
+	}
+	return ipAllowed(r, c.adminNetworks, c.proxyNetworks)
+}
+
+// ipAllowed returns true, if the client address of the request is in one of
+// the allowed networks.
+func ipAllowed(r *http.Request, allowed, trustedProxies []*net.IPNet) bool {
+	ip := requestIP(r, trustedProxies)
+	return ip != nil && networksContain(allowed, ip)
+}
+
+// adminAllowlistMiddleware rejects requests with an admin password from ip
+// addresses outside of the allowed networks. Without networks, all addresses
+// are allowed.
+func adminAllowlistMiddleware(allowed, trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Auth") != "" && !ipAllowed(r, allowed, trustedProxies) {
+				handleError(w, errAdminNotAllowed)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
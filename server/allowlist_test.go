@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newAllowlistTestRouter(t *testing.T, allowlist, proxies []string) *mux.Router {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.AdminPW = testAdminPW
+	config.AdminAllowlist = allowlist
+	config.TrustedProxies = proxies
+	if err := config.parseAllowlist(); err != nil {
+		t.Fatalf("parseAllowlist: %v", err)
+	}
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, newTestDB(t), DefaultFiles{Static: os.DirFS("..")})
+	return router
+}
+
+func doAdminRequestFrom(router *mux.Router, remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/bieter", nil)
+	req.Header.Set("Auth", testAdminPW)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAllowlist(t *testing.T) {
+	router := newAllowlistTestRouter(t, []string{"192.0.2.0/24", "2001:db8::1"}, nil)
+
+	for _, tt := range []struct {
+		remoteAddr string
+		expect     int
+	}{
+		{"192.0.2.1:1234", 200},
+		{"192.0.2.254:1234", 200},
+		{"[2001:db8::1]:1234", 200},
+		{"198.51.100.7:1234", 403},
+		{"[2001:db8::2]:1234", 403},
+	} {
+		if rec := doAdminRequestFrom(router, tt.remoteAddr, ""); rec.Code != tt.expect {
+			t.Errorf("%s: got status %d, expected %d", tt.remoteAddr, rec.Code, tt.expect)
+		}
+	}
+
+	// Public requests are not affected.
+	req := httptest.NewRequest("GET", "/api/state", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Errorf("got status %d for public request outside the allowlist, expected 200", rec.Code)
+	}
+}
+
+func TestAdminAllowlistEmpty(t *testing.T) {
+	router := newAllowlistTestRouter(t, nil, nil)
+
+	if rec := doAdminRequestFrom(router, "198.51.100.7:1234", ""); rec.Code != 200 {
+		t.Errorf("got status %d without allowlist, expected 200", rec.Code)
+	}
+}
+
+func TestAdminAllowlistForwardedFor(t *testing.T) {
+	router := newAllowlistTestRouter(t, []string{"192.0.2.0/24"}, []string{"10.0.0.0/8"})
+
+	for _, tt := range []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expect       int
+	}{
+		{"client in allowlist", "10.0.0.1:1234", "192.0.2.5", 200},
+		{"client outside allowlist", "10.0.0.1:1234", "198.51.100.7", 403},
+		{"two proxies", "10.0.0.1:1234", "192.0.2.5, 10.0.0.2", 200},
+		{"faked header", "10.0.0.1:1234", "192.0.2.5, 198.51.100.7", 403},
+		{"untrusted proxy", "198.51.100.7:1234", "192.0.2.5", 403},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doAdminRequestFrom(router, tt.remoteAddr, tt.forwardedFor); rec.Code != tt.expect {
+				t.Errorf("got status %d, expected %d", rec.Code, tt.expect)
+			}
+		})
+	}
+}
+
+func TestAdminAllowlistInvalidConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(file, []byte(`admin_allowlist = ["192.0.2.0/33"]`), 0600); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if _, err := LoadConfig(file); err == nil {
+		t.Errorf("LoadConfig with invalid network did not return an error")
+	}
+}
+
+func TestAdminAllowlistLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	content := "admin_allowlist = [\"192.0.2.0/24\", \"2001:db8::1\"]\ntrusted_proxies = [\"10.0.0.0/8\"]\n"
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	config, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if len(config.adminNetworks) != 2 || len(config.proxyNetworks) != 1 {
+		t.Errorf("got %d admin networks and %d proxy networks, expected 2 and 1", len(config.adminNetworks), len(config.proxyNetworks))
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupFilePrefix is the start of the name of all backup files.
+const backupFilePrefix = "bieterrunde-backup-"
+
+// backupFileName returns the name of a backup, that is written to disk at t.
+// The names sort by time.
+func backupFileName(t time.Time) string {
+	return backupFilePrefix + t.Format("20060102-150405.000") + ".json"
+}
+
+// backupRegularly writes a backup to dir after each interval and removes all
+// but the newest keep backups. It returns, when the context is canceled.
+//
+// A backup, that was started, is finished before it returns.
+func (db *Database) backupRegularly(ctx context.Context, dir string, interval time.Duration, keep int) {
+	if dir == "" || interval <= 0 {
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Error: creating backup dir: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := db.writeBackup(filepath.Join(dir, backupFileName(now))); err != nil {
+				log.Printf("Error: %v", err)
+				continue
+			}
+
+			if err := pruneBackups(dir, keep); err != nil {
+				log.Printf("Error: pruning backups: %v", err)
+			}
+		}
+	}
+}
+
+// writeBackup writes the same backup as the backup handler to the file.
+func (db *Database) writeBackup(file string) error {
+	bs, err := db.Backup()
+	if err != nil {
+		return fmt.Errorf("creating backup: %w", err)
+	}
+
+	if err := writeFileAtomic(file, bs); err != nil {
+		return fmt.Errorf("writing backup %s: %w", file, err)
+	}
+	return nil
+}
+
+// pruneBackups removes the oldest backups in dir, so only keep backups are
+// left. Other files in the directory are not touched.
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading backup dir: %w", err)
+	}
+
+	// ReadDir returns the entries sorted by name, so the oldest are first.
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, ".json") {
+			backups = append(backups, name)
+		}
+	}
+
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return fmt.Errorf("removing backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
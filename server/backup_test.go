@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRegularly(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true); err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		db.backupRegularly(ctx, dir, 10*time.Millisecond, 2)
+	}()
+
+	// Wait for more backups than are kept.
+	time.Sleep(150 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("backup job did not stop after the context was canceled")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading backup dir: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d files in the backup dir, expected 2", len(entries))
+	}
+
+	bs, err := os.ReadFile(filepath.Join(dir, entries[1].Name()))
+	if err != nil {
+		t.Fatalf("reading backup: %v", err)
+	}
+
+	if err := newTestDB(t).RestoreBackup(bytes.NewReader(bs)); err != nil {
+		t.Errorf("backup can not be restored: %v", err)
+	}
+
+	if !strings.Contains(string(bs), "hugo") {
+		t.Errorf("backup does not contain the bieter: %s", bs)
+	}
+}
+
+func TestBackupRegularlyDisabled(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	// Without an interval, the job returns immediately.
+	newTestDB(t).backupRegularly(context.Background(), dir, 0, 2)
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("backup dir was created without an interval")
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		name := backupFileName(start.Add(time.Duration(i) * time.Hour))
+		names = append(names, name)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644); err != nil {
+			t.Fatalf("writing backup: %v", err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep me"), 0o644); err != nil {
+		t.Fatalf("writing other file: %v", err)
+	}
+
+	if err := pruneBackups(dir, 2); err != nil {
+		t.Fatalf("pruneBackups: %v", err)
+	}
+
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != (i >= 2) {
+			t.Errorf("backup %s exists: %t, expected %t", name, exists, i >= 2)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("other file was removed: %v", err)
+	}
+}
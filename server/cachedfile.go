@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultModTime is the modification time of the default content. It is the
+// time, the executable was built, or the start of the server, if the
+// executable can not be found.
+var defaultModTime = executableModTime()
+
+func executableModTime() time.Time {
+	now := time.Now()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return now
+	}
+
+	info, err := os.Stat(exe)
+	if err != nil {
+		return now
+	}
+	return info.ModTime()
+}
+
+// cachedFile reads a file from disk and keeps its content in memory, until the
+// modification time or the size of the file changes. The ETag of the content
+// is only calculated, when the file is read.
+//
+// If the file does not exist, the default content is returned. If there is
+// no default content, get returns an error that wraps fs.ErrNotExist.
+type cachedFile struct {
+	path           string
+	defaultContent []byte
+	defaultETag    string
+	stat           func(string) (fs.FileInfo, error)
+	readFile       func(string) ([]byte, error)
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	content []byte
+	etag    string
+}
+
+func newCachedFile(path string, defaultContent []byte) *cachedFile {
+	return &cachedFile{
+		path:           path,
+		defaultContent: defaultContent,
+		defaultETag:    contentETag(defaultContent),
+		stat:           os.Stat,
+		readFile:       os.ReadFile,
+	}
+}
+
+// newCachedFSFile is like newCachedFile, but reads the file from fsys and has
+// no default content.
+func newCachedFSFile(fsys fs.FS, path string) *cachedFile {
+	return &cachedFile{
+		path: path,
+		stat: func(name string) (fs.FileInfo, error) {
+			return fs.Stat(fsys, name)
+		},
+		readFile: func(name string) ([]byte, error) {
+			return fs.ReadFile(fsys, name)
+		},
+	}
+}
+
+// get returns the content of the file, its modification time and its ETag.
+//
+// For the default content, defaultModTime is returned.
+func (c *cachedFile) get() ([]byte, time.Time, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := c.stat(c.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && c.defaultContent != nil {
+			c.content = nil
+			return c.defaultContent, defaultModTime, c.defaultETag, nil
+		}
+		return nil, time.Time{}, "", fmt.Errorf("stat %s: %w", c.path, err)
+	}
+
+	if c.content != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return c.content, c.modTime, c.etag, nil
+	}
+
+	content, err := c.readFile(c.path)
+	if err != nil {
+		return nil, time.Time{}, "", fmt.Errorf("reading %s: %w", c.path, err)
+	}
+
+	c.content = content
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	c.etag = contentETag(content)
+	return content, c.modTime, c.etag, nil
+}
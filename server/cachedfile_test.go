@@ -0,0 +1,81 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.html")
+	file := newCachedFile(path, []byte("default"))
+
+	expectContent := func(expect string) {
+		t.Helper()
+		got, _, _, err := file.get()
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if string(got) != expect {
+			t.Errorf("got %q, expected %q", got, expect)
+		}
+	}
+
+	expectContent("default")
+
+	if err := os.WriteFile(path, []byte("first"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	expectContent("first")
+
+	// Same size and same modtime uses the cache.
+	modTime := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(path, []byte("other"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	expectContent("other")
+
+	if err := os.WriteFile(path, []byte("third"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	expectContent("other")
+
+	newModTime := modTime.Add(time.Minute)
+	if err := os.Chtimes(path, newModTime, newModTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	expectContent("third")
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	expectContent("default")
+}
+
+func TestCachedFileModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "elm.js")
+	file := newCachedFile(path, []byte("default"))
+
+	if _, got, _, _ := file.get(); !got.Equal(defaultModTime) {
+		t.Errorf("got modtime %v for default content, expected %v", got, defaultModTime)
+	}
+
+	modTime := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(path, []byte("content"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	if _, got, _, _ := file.get(); !got.Equal(modTime) {
+		t.Errorf("got modtime %v, expected %v", got, modTime)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const pathPrefixCampaign = pathPrefixAPI + "/c"
+
+// CampaignConfig is a further bieterrunde, that is served by the same server.
+type CampaignConfig struct {
+	// Name is used in the url. It can only contain lower case letters,
+	// numbers and hyphens.
+	Name string `toml:"name"`
+
+	DBFile     string `toml:"db_file"`
+	ConfigFile string `toml:"config_file"`
+}
+
+var validCampaignName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// campaign is a loaded campaign.
+type campaign struct {
+	name   string
+	config Config
+	db     *Database
+}
+
+// openCampaigns loads the config and the database of each campaign.
+func openCampaigns(configs []CampaignConfig) ([]campaign, error) {
+	var campaigns []campaign
+	seen := make(map[string]bool)
+	for _, c := range configs {
+		if !validCampaignName.MatchString(c.Name) {
+			closeCampaigns(campaigns)
+			return nil, fmt.Errorf("invalid campaign name %q", c.Name)
+		}
+
+		if seen[c.Name] {
+			closeCampaigns(campaigns)
+			return nil, fmt.Errorf("campaign %q is configured twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		config, err := loadCampaignConfig(c.ConfigFile)
+		if err != nil {
+			closeCampaigns(campaigns)
+			return nil, fmt.Errorf("reading config of campaign %q: %w", c.Name, err)
+		}
+
+		db, err := NewDB(c.DBFile, config)
+		if err != nil {
+			closeCampaigns(campaigns)
+			return nil, fmt.Errorf("open database of campaign %q: %w", c.Name, err)
+		}
+
+		campaigns = append(campaigns, campaign{name: c.Name, config: config, db: db})
+	}
+	return campaigns, nil
+}
+
+// closeCampaigns closes the databases of all campaigns.
+func closeCampaigns(campaigns []campaign) error {
+	var firstErr error
+	for _, c := range campaigns {
+		if err := c.db.Close(); err != nil {
+			log.Printf("Error: closing database of campaign %q: %v", c.name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// handleCampaigns serves the api of each campaign under /api/c/{name}.
+//
+// The requests are passed to a router with the normal api handlers, so
+// /api/c/{name}/bieter is handled like /api/bieter with the database and
+// config of the campaign.
+func handleCampaigns(router *mux.Router, campaigns []campaign, fileSystem fs.FS) {
+	for _, c := range campaigns {
+		campaignRouter := mux.NewRouter()
+		createLimit := newRateLimiter(c.config.CreateRateLimit, time.Minute)
+		registerAPIHandlers(campaignRouter, c.config, c.db, fileSystem, createLimit)
+
+		handleAPIPrefix(router, pathPrefixCampaign+"/"+c.name, campaignRouter)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCampaignsAreIsolated(t *testing.T) {
+	dir := t.TempDir()
+
+	var configs []CampaignConfig
+	for _, name := range []string{"nord", "sued"} {
+		configFile := filepath.Join(dir, name+".toml")
+		if err := os.WriteFile(configFile, []byte(`admin_password = "`+name+`"`), 0o600); err != nil {
+			t.Fatalf("writing config: %v", err)
+		}
+
+		configs = append(configs, CampaignConfig{
+			Name:       name,
+			DBFile:     filepath.Join(dir, name+".jsonl"),
+			ConfigFile: configFile,
+		})
+	}
+
+	campaigns, err := openCampaigns(configs)
+	if err != nil {
+		t.Fatalf("openCampaigns: %v", err)
+	}
+	defer closeCampaigns(campaigns)
+
+	router := mux.NewRouter()
+	handleCampaigns(router, campaigns, os.DirFS(".."))
+
+	request := func(method, path, body, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Auth", password)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	resp := request("POST", "/api/c/nord/bieter", `{"name":"hugo","mail":"hugo@example.com"}`, "")
+	if resp.Code != 200 {
+		t.Fatalf("create bieter: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var created ViewBieter
+	if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decoding bieter: %v", err)
+	}
+
+	if resp := request("GET", "/api/c/nord/bieter/"+created.ID, "", ""); resp.Code != 200 {
+		t.Errorf("get bieter in same campaign: got status %d, expected 200", resp.Code)
+	}
+
+	if resp := request("GET", "/api/c/sued/bieter/"+created.ID, "", ""); resp.Code != 404 {
+		t.Errorf("get bieter in other campaign: got status %d, expected 404", resp.Code)
+	}
+
+	if resp := request("GET", "/api/c/sued/bieter", "", "nord"); resp.Code != 401 {
+		t.Errorf("list with password of other campaign: got status %d, expected 401", resp.Code)
+	}
+
+	resp = request("GET", "/api/c/sued/bieter", "", "sued")
+	if resp.Code != 200 {
+		t.Fatalf("list bieters: got status %d: %s", resp.Code, resp.Body.String())
+	}
+	if strings.Contains(resp.Body.String(), created.ID) {
+		t.Errorf("bieter of campaign nord is listed in campaign sued: %s", resp.Body.String())
+	}
+}
+
+func TestOpenCampaignsInvalidName(t *testing.T) {
+	_, err := openCampaigns([]CampaignConfig{{Name: "Nord/Ost"}})
+	if err == nil {
+		t.Errorf("openCampaigns accepted an invalid name")
+	}
+}
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"net"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -15,35 +20,582 @@ type Config struct {
 	AdminPW    string `toml:"admin_password"`
 	ListenAddr string `toml:"listen_addr"`
 	Domain     string `toml:"domain"`
+
+	// RequiredFields are the fields of the bieter payload, that have to be
+	// set on create and update.
+	RequiredFields []string `toml:"required_fields"`
+
+	// UnknownFields decides what happens with fields of the bieter payload,
+	// that are not used for the bietervertrag. It can be "keep", "strip" or
+	// "reject".
+	UnknownFields string `toml:"unknown_fields"`
+
+	// MaxLength are the maximal lengths of the text fields of the bieter
+	// payload.
+	MaxLength FieldLengths `toml:"max_length"`
+
+	// ContractTemplate is a file with text/template blocks, that overwrite
+	// the default texts of the bietervertrag.
+	ContractTemplate string `toml:"contract_template"`
+
+	// HeaderImage is the png image in the header of the pdfs. The path is
+	// resolved in the static files, so a file in ./static overwrites the
+	// embedded one.
+	HeaderImage string `toml:"header_image"`
+
+	Org OrgInfo `toml:"org"`
+
+	// SnapshotEvery is the number of events, after which a snapshot of the
+	// database is written. 0 disables snapshots.
+	SnapshotEvery int `toml:"snapshot_every"`
+
+	// Storage is where the events are saved. It can be "file" or "sqlite".
+	Storage string `toml:"storage"`
+
+	// SQLiteFile is the sqlite database for the storage "sqlite". Empty
+	// means the database file with the extension ".sqlite".
+	SQLiteFile string `toml:"sqlite_file"`
+
+	// BackupDir is the directory, where a backup is written every
+	// BackupInterval seconds. The backups are disabled, if one of both is
+	// not set.
+	BackupDir      string `toml:"backup_dir"`
+	BackupInterval int    `toml:"backup_interval"`
+
+	// BackupKeep is the number of backups in BackupDir, that are kept. Older
+	// backups are removed. 0 keeps all backups.
+	BackupKeep int `toml:"backup_keep"`
+
+	// LogFormat is the format of the log output. It can be "text" or "json".
+	LogFormat string `toml:"log_format"`
+
+	// StaticMaxAge is the max-age in seconds of the Cache-Control header for
+	// static files and the elm.js.
+	StaticMaxAge int `toml:"static_max_age"`
+
+	// StaticSources are the sources of the static files in the order of
+	// precedence. An entry is a directory or "embedded" for the files in the
+	// binary. With only "embedded", files on disk are ignored.
+	StaticSources []string `toml:"static_sources"`
+
+	// ShutdownTimeout is the number of seconds, the server waits for running
+	// requests on shutdown.
+	ShutdownTimeout int `toml:"shutdown_timeout"`
+
+	// TLSCert and TLSKey are the files of the certificate and the private
+	// key. If both are set, the server uses https.
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
+
+	// TLSRedirectAddr is an address, where a http server redirects all
+	// requests to the Domain. It is only used with TLS.
+	TLSRedirectAddr string `toml:"tls_redirect_addr"`
+
+	// MaxBodySize is the maximal size of a request body in bytes.
+	MaxBodySize int64 `toml:"max_body_size"`
+
+	// MaxBieter is the maximal number of bieters. When it is reached, only
+	// admins can create new bieters. Deleted bieters are not counted. 0 means
+	// no limit.
+	MaxBieter int `toml:"max_bieter"`
+
+	// UniqueMail rejects a bieter with a mail address, that is already used
+	// by another bieter. Admins can still save it.
+	UniqueMail bool `toml:"unique_mail"`
+
+	// Verteilstellen are the places, where the members get their vegetables.
+	Verteilstellen []Verteilstelle `toml:"verteilstellen"`
+
+	// Abbuchungen are the options, how the offer can be paid. The id 1 is a
+	// yearly payment and 0 a monthly payment. Bieters with another id are
+	// rejected.
+	Abbuchungen []AbbuchungOption `toml:"abbuchungen"`
+
+	// OfferDeadline is the time, after which only admins can change offers.
+	// The zero value means, that there is no deadline.
+	OfferDeadline time.Time `toml:"offer_deadline"`
+
+	// OfferDeadlineFinish sets the state to finished, when the deadline is
+	// reached.
+	OfferDeadlineFinish bool `toml:"offer_deadline_finish"`
+
+	// LowestOffer is the minimal monthly offer in cent.
+	LowestOffer int `toml:"lowest_offer"`
+
+	// Currency is the format of the offers in messages and pdfs.
+	Currency Currency `toml:"currency"`
+
+	// HistogramBucket is the size in cent of one bucket of the offer
+	// histogram.
+	HistogramBucket int `toml:"histogram_bucket"`
+
+	// Budget is the sum of the monthly offers in cent, that is needed.
+	Budget int `toml:"budget"`
+
+	// SeasonYear is the year, in which the season starts. A season goes from
+	// April to March of the next year. The default is the season, that runs
+	// when the server starts.
+	SeasonYear int `toml:"season_year"`
+
+	// EnableProfiling serves the pprof handlers for admins under
+	// /api/debug/pprof/.
+	EnableProfiling bool `toml:"enable_profiling"`
+
+	// Maintenance starts the server in maintenance mode. In this mode, the
+	// api only answers GET requests. Admins can switch it at runtime.
+	Maintenance bool `toml:"maintenance"`
+
+	// CORSOrigins are the origins of a frontend on another host, that can
+	// use the api. Empty disables CORS.
+	CORSOrigins []string `toml:"cors_origins"`
+
+	// SecurityHeaders sets headers like X-Content-Type-Options on all
+	// responses. With TLS, it also sets Strict-Transport-Security.
+	SecurityHeaders bool `toml:"security_headers"`
+
+	// ContentSecurityPolicy is the Content-Security-Policy header, that is
+	// set with SecurityHeaders. Empty disables the header.
+	ContentSecurityPolicy string `toml:"content_security_policy"`
+
+	// AdminAllowlist are the networks like 192.0.2.0/24, from which admin
+	// requests are allowed. Empty allows admin requests from everywhere.
+	AdminAllowlist []string `toml:"admin_allowlist"`
+
+	// TrustedProxies are the networks of reverse proxies. For requests from
+	// them, the client address is taken from the X-Forwarded-For header.
+	TrustedProxies []string `toml:"trusted_proxies"`
+
+	// adminNetworks and proxyNetworks are the parsed AdminAllowlist and
+	// TrustedProxies. They are set by parseAllowlist.
+	adminNetworks []*net.IPNet
+	proxyNetworks []*net.IPNet
+
+	// CreateRateLimit is the number of bieters, that can be created from
+	// one ip address per minute. Admins are not limited. 0 disables the
+	// limit.
+	CreateRateLimit int `toml:"create_rate_limit"`
+
+	// Honeypot is a field of the registration form, that is hidden for
+	// humans. A registration with a filled field is rejected. Empty disables
+	// the check.
+	Honeypot string `toml:"honeypot"`
+
+	// SMTP is the server for mails to the bieters. Without a host, no mails
+	// are sent.
+	SMTP SMTPConfig `toml:"smtp"`
+
+	// WebhookURL gets a POST request with a json message, when a new bieter
+	// registered. Empty disables the webhook.
+	WebhookURL string `toml:"webhook_url"`
+
+	// StateWebhookURL gets a POST request with a json message, when the
+	// service state changed. Empty disables the webhook.
+	StateWebhookURL string `toml:"state_webhook_url"`
+
+	// Campaigns are further bieterrunden, that are served by this server
+	// under /api/c/{name}. Each has its own database and config.
+	Campaigns []CampaignConfig `toml:"campaigns"`
+
+	// live are the values, that can be changed with a reload. It is shared
+	// by all copies of the config. Without it, the fields are used.
+	live *liveConfig
+}
+
+// Verteilstelle is a place, where the members get their vegetables.
+type Verteilstelle struct {
+	ID   int    `toml:"id" json:"id"`
+	Name string `toml:"name" json:"name"`
+}
+
+// AbbuchungOption is an option, how a bieter pays the offer.
+type AbbuchungOption struct {
+	ID   int    `toml:"id" json:"id"`
+	Name string `toml:"name" json:"name"`
+}
+
+// OrgInfo is the association, that is printed on the bietervertrag.
+type OrgInfo struct {
+	Name       string `toml:"name"`
+	Street     string `toml:"street"`
+	City       string `toml:"city"`
+	Website    string `toml:"website"`
+	CreditorID string `toml:"creditor_id"`
+}
+
+// headerLines returns the address block of the pdf header.
+func (o OrgInfo) headerLines() []string {
+	var lines []string
+	for _, line := range []string{o.Name, o.Street, o.City, o.Website} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
 }
 
 // DefaultConfig returns a config object with default values.
 func DefaultConfig() Config {
+	return defaultConfigAt(time.Now())
+}
+
+// defaultConfigAt returns the default config at the time now. The time is
+// only used for the season.
+func defaultConfigAt(now time.Time) Config {
 	return Config{
 		ListenAddr: ":9600",
 		Domain:     "http://localhost:9600",
+
+		RequiredFields:   []string{"name", "mail"},
+		UnknownFields:    unknownFieldsKeep,
+		ContractTemplate: "contract.tmpl",
+		HeaderImage:      "static/images/pdf_header_image.png",
+		SnapshotEvery:    100,
+		Storage:          storageFile,
+		BackupKeep:       10,
+		LogFormat:        "text",
+		StaticMaxAge:     3600,
+		StaticSources:    []string{"./static", staticEmbedded},
+		ShutdownTimeout:  10,
+		MaxBodySize:      64 << 10,
+		LowestOffer:      4000,
+		Currency:         defaultCurrency,
+		HistogramBucket:  500,
+		SeasonYear:       seasonYear(now),
+		SecurityHeaders:  true,
+
+		// The elm app only loads scripts, styles and images from the own
+		// host. Elm sets styles with the CSSOM, so no inline styles are
+		// needed.
+		ContentSecurityPolicy: "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'",
+
+		// The lengths fit into the layout of the bietervertrag.
+		MaxLength: FieldLengths{
+			Name:         100,
+			Mail:         254,
+			Kontoinhaber: 100,
+			Adresse:      200,
+			IBAN:         42,
+		},
+
+		Verteilstellen: []Verteilstelle{
+			{1, "Villingen"},
+			{2, "Schwenningen"},
+			{3, "Überauchen (Acker)"},
+		},
+
+		Abbuchungen: []AbbuchungOption{
+			{int(abbuchungMonatlich), "Monatlich"},
+			{int(abbuchungJaehrlich), "Jährlich"},
+		},
+
+		Org: OrgInfo{
+			Name:       "Solidarische Landwirtschaft Baarfood e.V.",
+			Street:     "Neckarstrasse 120",
+			City:       "78056 Villingen-Schwenningen",
+			Website:    "www.baarfood.de",
+			CreditorID: "DE62ZZZ00001997635",
+		},
 	}
 }
 
-// LoadConfig loads the config from a toml file.
+// LoadConfig loads the config from a toml file and the environment.
+//
+// Environment variables overwrite the values from the file, which overwrite
+// the defaults. See envVars for the names of the variables.
 func LoadConfig(file string) (Config, error) {
+	c, exists, err := readConfigFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := applyEnv(&c, os.LookupEnv); err != nil {
+		return Config{}, fmt.Errorf("reading environment: %w", err)
+	}
+
+	if !exists && c.AdminPW == "" {
+		setRandomPassword(&c)
+	}
+	return c, nil
+}
+
+// loadCampaignConfig loads the config of a campaign. The environment is not
+// used, because it would change all campaigns.
+func loadCampaignConfig(file string) (Config, error) {
+	c, exists, err := readConfigFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if !exists {
+		setRandomPassword(&c)
+	}
+	return c, nil
+}
+
+// readConfigFile reads the toml file on top of the default config. It returns
+// false, if the file does not exist.
+func readConfigFile(file string) (Config, bool, error) {
 	c := DefaultConfig()
 
 	f, err := os.Open(file)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			adminPW := randomPassword()
-			c.AdminPW = adminPW
-			log.Println("Warning: No config file. Use random admin password: " + adminPW)
-			return c, nil
+			return c, false, nil
 		}
-		return Config{}, fmt.Errorf("open config file: %w", err)
+		return Config{}, false, fmt.Errorf("open config file: %w", err)
 	}
+	defer f.Close()
 
 	if err := toml.NewDecoder(f).Decode(&c); err != nil {
-		return Config{}, fmt.Errorf("reading config: %w", err)
+		return Config{}, false, fmt.Errorf("reading config: %w", err)
 	}
-	return c, nil
+
+	if err := c.parseAllowlist(); err != nil {
+		return Config{}, false, err
+	}
+
+	if len(c.StaticSources) == 0 || slices.Contains(c.StaticSources, "") {
+		return Config{}, false, fmt.Errorf("static_sources: needs at least one source and no empty entries")
+	}
+
+	if c.BackupInterval < 0 || c.BackupKeep < 0 {
+		return Config{}, false, fmt.Errorf("backup_interval and backup_keep can not be negative")
+	}
+
+	switch c.UnknownFields {
+	case unknownFieldsKeep, unknownFieldsStrip, unknownFieldsReject:
+	default:
+		return Config{}, false, fmt.Errorf("unknown_fields: unknown value %q, expected keep, strip or reject", c.UnknownFields)
+	}
+	return c, true, nil
+}
+
+func setRandomPassword(c *Config) {
+	adminPW := randomPassword()
+	c.AdminPW = adminPW
+	log.Println("Warning: No config file. Use random admin password: " + adminPW)
+}
+
+// envVars are the environment variables, that overwrite the config.
+var envVars = []struct {
+	name string
+	set  func(c *Config, value string) error
+}{
+	{"BIETERRUNDE_ADMIN_PW", func(c *Config, v string) error { c.AdminPW = v; return nil }},
+	{"BIETERRUNDE_DOMAIN", func(c *Config, v string) error { c.Domain = v; return nil }},
+	{"BIETERRUNDE_LISTEN", func(c *Config, v string) error { c.ListenAddr = v; return nil }},
+	{"BIETERRUNDE_LOG_FORMAT", func(c *Config, v string) error { c.LogFormat = v; return nil }},
+	{"BIETERRUNDE_TLS_CERT", func(c *Config, v string) error { c.TLSCert = v; return nil }},
+	{"BIETERRUNDE_TLS_KEY", func(c *Config, v string) error { c.TLSKey = v; return nil }},
+	{"BIETERRUNDE_CONTRACT_TEMPLATE", func(c *Config, v string) error { c.ContractTemplate = v; return nil }},
+	{"BIETERRUNDE_STORAGE", func(c *Config, v string) error { c.Storage = v; return nil }},
+	{"BIETERRUNDE_SQLITE_FILE", func(c *Config, v string) error { c.SQLiteFile = v; return nil }},
+	{"BIETERRUNDE_SMTP_HOST", func(c *Config, v string) error { c.SMTP.Host = v; return nil }},
+	{"BIETERRUNDE_SMTP_PASSWORD", func(c *Config, v string) error { c.SMTP.Password = v; return nil }},
+	{"BIETERRUNDE_SNAPSHOT_EVERY", envInt(func(c *Config) *int { return &c.SnapshotEvery })},
+	{"BIETERRUNDE_MAX_BIETER", envInt(func(c *Config) *int { return &c.MaxBieter })},
+	{"BIETERRUNDE_BUDGET", envInt(func(c *Config) *int { return &c.Budget })},
+	{"BIETERRUNDE_SEASON_YEAR", envInt(func(c *Config) *int { return &c.SeasonYear })},
+	{"BIETERRUNDE_MAX_BODY_SIZE", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.MaxBodySize = n
+		return nil
+	}},
+	{"BIETERRUNDE_WEBHOOK_URL", func(c *Config, v string) error { c.WebhookURL = v; return nil }},
+	{"BIETERRUNDE_STATE_WEBHOOK_URL", func(c *Config, v string) error { c.StateWebhookURL = v; return nil }},
+	{"BIETERRUNDE_MAINTENANCE", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.Maintenance = b
+		return nil
+	}},
+}
+
+func envInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// applyEnv overwrites the config with the environment variables, that are set
+// and not empty.
+func applyEnv(c *Config, lookup func(string) (string, bool)) error {
+	for _, env := range envVars {
+		value, ok := lookup(env.name)
+		if !ok || value == "" {
+			continue
+		}
+
+		if err := env.set(c, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", env.name, err)
+		}
+	}
+	return nil
+}
+
+// reloadConfig reads the config file and the environment again. It returns
+// the current config with the values, that can be changed while the server is
+// running: admin_password, domain and lowest_offer.
+//
+// The banner is not part of the config. It can be changed with /api/banner.
+func reloadConfig(current Config, file string) (Config, error) {
+	c, exists, err := readConfigFile(file)
+	if err != nil {
+		return current, err
+	}
+
+	if !exists {
+		return current, fmt.Errorf("config file %q does not exist", file)
+	}
+
+	if err := applyEnv(&c, os.LookupEnv); err != nil {
+		return current, fmt.Errorf("reading environment: %w", err)
+	}
+
+	if c.ListenAddr != current.ListenAddr {
+		log.Println("Warning: listen_addr can only be changed with a restart.")
+	}
+
+	current.AdminPW = c.AdminPW
+	current.Domain = c.Domain
+	current.LowestOffer = c.LowestOffer
+	return current, nil
+}
+
+// seasonYear returns the year, in which the season at t started. The season
+// starts in April.
+func seasonYear(t time.Time) int {
+	if t.Month() < time.April {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+// liveConfig are the values of the config, that can be changed while the
+// server is running.
+type liveConfig struct {
+	mu          sync.RWMutex
+	adminPW     string
+	domain      string
+	lowestOffer int
+}
+
+// withLive returns the config with the values of the fields in a liveConfig.
+// After that, reloads of the returned config and all its copies change the
+// values with setLive.
+func (c Config) withLive() Config {
+	c.live = &liveConfig{}
+	c.setLive(c)
+	return c
+}
+
+// setLive changes the values of the liveConfig to the values of the reloaded
+// config. It does nothing, if the config has no liveConfig.
+func (c Config) setLive(reloaded Config) {
+	if c.live == nil {
+		return
+	}
+
+	c.live.mu.Lock()
+	defer c.live.mu.Unlock()
+
+	c.live.adminPW = reloaded.AdminPW
+	c.live.domain = reloaded.Domain
+	c.live.lowestOffer = reloaded.LowestOffer
+}
+
+// adminPassword returns the current admin password.
+func (c Config) adminPassword() string {
+	if c.live == nil {
+		return c.AdminPW
+	}
+
+	c.live.mu.RLock()
+	defer c.live.mu.RUnlock()
+	return c.live.adminPW
+}
+
+// domain returns the current domain.
+func (c Config) domain() string {
+	if c.live == nil {
+		return c.Domain
+	}
+
+	c.live.mu.RLock()
+	defer c.live.mu.RUnlock()
+	return c.live.domain
+}
+
+// lowestOffer returns the current lowest offer.
+func (c Config) lowestOffer() int {
+	if c.live == nil {
+		return c.LowestOffer
+	}
+
+	c.live.mu.RLock()
+	defer c.live.mu.RUnlock()
+	return c.live.lowestOffer
+}
+
+// verteilstelle returns the verteilstelle with the id.
+func (c Config) verteilstelle(id int) (Verteilstelle, bool) {
+	for _, v := range c.Verteilstellen {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Verteilstelle{}, false
+}
+
+// verteilstelleName returns the name of the verteilstelle or "UNGÜLTIG", if
+// the id is unknown.
+func (c Config) verteilstelleName(id int) string {
+	v, ok := c.verteilstelle(id)
+	if !ok {
+		return "UNGÜLTIG"
+	}
+	return v.Name
+}
+
+// abbuchung returns the abbuchung option with the id.
+func (c Config) abbuchung(id int) (AbbuchungOption, bool) {
+	for _, a := range c.Abbuchungen {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return AbbuchungOption{}, false
+}
+
+// abbuchungName returns the name of the abbuchung option or "UNGÜLTIG", if
+// the id is unknown.
+func (c Config) abbuchungName(id int) string {
+	a, ok := c.abbuchung(id)
+	if !ok {
+		return "UNGÜLTIG"
+	}
+	return a.Name
+}
+
+// deadlinePassed returns true, if there is an offer deadline and it is
+// before now.
+func (c Config) deadlinePassed(now time.Time) bool {
+	return !c.OfferDeadline.IsZero() && now.After(c.OfferDeadline)
+}
+
+// useTLS returns true, if the server should use https.
+func (c Config) useTLS() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
 }
 
 func randomPassword() string {
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLoadConfigEnv(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	config := "admin_password = \"from-file\"\ndomain = \"https://file.example\"\nbudget = 100\n"
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	t.Setenv("BIETERRUNDE_ADMIN_PW", "from-env")
+	t.Setenv("BIETERRUNDE_LISTEN", "127.0.0.1:9000")
+	t.Setenv("BIETERRUNDE_BUDGET", "5000")
+	t.Setenv("BIETERRUNDE_MAINTENANCE", "true")
+	t.Setenv("BIETERRUNDE_DOMAIN", "")
+
+	c, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if c.AdminPW != "from-env" {
+		t.Errorf("got admin password %q, expected the value from the environment", c.AdminPW)
+	}
+
+	if c.ListenAddr != "127.0.0.1:9000" {
+		t.Errorf("got listen address %q, expected 127.0.0.1:9000", c.ListenAddr)
+	}
+
+	if c.Budget != 5000 {
+		t.Errorf("got budget %d, expected 5000", c.Budget)
+	}
+
+	if !c.Maintenance {
+		t.Errorf("maintenance is not set")
+	}
+
+	if c.Domain != "https://file.example" {
+		t.Errorf("got domain %q, expected the value from the file", c.Domain)
+	}
+}
+
+func TestLoadConfigEnvWithoutFile(t *testing.T) {
+	t.Setenv("BIETERRUNDE_ADMIN_PW", "from-env")
+
+	c, err := LoadConfig(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if c.AdminPW != "from-env" {
+		t.Errorf("got admin password %q, expected the value from the environment", c.AdminPW)
+	}
+}
+
+func TestLoadConfigEnvInvalid(t *testing.T) {
+	t.Setenv("BIETERRUNDE_BUDGET", "viel")
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Errorf("LoadConfig accepted an invalid number")
+	}
+}
+
+func TestStaticSourcesInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(file, []byte(`static_sources = []`), 0600); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if _, err := LoadConfig(file); err == nil {
+		t.Errorf("LoadConfig with empty static_sources did not return an error")
+	}
+}
+
+func TestLiveConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.AdminPW = "old"
+	config = config.withLive()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer db.Close()
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, DefaultFiles{Static: os.DirFS("..")})
+
+	request := func(password string) int {
+		req := httptest.NewRequest("GET", "/api/bieter", nil)
+		req.Header.Set("Auth", password)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request("old"); code != 200 {
+		t.Fatalf("got status %d with the old password, expected 200", code)
+	}
+
+	reloaded := config
+	reloaded.AdminPW = "new"
+	reloaded.LowestOffer = 6000
+	config.setLive(reloaded)
+
+	if code := request("old"); code != 401 {
+		t.Errorf("got status %d with the old password after the reload, expected 401", code)
+	}
+
+	if code := request("new"); code != 200 {
+		t.Errorf("got status %d with the new password after the reload, expected 200", code)
+	}
+
+	if lowest := db.config.lowestOffer(); lowest != 6000 {
+		t.Errorf("database has the lowest offer %d, expected 6000", lowest)
+	}
+}
+
+func TestLiveConfigSetAdminPassword(t *testing.T) {
+	config := DefaultConfig()
+	config = config.withLive()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer db.Close()
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, DefaultFiles{Static: os.DirFS("..")})
+
+	req := httptest.NewRequest("GET", "/api/bieter", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 401 {
+		t.Errorf("got status %d without an admin password, expected 401", rec.Code)
+	}
+
+	reloaded := config
+	reloaded.AdminPW = "new"
+	config.setLive(reloaded)
+
+	req = httptest.NewRequest("GET", "/api/bieter", nil)
+	req.Header.Set("Auth", "new")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Errorf("got status %d after the admin password was set with a reload, expected 200", rec.Code)
+	}
+}
+
+func TestDefaultSeasonYear(t *testing.T) {
+	for _, tt := range []struct {
+		now    time.Time
+		expect int
+	}{
+		{time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC), 2024},
+		{time.Date(2025, time.March, 31, 23, 59, 0, 0, time.UTC), 2024},
+		{time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC), 2025},
+		{time.Date(2025, time.December, 31, 12, 0, 0, 0, time.UTC), 2025},
+	} {
+		if got := defaultConfigAt(tt.now).SeasonYear; got != tt.expect {
+			t.Errorf("got season year %d at %s, expected %d", got, tt.now.Format("2006-01-02"), tt.expect)
+		}
+	}
+}
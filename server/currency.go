@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Currency is the format of amounts in messages and pdfs.
+type Currency struct {
+	Symbol             string `toml:"symbol"`
+	DecimalSeparator   string `toml:"decimal_separator"`
+	ThousandsSeparator string `toml:"thousands_separator"`
+
+	// SymbolFirst puts the symbol in front of the amount, for example
+	// "$40.00" instead of "40,00 €".
+	SymbolFirst bool `toml:"symbol_first"`
+}
+
+// defaultCurrency formats amounts as euro like "1.045,00 €".
+var defaultCurrency = Currency{
+	Symbol:             "€",
+	DecimalSeparator:   ",",
+	ThousandsSeparator: ".",
+}
+
+// format formats an amount in cent.
+func (c Currency) format(cent int) string {
+	sign := ""
+	if cent < 0 {
+		sign = "-"
+		cent = -cent
+	}
+
+	units := strconv.Itoa(cent / 100)
+	for i := len(units) - 3; i > 0; i -= 3 {
+		units = units[:i] + c.ThousandsSeparator + units[i:]
+	}
+	amount := fmt.Sprintf("%s%s%02d", units, c.DecimalSeparator, cent%100)
+
+	if c.Symbol == "" {
+		return sign + amount
+	}
+
+	if c.SymbolFirst {
+		return sign + c.Symbol + amount
+	}
+	return sign + amount + " " + c.Symbol
+}
+
+// formatEuro formats an amount in cent as euro, for example "1.045,00 €".
+func formatEuro(cent int) string {
+	return defaultCurrency.format(cent)
+}
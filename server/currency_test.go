@@ -0,0 +1,24 @@
+package server
+
+import "testing"
+
+func TestCurrencyFormat(t *testing.T) {
+	dollar := Currency{Symbol: "$", DecimalSeparator: ".", ThousandsSeparator: ",", SymbolFirst: true}
+
+	for _, tt := range []struct {
+		currency Currency
+		cent     int
+		expect   string
+	}{
+		{defaultCurrency, 4000, "40,00 €"},
+		{defaultCurrency, 4550, "45,50 €"},
+		{dollar, 4000, "$40.00"},
+		{dollar, 123456, "$1,234.56"},
+		{dollar, -4550, "-$45.50"},
+		{Currency{DecimalSeparator: ","}, 4550, "45,50"},
+	} {
+		if got := tt.currency.format(tt.cent); got != tt.expect {
+			t.Errorf("format(%d) with %+v = %q, expected %q", tt.cent, tt.currency, got, tt.expect)
+		}
+	}
+}
@@ -3,119 +3,321 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
 	"os"
-	"strconv"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxUndo is the number of events, that can be undone.
+const maxUndo = 100
+
+// errDBClosed is returned, when an event is written after the database was
+// closed.
+var errDBClosed = clientError{msg: "Der Server wird beendet", status: 503, code: "SHUTTING_DOWN"}
+
 // Database holds the data in memory and saves them to disk.
 type Database struct {
 	sync.RWMutex
 	file string
 
+	// config is not changed after the database is opened, so it can be read
+	// without the lock. The values, that are changed on a reload, are read
+	// with the methods of Config.
+	config Config
+
 	bieter map[string]json.RawMessage
+	times  map[string]BieterTimes
 	offer  map[string]int
 	state  ServiceState
+
+	// banner is a message, that is shown to all users. Empty means no
+	// banner.
+	banner string
+
+	// deleted are the bieters, that are deleted, but can be restored. The
+	// value is the time of the deletion.
+	deleted map[string]time.Time
+
+	// rounds are the offers of the previous bidding rounds. The offers are
+	// archived, when they are cleared. The current round is len(rounds)+1.
+	rounds []map[string]int
+
+	// versions counts the changes of the payload of each bieter. It is used
+	// to detect concurrent updates.
+	versions map[string]int
+
+	// store saves the events.
+	store               eventStore
+	eventsSinceSnapshot int
+
+	// undo are the inverse events of the events, that were written since the
+	// server was started.
+	undo []Event
+
+	subscriberMu sync.Mutex
+	subscribers  map[chan Event]struct{}
+
+	webhooks *webhookSender
+
+	closed bool
+
+	// maintenance blocks all writing requests. It is not saved.
+	maintenance atomic.Bool
 }
 
 // NewDB load the db from file.
-func NewDB(file string) (*Database, error) {
-	db, err := openDB(file)
+//
+// With the sqlite storage, the events are saved in a sqlite database instead.
+// See Config.Storage.
+func NewDB(file string, config Config) (*Database, error) {
+	file = storageFileName(file, config)
+
+	var db *Database
+	var err error
+	switch config.Storage {
+	case "", storageFile:
+		db, err = openDB(file)
+	case storageSQLite:
+		db, err = openSQLiteDB(file)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", config.Storage)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 
 	db.file = file
+	db.config = config
+	db.maintenance.Store(config.Maintenance)
 	return db, nil
 }
 
+// Maintenance returns true, if the database is in maintenance mode.
+func (db *Database) Maintenance() bool {
+	return db.maintenance.Load()
+}
+
+// SetMaintenance switches the maintenance mode.
+func (db *Database) SetMaintenance(on bool) {
+	db.maintenance.Store(on)
+}
+
+// openDB loads the database from the snapshot and the events in the database
+// file, that were written after the snapshot.
 func openDB(file string) (*Database, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return emptyDatabase(), nil
+			db := emptyDatabase()
+			db.store = &fileStore{file: file}
+			return db, nil
 		}
 		return nil, fmt.Errorf("open database file: %w", err)
 	}
 	defer f.Close()
 
-	db, err := loadDatabase(f)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("reading database file info: %w", err)
+	}
+
+	db, offset, err := loadSnapshot(snapshotFile(file))
+	if err != nil {
+		return nil, fmt.Errorf("loading snapshot: %w", err)
+	}
+
+	if offset > info.Size() {
+		log.Printf("Warning: Snapshot does not match %s. Ignoring it.", file)
+		db = emptyDatabase()
+		offset = 0
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seeking to end of snapshot: %w", err)
+	}
+
+	validSize, err := db.replay(f)
 	if err != nil {
 		return nil, fmt.Errorf("loading database: %w", err)
 	}
+	validSize += offset
+
+	if validSize < info.Size() {
+		// Remove the corrupt event. In other case, the next event would be
+		// appended to the same line.
+		log.Printf("Warning: Removing corrupt last event from %s", file)
+		if err := os.Truncate(file, validSize); err != nil {
+			return nil, fmt.Errorf("removing corrupt event: %w", err)
+		}
+	}
+
+	db.store = &fileStore{file: file, size: validSize}
 	return db, nil
 }
 
 func emptyDatabase() *Database {
 	return &Database{
 		bieter: make(map[string]json.RawMessage),
+		times:  make(map[string]BieterTimes),
 		offer:  make(map[string]int),
 		state:  stateRegistration,
+
+		deleted:  make(map[string]time.Time),
+		versions: make(map[string]int),
+
+		store:    &fileStore{},
+		webhooks: newWebhookSender(),
 	}
 }
 
 func loadDatabase(r io.Reader) (*Database, error) {
 	db := emptyDatabase()
+	if _, err := db.replay(r); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := bytes.TrimSpace(scanner.Bytes())
-		if len(line) == 0 {
-			continue
-		}
+// replay executes all events from r in the order they were written. It
+// returns the number of bytes, that contain valid events.
+//
+// A corrupt last line is ignored. This happens, when the server is killed
+// while writing an event.
+func (db *Database) replay(r io.Reader) (int64, error) {
+	reader := bufio.NewReader(r)
 
-		var typer struct {
-			Type    string          `json:"type"`
-			Payload json.RawMessage `json:"payload"`
-		}
-		if err := json.Unmarshal(line, &typer); err != nil {
-			return nil, fmt.Errorf("decoding event: %w", err)
+	var offset, validSize int64
+	var errCorrupt error
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return 0, fmt.Errorf("reading events: %w", readErr)
 		}
+		offset += int64(len(line))
 
-		event := getEvent(typer.Type)
-		if event == nil {
-			return nil, fmt.Errorf("Unknown event %q, payload %q", typer.Type, typer.Payload)
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			if errCorrupt != nil {
+				// The corrupt line was not the last line.
+				return 0, errCorrupt
+			}
+
+			event, err := decodeEvent(line)
+			if err != nil {
+				errCorrupt = err
+			} else {
+				if err := event.execute(db); err != nil {
+					return 0, fmt.Errorf("executing event %q: %w", event.Name(), err)
+				}
+			}
 		}
 
-		if err := json.Unmarshal(typer.Payload, &event); err != nil {
-			return nil, fmt.Errorf("loading event %q: %w", typer.Type, err)
+		if errCorrupt == nil {
+			validSize = offset
 		}
 
-		if err := event.execute(db); err != nil {
-			return nil, fmt.Errorf("executing event %q: %w", typer.Type, err)
+		if readErr == io.EOF {
+			break
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scanning events: %w", err)
+
+	return validSize, nil
+}
+
+// decodeEvent decodes one line of the database file.
+func decodeEvent(line []byte) (Event, error) {
+	var typer struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(line, &typer); err != nil {
+		return nil, fmt.Errorf("decoding event: %w", err)
 	}
 
-	return db, nil
+	event := getEvent(typer.Type)
+	if event == nil {
+		return nil, fmt.Errorf("Unknown event %q, payload %q", typer.Type, typer.Payload)
+	}
+
+	if err := json.Unmarshal(typer.Payload, &event); err != nil {
+		return nil, fmt.Errorf("loading event %q: %w", typer.Type, err)
+	}
+
+	return event, nil
 }
 
-func (db *Database) writeEvent(e Event) (err error) {
+func (db *Database) writeEvent(e Event) error {
 	db.Lock()
 	defer db.Unlock()
 
-	if err := e.validate(db); err != nil {
+	return db.writeEventLocked(e)
+}
+
+// dryRun validates an event like writeEvent, but does not execute or save
+// it.
+func (db *Database) dryRun(e Event) error {
+	db.RLock()
+	defer db.RUnlock()
+
+	return e.validate(db)
+}
+
+// writeEventLocked validates and saves an event.
+//
+// Has to be called with the write lock.
+func (db *Database) writeEventLocked(e Event) (err error) {
+	// The methods of the database have no context. So the span of the event
+	// is not a child of the request span.
+	ctx, span := tracer().Start(context.Background(), "event "+e.Name())
+	defer func() { endSpan(span, err) }()
+
+	_, validateSpan := tracer().Start(ctx, "validate")
+	err = e.validate(db)
+	endSpan(validateSpan, err)
+	if err != nil {
 		return fmt.Errorf("validating event: %w", err)
 	}
 
-	f, err := os.OpenFile(db.file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	inverse, err := e.inverse(db)
 	if err != nil {
-		return fmt.Errorf("open db file: %w", err)
+		return fmt.Errorf("creating inverse event: %w", err)
+	}
+
+	if err = db.saveEvent(ctx, e); err != nil {
+		return err
+	}
+
+	if inverse == nil {
+		// The event can not be undone. So the events before can also not be
+		// undone.
+		db.undo = nil
+		return nil
+	}
+
+	db.undo = append(db.undo, inverse)
+	if len(db.undo) > maxUndo {
+		db.undo = db.undo[len(db.undo)-maxUndo:]
+	}
+	return nil
+}
+
+// saveEvent writes a validated event to the store and executes it.
+//
+// Has to be called with the write lock.
+func (db *Database) saveEvent(ctx context.Context, e Event) error {
+	if db.closed {
+		return errDBClosed
 	}
-	defer func() {
-		wErr := f.Close()
-		if err != nil {
-			err = wErr
-		}
-	}()
 
 	event := struct {
 		Type    string `json:"type"`
@@ -132,19 +334,309 @@ func (db *Database) writeEvent(e Event) (err error) {
 		return fmt.Errorf("encoding event: %w", err)
 	}
 
-	bs = append(bs, '\n')
-
-	if _, err := f.Write(bs); err != nil {
-		return fmt.Errorf("writing event to file: %q: %w", bs, err)
+	if err := db.store.append(bs); err != nil {
+		return err
 	}
 
-	if err := e.execute(db); err != nil {
+	// The webhook needs the data from before the event.
+	webhookURL, notification := webhookNotification(db, e)
+
+	_, span := tracer().Start(ctx, "execute")
+	err = e.execute(db)
+	endSpan(span, err)
+	if err != nil {
 		return fmt.Errorf("executing event: %w", err)
 	}
 
+	db.eventsSinceSnapshot++
+	if every := db.config.SnapshotEvery; every > 0 && db.eventsSinceSnapshot >= every {
+		// The event is already saved. So a failing snapshot is not an error.
+		if err := db.writeSnapshot(); err != nil {
+			log.Printf("Error: writing snapshot: %v", err)
+		}
+	}
+
+	db.publish(e)
+
+	db.webhooks.sendAsync(webhookURL, notification)
 	return nil
 }
 
+// Close waits for running writes, writes a snapshot and flushes the events
+// to disk. Events can not be written after the database was closed.
+//
+// It returns after the webhooks of the written events are sent.
+func (db *Database) Close() error {
+	// The webhooks are waited for without the lock. No new webhooks can be
+	// started, after the database is marked as closed.
+	defer db.webhooks.wait()
+
+	db.Lock()
+	defer db.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+
+	if db.eventsSinceSnapshot > 0 && db.config.SnapshotEvery > 0 {
+		if err := db.writeSnapshot(); err != nil {
+			log.Printf("Error: writing snapshot: %v", err)
+		}
+	}
+
+	if err := db.store.sync(); err != nil {
+		return err
+	}
+	return db.store.close()
+}
+
+// finishAtDeadline sets the state to finished, when the offer deadline is
+// reached. It returns, when the context is canceled.
+func (db *Database) finishAtDeadline(ctx context.Context) {
+	deadline := db.config.OfferDeadline
+	if deadline.IsZero() || !db.config.OfferDeadlineFinish {
+		return
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	if db.State() != stateOffer {
+		return
+	}
+
+	event, err := newEventStatus(stateFinished)
+	if err != nil {
+		log.Printf("Error: creating state event at deadline: %v", err)
+		return
+	}
+
+	if err := db.writeEvent(event); err != nil {
+		log.Printf("Error: finishing at deadline: %v", err)
+		return
+	}
+	log.Println("Offer deadline reached. The bieterrunde is finished.")
+}
+
+// Undo reverts the last event, that was written since the server was started.
+//
+// Returns the event, that reverted the change.
+func (db *Database) Undo(asAdmin bool) (Event, error) {
+	if !asAdmin {
+		return nil, validationError{msg: "Not allowed", code: "NOT_ALLOWED"}
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	if len(db.undo) == 0 {
+		return nil, validationError{msg: "Es gibt nichts, was rückgängig gemacht werden kann", code: "NOTHING_TO_UNDO"}
+	}
+
+	inverse := db.undo[len(db.undo)-1]
+	if err := inverse.validate(db); err != nil {
+		return nil, fmt.Errorf("validating inverse event: %w", err)
+	}
+
+	if err := db.saveEvent(context.Background(), inverse); err != nil {
+		return nil, fmt.Errorf("writing inverse event: %w", err)
+	}
+
+	db.undo = db.undo[:len(db.undo)-1]
+	return inverse, nil
+}
+
+// EventLog returns all events from the store in the order they were
+// executed.
+func (db *Database) EventLog() ([]Event, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	lines, err := db.store.events()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(lines))
+	for _, line := range lines {
+		event, err := decodeEvent(line)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// exportedEvent is one line of the ndjson event export.
+type exportedEvent struct {
+	Name    string          `json:"name"`
+	Time    time.Time       `json:"time"`
+	Actor   string          `json:"actor"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// EventImport is the result of ImportEvents.
+type EventImport struct {
+	Applied int                  `json:"applied"`
+	Failed  []EventImportFailure `json:"failed"`
+}
+
+// EventImportFailure is an event, that could not be imported. Line starts
+// with 1.
+type EventImportFailure struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportEvents reads events in the format of the ndjson export and validates
+// and executes them in order. Invalid events are skipped and reported.
+//
+// With validateOnly, the events are executed on a copy of the database, so
+// the result is the same as with a real import, but nothing is changed.
+func (db *Database) ImportEvents(r io.Reader, validateOnly bool) (EventImport, error) {
+	// The body is read before the lock, so a slow client does not block
+	// the database.
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return EventImport{}, fmt.Errorf("reading events: %w", err)
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	target := db
+	if validateOnly {
+		copied, err := db.copyLocked()
+		if err != nil {
+			return EventImport{}, fmt.Errorf("copy database: %w", err)
+		}
+		target = copied
+	}
+
+	result := EventImport{Failed: []EventImportFailure{}}
+	for i, line := range bytes.Split(body, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+
+		name, err := target.importEvent(line, validateOnly)
+		if err != nil {
+			result.Failed = append(result.Failed, EventImportFailure{
+				Line:  i + 1,
+				Name:  name,
+				Error: clientMessage(err),
+			})
+			continue
+		}
+		result.Applied++
+	}
+	return result, nil
+}
+
+// importEvent decodes one line of the ndjson export and writes the event.
+// With validateOnly, the event is only executed and not saved.
+//
+// Has to be called with the write lock.
+func (db *Database) importEvent(line []byte, validateOnly bool) (string, error) {
+	var exported exportedEvent
+	if err := json.Unmarshal(line, &exported); err != nil {
+		return "", validationError{msg: fmt.Sprintf("Ungültiges JSON: %v", err), code: "INVALID_EVENT"}
+	}
+
+	event := getEvent(exported.Name)
+	if event == nil {
+		return exported.Name, validationError{msg: fmt.Sprintf("Unbekanntes Event %q", exported.Name), code: "INVALID_EVENT"}
+	}
+
+	if err := json.Unmarshal(exported.Payload, event); err != nil {
+		return exported.Name, validationError{msg: fmt.Sprintf("Ungültige Daten für Event %q: %v", exported.Name, err), code: "INVALID_EVENT"}
+	}
+
+	if restorer, ok := event.(flagRestorer); ok {
+		restorer.restoreFlags(db)
+	}
+
+	// The other code writes the events as values. The type switches, for
+	// example in streamMessage, only match them.
+	event = eventValue(event)
+
+	if validateOnly {
+		if err := event.validate(db); err != nil {
+			return exported.Name, err
+		}
+		return exported.Name, event.execute(db)
+	}
+
+	return exported.Name, db.writeEventLocked(event)
+}
+
+// copyLocked returns a copy of the data of the database. The copy has no
+// store, so its events can only be validated and executed.
+//
+// Has to be called with the lock.
+func (db *Database) copyLocked() (*Database, error) {
+	bs, err := json.Marshal(db.currentSnapshot())
+	if err != nil {
+		return nil, fmt.Errorf("encoding data: %w", err)
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return nil, fmt.Errorf("decoding data: %w", err)
+	}
+
+	copied := emptyDatabase()
+	copied.config = db.config
+	copied.restoreSnapshot(s)
+	return copied, nil
+}
+
+// subscribe returns a channel that receives all executed events.
+//
+// The returned function has to be called to unsubscribe.
+func (db *Database) subscribe() (<-chan Event, func()) {
+	db.subscriberMu.Lock()
+	defer db.subscriberMu.Unlock()
+
+	if db.subscribers == nil {
+		db.subscribers = make(map[chan Event]struct{})
+	}
+
+	c := make(chan Event, 16)
+	db.subscribers[c] = struct{}{}
+
+	return c, func() {
+		db.subscriberMu.Lock()
+		defer db.subscriberMu.Unlock()
+		delete(db.subscribers, c)
+	}
+}
+
+// publish sends the event to all subscribers.
+//
+// Subscribers that are to slow to receive the event miss it.
+func (db *Database) publish(e Event) {
+	db.subscriberMu.Lock()
+	defer db.subscriberMu.Unlock()
+
+	for c := range db.subscribers {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
 // ServiceState is the state of the service.
 type ServiceState int
 
@@ -153,10 +645,26 @@ const (
 	stateRegistration
 	stateValidation
 	stateOffer
+	stateFinished
 )
 
+// stateTransitions are the allowed changes of the service state. Going back to
+// stateRegistration resets the flow.
+var stateTransitions = map[ServiceState][]ServiceState{
+	stateRegistration: {stateValidation, stateOffer},
+	stateValidation:   {stateRegistration, stateOffer},
+	stateOffer:        {stateRegistration, stateFinished},
+	stateFinished:     {stateRegistration},
+}
+
+// serviceStateNames are the names of the states for String.
+var serviceStateNames = [...]string{"0 - Ungültig", "1 - Registrierung", "2 - Überprüfung", "3 - Gebote", "4 - Abgeschlossen"}
+
 func (s ServiceState) String() string {
-	return [...]string{"0 - Ungültig", "1 - Registrierung", "2 - Überprüfung", "3 - Gebote"}[s]
+	if s < 0 || int(s) >= len(serviceStateNames) {
+		return fmt.Sprintf("%d - Ungültig", int(s))
+	}
+	return serviceStateNames[s]
 }
 
 // Bieter returns the  data for a bieterID.
@@ -164,54 +672,215 @@ func (db *Database) Bieter(id string) (json.RawMessage, bool) {
 	db.RLock()
 	defer db.RUnlock()
 
-	bieter, ok := db.bieter[id]
-	return bieter, ok
+	if !db.exists(id) {
+		return nil, false
+	}
+	return cloneRaw(db.bieter[id]), true
+}
+
+// exists returns true, if the bieter exists and is not deleted.
+//
+// Has to be called with the lock.
+func (db *Database) exists(id string) bool {
+	if _, ok := db.bieter[id]; !ok {
+		return false
+	}
+
+	_, deleted := db.deleted[id]
+	return !deleted
+}
+
+// BieterTimes are the timestamps of a bieter.
+//
+// They are zero for bieters, that were created before the events had
+// timestamps.
+type BieterTimes struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Version returns the current version of the bieter payload.
+func (db *Database) Version(id string) int {
+	db.RLock()
+	defer db.RUnlock()
+
+	return db.versions[id]
+}
+
+// Times returns the timestamps of a bieter.
+func (db *Database) Times(id string) BieterTimes {
+	db.RLock()
+	defer db.RUnlock()
+
+	return db.times[id]
 }
 
 // BieterList return all bieters.
+//
+// The returned map and payloads are copies, so the caller can use them after
+// the lock is released.
 func (db *Database) BieterList() map[string]json.RawMessage {
 	db.RLock()
 	defer db.RUnlock()
 
-	// Make a copy of the data so
 	c := make(map[string]json.RawMessage, len(db.bieter))
 	for k, v := range db.bieter {
-		c[k] = v
+		if _, deleted := db.deleted[k]; deleted {
+			continue
+		}
+		c[k] = cloneRaw(v)
 	}
 
 	return c
 }
 
-// NewBieter creates a new bieter and returns its id.
-func (db *Database) NewBieter(payload json.RawMessage, asAdmin bool) (string, error) {
-	var id string
-	for {
-		id = strconv.Itoa(rand.Intn(100_000_000))
-		event, err := newEventCreate(id, payload, asAdmin)
-		if err != nil {
-			return "", fmt.Errorf("invalid event: %w", err)
+// BieterIDs returns the sorted ids of all bieters, that are not deleted.
+func (db *Database) BieterIDs() []string {
+	db.RLock()
+	defer db.RUnlock()
+
+	ids := make([]string, 0, len(db.bieter))
+	for id := range db.bieter {
+		if _, deleted := db.deleted[id]; !deleted {
+			ids = append(ids, id)
 		}
+	}
+	sort.Strings(ids)
+	return ids
+}
 
-		if err := db.writeEvent(event); err != nil {
-			if errors.Is(err, errIDExists) {
-				continue
-			}
-			return "", fmt.Errorf("creating event: %w", err)
+// BieterByMail returns the sorted ids of the bieters with the mail address.
+// The address is compared case insensitive.
+func (db *Database) BieterByMail(mailAddr string) []string {
+	mailAddr = strings.ToLower(strings.TrimSpace(mailAddr))
+	if mailAddr == "" {
+		return nil
+	}
+
+	db.RLock()
+	defer db.RUnlock()
+
+	var ids []string
+	for id, payload := range db.bieter {
+		if db.exists(id) && payloadMail(payload) == mailAddr {
+			ids = append(ids, id)
 		}
-		break
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Count returns the number of bieters and the number of their offers.
+func (db *Database) Count() (bieter int, offers int) {
+	db.RLock()
+	defer db.RUnlock()
+
+	return db.count()
+}
+
+// count is like Count but has to be called with the lock.
+func (db *Database) count() (bieter int, offers int) {
+	for id := range db.bieter {
+		if _, deleted := db.deleted[id]; deleted {
+			continue
+		}
+		bieter++
+
+		if db.offer[id] > 0 {
+			offers++
+		}
+	}
+	return bieter, offers
+}
+
+// activeBieter returns the number of bieters, that are not deleted.
+//
+// Has to be called with the lock.
+func (db *Database) activeBieter() int {
+	n := 0
+	for id := range db.bieter {
+		if _, deleted := db.deleted[id]; !deleted {
+			n++
+		}
+	}
+	return n
+}
+
+// cloneRaw returns a copy of the payload.
+func cloneRaw(payload json.RawMessage) json.RawMessage {
+	if payload == nil {
+		return nil
+	}
+	return append(json.RawMessage(nil), payload...)
+}
+
+// NewBieter creates a new bieter and returns its id.
+func (db *Database) NewBieter(payload json.RawMessage, asAdmin bool) (string, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	payload, err := sanitizePayload(payload, db.config.UnknownFields)
+	if err != nil {
+		return "", err
+	}
+
+	id := db.uniqueID(randomID)
+	event, err := newEventCreate(id, payload, asAdmin)
+	if err != nil {
+		return "", fmt.Errorf("invalid event: %w", err)
+	}
+
+	if err := db.writeEventLocked(event); err != nil {
+		return "", fmt.Errorf("creating event: %w", err)
 	}
 
 	return id, nil
 }
 
+// idAlphabet are the characters of a bieter id. Characters, that are easy to
+// confuse like O and 0 or I and 1 are left out.
+const idAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// idLength is the number of characters of a bieter id.
+const idLength = 6
+
+// randomID returns a new random bieter id.
+func randomID() string {
+	b := make([]byte, idLength)
+	for i := range b {
+		b[i] = idAlphabet[rand.Intn(len(idAlphabet))]
+	}
+	return string(b)
+}
+
+// uniqueID returns the first id from newID, that is not used by a bieter.
+//
+// Has to be called with the lock.
+func (db *Database) uniqueID(newID func() string) string {
+	for {
+		id := newID()
+		if _, exists := db.bieter[id]; !exists {
+			return id
+		}
+	}
+}
+
 // UpdateBieter updates an existing bieter. The new payload is read from r and
 // is returned (on success).
-func (db *Database) UpdateBieter(id string, r io.Reader, asAdmin bool) (json.RawMessage, error) {
+//
+// If version is not 0, the update is rejected, if the bieter was changed since
+// this version.
+func (db *Database) UpdateBieter(id string, r io.Reader, version int, asAdmin bool) (json.RawMessage, error) {
 	payload, err := io.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("reading body for update: %w", err)
 	}
 
+	payload, err = sanitizePayload(payload, db.config.UnknownFields)
+	if err != nil {
+		return nil, err
+	}
+
 	event, err := newEventUpdate(
 		id,
 		payload,
@@ -220,14 +889,58 @@ func (db *Database) UpdateBieter(id string, r io.Reader, asAdmin bool) (json.Raw
 	if err != nil {
 		return nil, fmt.Errorf("creating update event: %w", err)
 	}
+	event.version = version
 
 	if err := db.writeEvent(event); err != nil {
 		return nil, fmt.Errorf("writing update event: %w", err)
 	}
-	return payload, nil
+	return event.Payload, nil
+}
+
+// PatchBieter updates some fields of an existing bieter. The patch is read
+// from r as JSON merge patch (RFC 7386). The new payload is returned (on
+// success).
+//
+// The version is checked like in UpdateBieter.
+func (db *Database) PatchBieter(id string, r io.Reader, version int, asAdmin bool) (json.RawMessage, error) {
+	patch, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading body for patch: %w", err)
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	current, exist := db.bieter[id]
+	if !exist {
+		return nil, validationError{msg: fmt.Sprintf("Bieter %q does not exist", id), code: "BIETER_NOT_FOUND"}
+	}
+
+	payload, err := mergePatch(current, patch)
+	if err != nil {
+		return nil, fmt.Errorf("applying patch: %w", err)
+	}
+
+	payload, err = sanitizePayload(payload, db.config.UnknownFields)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := newEventUpdate(id, payload, asAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("creating update event: %w", err)
+	}
+	event.version = version
+
+	if err := db.writeEventLocked(event); err != nil {
+		return nil, fmt.Errorf("writing update event: %w", err)
+	}
+	return event.Payload, nil
 }
 
-// DeleteBieter removes a bieter.
+// DeleteBieter removes a bieter. It can be restored with RestoreBieter.
+//
+// The public can not delete a bieter, that has an offer.
 func (db *Database) DeleteBieter(id string, asAdmin bool) error {
 	event := newEventDelete(id, asAdmin)
 
@@ -238,6 +951,136 @@ func (db *Database) DeleteBieter(id string, asAdmin bool) error {
 	return nil
 }
 
+// RenameBieter gives a bieter a new id. The new id is read from r like
+// {"id":"MUELLER"} and is returned.
+func (db *Database) RenameBieter(id string, r io.Reader) (string, error) {
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding new id: %w", validationError{msg: "Ungültige Daten übergeben"})
+	}
+
+	event, err := newEventRename(id, strings.ToUpper(strings.TrimSpace(body.ID)))
+	if err != nil {
+		return "", fmt.Errorf("creating rename event: %w", err)
+	}
+
+	if err := db.writeEvent(event); err != nil {
+		return "", fmt.Errorf("writing rename event: %w", err)
+	}
+
+	return event.NewID, nil
+}
+
+// MergeBieter merges a duplicate into the bieter id. The duplicate is read
+// from r like {"from":"ABCDEF","fields":["mail"]}. The fields are taken from
+// the duplicate, all other fields are kept. The bieter gets the higher offer
+// and the duplicate is deleted.
+func (db *Database) MergeBieter(id string, r io.Reader) error {
+	var body struct {
+		From   string   `json:"from"`
+		Fields []string `json:"fields"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return fmt.Errorf("decoding merge: %w", validationError{msg: "Ungültige Daten übergeben"})
+	}
+
+	if err := db.writeEvent(newEventMerge(id, body.From, body.Fields)); err != nil {
+		return fmt.Errorf("writing merge event: %w", err)
+	}
+
+	return nil
+}
+
+// RestoreBieter restores a deleted bieter with its payload and offer.
+func (db *Database) RestoreBieter(id string) error {
+	event := newEventRestore(id)
+
+	if err := db.writeEvent(event); err != nil {
+		return fmt.Errorf("writing restore event: %w", err)
+	}
+
+	return nil
+}
+
+// TrashEntry is a deleted bieter, that can be restored or purged.
+type TrashEntry struct {
+	ID        string          `json:"id"`
+	Payload   json.RawMessage `json:"payload"`
+	DeletedAt time.Time       `json:"deleted_at"`
+
+	// DeletedBy is the actor of the delete. It is empty, if the delete event
+	// is not in the store.
+	DeletedBy string `json:"deleted_by,omitempty"`
+}
+
+// Trash returns the deleted bieters sorted by the time of the deletion, the
+// newest first.
+//
+// The actor is not part of the data, so it is read from the events.
+func (db *Database) Trash() ([]TrashEntry, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	entries := make([]TrashEntry, 0, len(db.deleted))
+	byID := make(map[string]int, len(db.deleted))
+	for id, deletedAt := range db.deleted {
+		byID[id] = len(entries)
+		entries = append(entries, TrashEntry{
+			ID:        id,
+			Payload:   cloneRaw(db.bieter[id]),
+			DeletedAt: deletedAt,
+		})
+	}
+
+	lines, err := db.store.events()
+	if err != nil {
+		return nil, fmt.Errorf("reading events: %w", err)
+	}
+
+	for _, line := range lines {
+		event, err := decodeEvent(line)
+		if err != nil {
+			return nil, err
+		}
+
+		var id string
+		switch e := event.(type) {
+		case *eventDelete:
+			id = e.ID
+		case *eventMerge:
+			id = e.From
+		default:
+			continue
+		}
+
+		// A later delete of the same bieter overwrites the actor.
+		if i, ok := byID[id]; ok {
+			entries[i].DeletedBy = event.meta().Actor
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].DeletedAt.Equal(entries[j].DeletedAt) {
+			return entries[i].DeletedAt.After(entries[j].DeletedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// PurgeBieter removes a deleted bieter for ever.
+func (db *Database) PurgeBieter(id string) error {
+	event := newEventPurge(id)
+
+	if err := db.writeEvent(event); err != nil {
+		return fmt.Errorf("writing purge event: %w", err)
+	}
+
+	return nil
+}
+
 // State returns the current state.
 func (db *Database) State() ServiceState {
 	db.RLock()
@@ -246,18 +1089,68 @@ func (db *Database) State() ServiceState {
 	return db.state
 }
 
-// SetState updates the db state.
-func (db *Database) SetState(r io.Reader) error {
+// StateSummary is the state of the db with some derived values for the
+// dashboard.
+type StateSummary struct {
+	State  ServiceState
+	Round  int
+	Bieter int
+	Offers int
+
+	// OffersOpen is true, if the public can set offers at the moment.
+	OffersOpen bool
+
+	// Deadline is the offer deadline from the config. The zero value means,
+	// that there is no deadline.
+	Deadline time.Time
+}
+
+// Summary returns the state with the derived values. All values are read
+// with one lock, so they are consistent.
+func (db *Database) Summary(now time.Time) StateSummary {
+	db.RLock()
+	defer db.RUnlock()
+
+	bieter, offers := db.count()
+	return StateSummary{
+		State:      db.state,
+		Round:      db.round(),
+		Bieter:     bieter,
+		Offers:     offers,
+		OffersOpen: db.state == stateOffer && !db.config.deadlinePassed(now),
+		Deadline:   db.config.OfferDeadline,
+	}
+}
+
+// Banner returns the current banner.
+func (db *Database) Banner() string {
+	db.RLock()
+	defer db.RUnlock()
+
+	return db.banner
+}
+
+// SetBanner sets the banner. An empty string removes it.
+func (db *Database) SetBanner(r io.Reader) error {
 	var decoded struct {
-		State int `json:"state"`
+		Banner string `json:"banner"`
 	}
 	if err := json.NewDecoder(r).Decode(&decoded); err != nil {
-		return fmt.Errorf("decoding state id: %w", err)
+		return fmt.Errorf("decoding banner: %w", validationError{msg: "Ungültige Daten übergeben"})
 	}
 
-	event, err := newEventStatus(ServiceState(decoded.State))
+	if err := db.writeEvent(newEventBanner(decoded.Banner)); err != nil {
+		return fmt.Errorf("writing banner event: %w", err)
+	}
+
+	return nil
+}
+
+// SetState updates the db state.
+func (db *Database) SetState(r io.Reader) error {
+	event, err := decodeStateEvent(r)
 	if err != nil {
-		return fmt.Errorf("create state event: %w", err)
+		return err
 	}
 
 	if err := db.writeEvent(event); err != nil {
@@ -267,17 +1160,94 @@ func (db *Database) SetState(r io.Reader) error {
 	return nil
 }
 
+// CheckState validates the state change from r without writing it. It
+// returns the state, that the db would have after the change.
+func (db *Database) CheckState(r io.Reader) (ServiceState, error) {
+	event, err := decodeStateEvent(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := db.dryRun(event); err != nil {
+		return 0, fmt.Errorf("checking state event: %w", err)
+	}
+
+	return event.NewState, nil
+}
+
+func decodeStateEvent(r io.Reader) (eventServiceState, error) {
+	var decoded struct {
+		State int `json:"state"`
+	}
+	if err := json.NewDecoder(r).Decode(&decoded); err != nil {
+		return eventServiceState{}, fmt.Errorf("decoding state id: %w", err)
+	}
+
+	event, err := newEventStatus(ServiceState(decoded.State))
+	if err != nil {
+		return eventServiceState{}, fmt.Errorf("create state event: %w", err)
+	}
+	return event, nil
+}
+
 // Offer returns the offer form a bieter.
 func (db *Database) Offer(id string) int {
 	db.RLock()
 	defer db.RUnlock()
 
+	if !db.exists(id) {
+		return 0
+	}
 	return db.offer[id]
 }
 
+// Round returns the number of the current bidding round. The first round is
+// 1.
+func (db *Database) Round() int {
+	db.RLock()
+	defer db.RUnlock()
+
+	return db.round()
+}
+
+// round is like Round but has to be called with the lock.
+func (db *Database) round() int {
+	return len(db.rounds) + 1
+}
+
+// previousOffer returns the last offer of a bieter in the previous rounds. In
+// the first round, or if the bieter has not bid before, it returns 0.
+//
+// Has to be called with the lock.
+func (db *Database) previousOffer(id string) int {
+	for i := len(db.rounds) - 1; i >= 0; i-- {
+		if offer, ok := db.rounds[i][id]; ok {
+			return offer
+		}
+	}
+	return 0
+}
+
+// OfferValues returns the offers of all bieters without their ids.
+func (db *Database) OfferValues() []int {
+	db.RLock()
+	defer db.RUnlock()
+
+	offers := make([]int, 0, len(db.offer))
+	for id, offer := range db.offer {
+		if offer > 0 && db.exists(id) {
+			offers = append(offers, offer)
+		}
+	}
+	return offers
+}
+
 // UpdateOffer sets the offer of a bieter.
 //
 // The offer is in cent. So 100 € would be 10_000
+//
+// The public can only set an offer in the offer state before the deadline.
+// Admins can set it at any time.
 func (db *Database) UpdateOffer(id string, r io.Reader, asAdmin bool) error {
 	var offer struct {
 		Offer int `json:"offer"`
@@ -298,11 +1268,138 @@ func (db *Database) UpdateOffer(id string, r io.Reader, asAdmin bool) error {
 	return nil
 }
 
-// ClearOffer creates an event to remove all offers
+// DeleteOffer removes the offer of one bieter.
+func (db *Database) DeleteOffer(id string, asAdmin bool) error {
+	event := newEventOfferDelete(id, asAdmin)
+
+	if err := db.writeEvent(event); err != nil {
+		return fmt.Errorf("writing offer delete event: %w", err)
+	}
+
+	return nil
+}
+
+// OfferRow is one offer of a bulk import.
+type OfferRow struct {
+	ID    string `json:"id"`
+	Offer int    `json:"offer"`
+}
+
+// OfferResult is the result of one row of a bulk import. Error is empty, if
+// the offer was valid. Saved is true, if the offer was written.
+type OfferResult struct {
+	ID    string `json:"id"`
+	Offer int    `json:"offer"`
+	Error string `json:"error,omitempty"`
+	Saved bool   `json:"saved"`
+}
+
+var errOfferImport = validationError{msg: "Mindestens ein Gebot ist ungültig. Es wurde kein Gebot gespeichert", code: "INVALID_OFFERS"}
+
+// errOfferNotSaved is the error of the rows, that were not written, because
+// writing an earlier row failed.
+const errOfferNotSaved = "Das Gebot wurde wegen eines Fehlers nicht gespeichert"
+
+// ImportOffers sets the offers of many bieters as admin.
+//
+// All rows are validated before an offer is saved. If a row is invalid, no
+// offer is saved. With partial, the valid rows are saved anyway.
+//
+// The offers are written one after the other. If writing fails, the offers
+// before stay saved and an error is returned. Saved in the results tells,
+// which rows were written.
+func (db *Database) ImportOffers(rows []OfferRow, partial bool) ([]OfferResult, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	results := make([]OfferResult, len(rows))
+	events := make([]Event, len(rows))
+	valid := 0
+	for i, row := range rows {
+		results[i] = OfferResult{ID: row.ID, Offer: row.Offer}
+
+		event, err := newEventOffer(row.ID, row.Offer, true)
+		if err == nil {
+			err = event.validate(db)
+		}
+
+		if err != nil {
+			results[i].Error = clientMessage(err)
+			continue
+		}
+		events[i] = event
+		valid++
+	}
+
+	if valid < len(rows) && !partial {
+		return results, errOfferImport
+	}
+
+	for i, event := range events {
+		if event == nil {
+			continue
+		}
+
+		if err := db.writeEventLocked(event); err != nil {
+			for j := i; j < len(events); j++ {
+				if events[j] != nil {
+					results[j].Error = errOfferNotSaved
+				}
+			}
+			return results, fmt.Errorf("writing offer event: %w", err)
+		}
+		results[i].Saved = true
+	}
+	return results, nil
+}
+
+// clientMessage returns the message of err for the client. Errors without a
+// message for the client are returned as they are.
+func clientMessage(err error) string {
+	var forClient interface{ forClient() string }
+	if errors.As(err, &forClient) {
+		return forClient.forClient()
+	}
+	return err.Error()
+}
+
+// resetConfirmation has to be send to Reset to prevent accidents.
+const resetConfirmation = "reset"
+
+// Reset removes all bieters and offers and sets the state to registration.
+//
+// The body has to contain the confirmation token, for example
+// {"confirm":"reset"}.
+func (db *Database) Reset(r io.Reader, asAdmin bool) error {
+	if !asAdmin {
+		return validationError{msg: "Not allowed", code: "NOT_ALLOWED"}
+	}
+
+	var body struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return fmt.Errorf("decoding reset: %w", validationError{msg: "Ungültige Daten übergeben"})
+	}
+
+	if body.Confirm != resetConfirmation {
+		return validationError{msg: fmt.Sprintf("Zum Zurücksetzen muss confirm auf %q gesetzt sein", resetConfirmation), code: "CONFIRMATION_REQUIRED"}
+	}
+
+	if err := db.writeEvent(newEventReset()); err != nil {
+		return fmt.Errorf("writing reset event: %w", err)
+	}
+
+	return nil
+}
+
+// ClearOffer creates an event to remove all offers. The offers are archived
+// and the next bidding round starts. In this round, the bieters can only
+// raise their offers.
 func (db *Database) ClearOffer(asAdmin bool) error {
 	if !asAdmin {
 		// TODO: Create other error
-		return validationError{"Not allowed"}
+		return validationError{msg: "Not allowed", code: "NOT_ALLOWED"}
 	}
 
 	event := newEventOfferClear()
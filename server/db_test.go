@@ -1,15 +1,24 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestDatabaseLoad(t *testing.T) {
 	events := `
-	{"type":"update","payload":{"id":"1234","payload":{"name":"hugo","adresse":"haus am wald"}}}
-	{"type":"update","payload":{"id":"4321","payload":{"name":"erik","adresse":"nachbarhaus"}}}
-	{"type":"update","payload":{"id":"1234","payload":{"name":"hugo","adresse":"beim wald"}}}
+	{"type":"update","payload":{"id":"1234","payload":{"name":"hugo","mail":"hugo@example.com","adresse":"haus am wald"}}}
+	{"type":"update","payload":{"id":"4321","payload":{"name":"erik","mail":"erik@example.com","adresse":"nachbarhaus"}}}
+	{"type":"update","payload":{"id":"1234","payload":{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald"}}}
 	`
 
 	db, err := loadDatabase(strings.NewReader(events))
@@ -22,14 +31,575 @@ func TestDatabaseLoad(t *testing.T) {
 	}
 
 	u1 := db.bieter["1234"]
-	expectU1 := `{"name":"hugo","adresse":"beim wald"}`
+	expectU1 := `{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald"}`
 	if string(u1) != expectU1 {
 		t.Errorf("bieter 1234 is %q, expected %q", u1, expectU1)
 	}
 
 	u2 := db.bieter["4321"]
-	expectU2 := `{"name":"erik","adresse":"nachbarhaus"}`
+	expectU2 := `{"name":"erik","mail":"erik@example.com","adresse":"nachbarhaus"}`
 	if string(u2) != expectU2 {
 		t.Errorf("bieter 4321 is %q, expected %q", u2, expectU2)
 	}
 }
+
+func TestDatabasePersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db.jsonl")
+	db, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id1, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	id2, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if _, err := db.UpdateBieter(id1, strings.NewReader(`{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald"}`), 0, true); err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+	if err := db.DeleteBieter(id2, true); err != nil {
+		t.Fatalf("DeleteBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id1, strings.NewReader(`{"offer":5000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	reopened, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+
+	if !reflect.DeepEqual(reopened.bieter, db.bieter) {
+		t.Errorf("got bieter %q, expected %q", reopened.bieter, db.bieter)
+	}
+
+	if !reflect.DeepEqual(reopened.offer, db.offer) {
+		t.Errorf("got offers %v, expected %v", reopened.offer, db.offer)
+	}
+
+	if reopened.state != stateOffer {
+		t.Errorf("got state %s, expected %s", reopened.state, stateOffer)
+	}
+}
+
+func TestDatabaseCorruptLastEvent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db.jsonl")
+	content := `{"type":"update","payload":{"id":"1234","payload":{"name":"hugo","mail":"hugo@example.com"}}}
+{"type":"state","payload":{"state":3}}
+{"type":"offer","payload":{"id":"12`
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("writing db file: %v", err)
+	}
+
+	db, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB with corrupt last event: %v", err)
+	}
+
+	if len(db.bieter) != 1 || db.state != stateOffer {
+		t.Errorf("valid events were not loaded")
+	}
+
+	// The next event has to be readable after a restart.
+	if err := db.UpdateOffer("1234", strings.NewReader(`{"offer":5000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	reopened, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+
+	if got := reopened.Offer("1234"); got != 5000 {
+		t.Errorf("got offer %d, expected 5000", got)
+	}
+}
+
+func TestDatabaseCorruptEventInTheMiddle(t *testing.T) {
+	events := `
+	{"type":"update","payload":{"id":"1234","payload":{"name":"hugo","mail":"hugo@example.com"}}}
+	{"type":"state","payload":{"sta
+	{"type":"state","payload":{"state":3}}
+	`
+
+	if _, err := loadDatabase(strings.NewReader(events)); err == nil {
+		t.Errorf("loadDatabase with corrupt event in the middle did not return an error")
+	}
+}
+
+func TestSecondRound(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db.jsonl")
+	db, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":6000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if err := db.ClearOffer(true); err != nil {
+		t.Fatalf("ClearOffer: %v", err)
+	}
+
+	if got := db.Round(); got != 2 {
+		t.Errorf("got round %d, expected 2", got)
+	}
+
+	if got := db.Offer(id); got != 0 {
+		t.Errorf("got offer %d after clear, expected 0", got)
+	}
+
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), false); err == nil {
+		t.Errorf("lower offer in the second round did not return an error")
+	}
+
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":6000}`), false); err != nil {
+		t.Errorf("equal offer in the second round: %v", err)
+	}
+
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":6500}`), false); err != nil {
+		t.Errorf("higher offer in the second round: %v", err)
+	}
+
+	reopened, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+
+	if got := reopened.Round(); got != 2 {
+		t.Errorf("got round %d after reopening, expected 2", got)
+	}
+
+	if !reflect.DeepEqual(reopened.rounds, []map[string]int{{id: 6000}}) {
+		t.Errorf("got archived rounds %v, expected the offers of the first round", reopened.rounds)
+	}
+}
+
+func TestMaxBieter(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxBieter = 2
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	var ids []string
+	for _, name := range []string{"hugo", "erik"} {
+		id, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), false)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	_, err = db.NewBieter([]byte(`{"name":"anna","mail":"anna@example.com"}`), false)
+	if !errors.Is(err, errFull) {
+		t.Errorf("NewBieter at capacity returned %v, expected %v", err, errFull)
+	}
+
+	if _, err := db.NewBieter([]byte(`{"name":"anna","mail":"anna@example.com"}`), true); err != nil {
+		t.Errorf("NewBieter as admin at capacity: %v", err)
+	}
+
+	// Deleted bieters are not counted.
+	for _, id := range ids {
+		if err := db.DeleteBieter(id, true); err != nil {
+			t.Fatalf("DeleteBieter: %v", err)
+		}
+	}
+
+	if _, err := db.NewBieter([]byte(`{"name":"paul","mail":"paul@example.com"}`), false); err != nil {
+		t.Errorf("NewBieter after deleting: %v", err)
+	}
+}
+
+func TestUndoClearOffer(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	var ids []string
+	for _, name := range []string{"hugo", "erik"} {
+		id, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := db.UpdateOffer(ids[0], strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	if err := db.UpdateOffer(ids[1], strings.NewReader(`{"offer":6000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if err := db.ClearOffer(true); err != nil {
+		t.Fatalf("ClearOffer: %v", err)
+	}
+
+	if _, err := db.Undo(false); err == nil {
+		t.Errorf("Undo as public did not return an error")
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	if db.Offer(ids[0]) != 5000 || db.Offer(ids[1]) != 6000 {
+		t.Errorf("got offers %v after undo, expected the offers before the clear", db.offer)
+	}
+
+	if got := db.Round(); got != 1 {
+		t.Errorf("got round %d after undo, expected 1", got)
+	}
+
+	// Undo the second offer.
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	if _, exist := db.offer[ids[1]]; exist || db.Offer(ids[0]) != 5000 {
+		t.Errorf("got offers %v after second undo, expected only the first offer", db.offer)
+	}
+}
+
+func TestUndoBieterAndState(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if _, err := db.UpdateBieter(id, strings.NewReader(`{"name":"erik","mail":"erik@example.com"}`), 0, true); err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+	if err := db.DeleteBieter(id, true); err != nil {
+		t.Fatalf("DeleteBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo state: %v", err)
+	}
+	if db.State() != stateRegistration {
+		t.Errorf("got state %s, expected %s", db.State(), stateRegistration)
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo delete: %v", err)
+	}
+	if payload, _ := db.Bieter(id); string(payload) != `{"name":"erik","mail":"erik@example.com"}` {
+		t.Errorf("got payload %s after undo delete", payload)
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo update: %v", err)
+	}
+	if payload, _ := db.Bieter(id); string(payload) != `{"name":"hugo","mail":"hugo@example.com"}` {
+		t.Errorf("got payload %s after undo update", payload)
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo create: %v", err)
+	}
+	if _, exist := db.Bieter(id); exist {
+		t.Errorf("bieter exists after undo create")
+	}
+
+	if _, err := db.Undo(true); err == nil {
+		t.Errorf("Undo without events did not return an error")
+	}
+
+	// The undo events are saved.
+	reopened, err := NewDB(db.file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+	if len(reopened.BieterList()) != 0 || reopened.state != stateRegistration {
+		t.Errorf("undo was not persisted")
+	}
+}
+
+func TestFinishedState(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	for _, state := range []string{`{"state":3}`, `{"state":4}`} {
+		if err := db.SetState(strings.NewReader(state)); err != nil {
+			t.Fatalf("SetState %s: %v", state, err)
+		}
+	}
+
+	if got := db.State().String(); got != "4 - Abgeschlossen" {
+		t.Errorf("got state %q", got)
+	}
+
+	if _, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), false); !errors.Is(err, errFinished) {
+		t.Errorf("public create returned %v, expected %v", err, errFinished)
+	}
+	if _, err := db.UpdateBieter(id, strings.NewReader(`{"name":"erik","mail":"erik@example.com"}`), 0, false); !errors.Is(err, errFinished) {
+		t.Errorf("public update returned %v, expected %v", err, errFinished)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), false); !errors.Is(err, errFinished) {
+		t.Errorf("public offer returned %v, expected %v", err, errFinished)
+	}
+	if err := db.DeleteBieter(id, false); !errors.Is(err, errFinished) {
+		t.Errorf("public delete returned %v, expected %v", err, errFinished)
+	}
+
+	if _, err := db.UpdateBieter(id, strings.NewReader(`{"name":"erik","mail":"erik@example.com"}`), 0, true); err != nil {
+		t.Errorf("admin update returned: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Errorf("admin offer returned: %v", err)
+	}
+}
+
+func TestUpdateBieterAbbuchung(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	for _, value := range []abbuchung{abbuchungMonatlich, abbuchungJaehrlich} {
+		payload := fmt.Sprintf(`{"name":"hugo","mail":"hugo@example.com","abbuchung":%d}`, value)
+		if _, err := db.UpdateBieter(id, strings.NewReader(payload), 0, false); err != nil {
+			t.Errorf("update with abbuchung %d: %v", value, err)
+		}
+	}
+
+	_, err = db.UpdateBieter(id, strings.NewReader(`{"name":"hugo","mail":"hugo@example.com","abbuchung":99}`), 0, false)
+	var errValidation validationError
+	if !errors.As(err, &errValidation) {
+		t.Fatalf("update with abbuchung 99: got error %v, expected validationError", err)
+	}
+
+	payload, _ := db.Bieter(id)
+	var data pdfData
+	if err := json.Unmarshal(payload, &data); err != nil {
+		t.Fatalf("decoding bieter: %v", err)
+	}
+
+	if data.Abbuchung != abbuchungJaehrlich {
+		t.Errorf("got abbuchung %d after the rejected update, expected %d", data.Abbuchung, abbuchungJaehrlich)
+	}
+}
+
+func TestCloseBlocksWrites(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true); !errors.Is(err, errDBClosed) {
+		t.Errorf("NewBieter after Close returned %v, expected %v", err, errDBClosed)
+	}
+}
+
+func TestRandomID(t *testing.T) {
+	id := randomID()
+
+	if len(id) != idLength {
+		t.Errorf("got id %q with %d characters, expected %d", id, len(id), idLength)
+	}
+
+	for _, c := range id {
+		if !strings.ContainsRune(idAlphabet, c) {
+			t.Errorf("id %q contains character %q", id, c)
+		}
+	}
+}
+
+func TestUniqueIDCollision(t *testing.T) {
+	db := emptyDatabase()
+	db.bieter["AAAAAA"] = []byte(`{"name":"hugo","mail":"hugo@example.com"}`)
+
+	ids := []string{"AAAAAA", "BBBBBB"}
+	var calls int
+	id := db.uniqueID(func() string {
+		calls++
+		return ids[calls-1]
+	})
+
+	if id != "BBBBBB" {
+		t.Errorf("got id %q, expected BBBBBB", id)
+	}
+
+	if calls != 2 {
+		t.Errorf("id was generated %d times, expected 2", calls)
+	}
+}
+
+func TestBieterTimes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db.jsonl")
+	db, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	created := db.Times(id)
+	if created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("got times %v after create, expected created_at = updated_at", created)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := db.UpdateBieter(id, strings.NewReader(`{"name":"erik","mail":"erik@example.com"}`), 0, false); err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+
+	updated := db.Times(id)
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("created_at changed from %v to %v", created.CreatedAt, updated.CreatedAt)
+	}
+
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("updated_at %v is not after %v", updated.UpdatedAt, created.UpdatedAt)
+	}
+
+	reopened, err := NewDB(file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+
+	if got := reopened.Times(id); !got.CreatedAt.Equal(updated.CreatedAt) || !got.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Errorf("got times %v after reopening, expected %v", got, updated)
+	}
+}
+
+func TestPurgeBieter(t *testing.T) {
+	db := newTestDB(t)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	if err := db.PurgeBieter(id); err == nil {
+		t.Errorf("purging a bieter, that is not deleted, did not return an error")
+	}
+
+	if err := db.DeleteBieter(id, true); err != nil {
+		t.Fatalf("DeleteBieter: %v", err)
+	}
+
+	if err := db.PurgeBieter(id); err != nil {
+		t.Fatalf("PurgeBieter: %v", err)
+	}
+
+	if _, exist := db.bieter[id]; exist {
+		t.Errorf("purged bieter is still in the database")
+	}
+
+	if err := db.RestoreBieter(id); err == nil {
+		t.Errorf("restoring a purged bieter did not return an error")
+	}
+
+	if _, err := db.Undo(true); err == nil {
+		t.Errorf("undo after purge did not return an error")
+	}
+}
+
+func TestFinishAtDeadline(t *testing.T) {
+	config := DefaultConfig()
+	config.OfferDeadline = time.Now().Add(10 * time.Millisecond)
+	config.OfferDeadlineFinish = true
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	db.finishAtDeadline(ctx)
+
+	if state := db.State(); state != stateFinished {
+		t.Errorf("got state %s after the deadline, expected %s", state, stateFinished)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	db := newTestDB(t)
+
+	const workers = 8
+	const rounds = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+				if err != nil {
+					t.Errorf("NewBieter: %v", err)
+					return
+				}
+
+				if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+					t.Errorf("UpdateOffer: %v", err)
+					return
+				}
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				for id, payload := range db.BieterList() {
+					if len(payload) == 0 {
+						t.Errorf("bieter %s has no payload", id)
+					}
+					db.Offer(id)
+					db.Times(id)
+				}
+				db.State()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(db.BieterList()); got != workers*rounds {
+		t.Errorf("got %d bieters, expected %d", got, workers*rounds)
+	}
+}
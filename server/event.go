@@ -3,10 +3,9 @@ package server
 import (
 	"encoding/json"
 	"fmt"
-)
-
-const (
-	lowestOffer = 4000
+	"reflect"
+	"time"
+	"unicode/utf8"
 )
 
 func getEvent(eventType string) Event {
@@ -17,32 +16,114 @@ func getEvent(eventType string) Event {
 	case "delete":
 		return &eventDelete{}
 
+	case "restore":
+		return &eventRestore{}
+
+	case "purge":
+		return &eventPurge{}
+
+	case "rename":
+		return &eventRename{}
+
+	case "merge":
+		return &eventMerge{}
+
 	case "state":
 		return &eventServiceState{}
 
 	case "offer":
 		return &eventOffer{}
 
+	case "offer-delete":
+		return &eventOfferDelete{}
+
 	case "offer-clear":
 		return &eventOfferClear{}
 
+	case "offer-restore":
+		return &eventOfferRestore{}
+
+	case "round-restore":
+		return &eventRoundRestore{}
+
+	case "reset":
+		return &eventReset{}
+
+	case "banner":
+		return &eventBanner{}
+
+	case "data-restore":
+		return &eventDataRestore{}
+
 	default:
 		return nil
 	}
 }
 
+// eventValue returns the event, a pointer from getEvent points to.
+func eventValue(e Event) Event {
+	return reflect.ValueOf(e).Elem().Interface().(Event)
+}
+
 // Event is one change of the database.
 type Event interface {
 	validate(db *Database) error
 	execute(db *Database) error
+
+	// inverse returns an event, that reverts the event. It is called before
+	// the event is executed. Events, that can not be reverted, return nil.
+	inverse(db *Database) (Event, error)
+
+	meta() eventMeta
 	Name() string
+	String() string
+}
+
+const (
+	actorAdmin  = "admin"
+	actorPublic = "public"
+)
+
+// eventMeta is embedded in all events. It saves when and by whom the event was
+// created.
+type eventMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	Actor     string    `json:"actor"`
+}
+
+// flagRestorer is implemented by events with flags, that are not saved. An
+// imported event has to restore them from the saved fields before it is
+// validated.
+type flagRestorer interface {
+	restoreFlags(db *Database)
+}
+
+func newEventMeta(asAdmin bool) eventMeta {
+	actor := actorPublic
+	if asAdmin {
+		actor = actorAdmin
+	}
+
+	return eventMeta{
+		CreatedAt: time.Now(),
+		Actor:     actor,
+	}
+}
+
+func (m eventMeta) meta() eventMeta {
+	return m
 }
 
 type eventUpdate struct {
+	eventMeta
 	ID      string          `json:"id"`
 	Payload json.RawMessage `json:"payload"`
 	create  bool
 	asAdmin bool
+
+	// version is the version of the bieter, the update is based on. 0 means,
+	// that the version is not checked.
+	version int
 }
 
 func newEventCreate(id string, payload json.RawMessage, asAdmin bool) (eventUpdate, error) {
@@ -53,18 +134,19 @@ func newEventCreate(id string, payload json.RawMessage, asAdmin bool) (eventUpda
 
 func newEventUpdate(id string, payload json.RawMessage, asAdmin bool) (eventUpdate, error) {
 	if payload == nil {
-		return eventUpdate{}, validationError{"Keine Daten übergeben"}
+		return eventUpdate{}, validationError{msg: "Keine Daten übergeben"}
 	}
 
 	if !json.Valid(payload) {
-		return eventUpdate{}, validationError{"Ungültige Daten übergeben"}
+		return eventUpdate{}, validationError{msg: "Ungültige Daten übergeben"}
 	}
 
 	e := eventUpdate{
-		ID:      id,
-		Payload: payload,
-		create:  false,
-		asAdmin: asAdmin,
+		eventMeta: newEventMeta(asAdmin),
+		ID:        id,
+		Payload:   normalizePayload(payload),
+		create:    false,
+		asAdmin:   asAdmin,
 	}
 
 	return e, nil
@@ -78,9 +160,29 @@ func (e eventUpdate) Name() string {
 	return "update"
 }
 
+func (e *eventUpdate) restoreFlags(db *Database) {
+	_, exist := db.bieter[e.ID]
+	e.create = !exist
+	e.asAdmin = e.Actor == actorAdmin
+}
+
 func (e eventUpdate) validate(db *Database) error {
+	if !e.asAdmin && db.state == stateFinished {
+		return errFinished
+	}
+
 	if !e.asAdmin && db.state != stateRegistration {
-		return validationError{"invalid state"}
+		return errInvalidState
+	}
+
+	if err := validatePayload(e.Payload, db.config); err != nil {
+		return err
+	}
+
+	if !e.asAdmin && db.config.UniqueMail {
+		if err := validateUniqueMail(db, e.ID, e.Payload); err != nil {
+			return err
+		}
 	}
 
 	_, exist := db.bieter[e.ID]
@@ -88,27 +190,57 @@ func (e eventUpdate) validate(db *Database) error {
 		if exist {
 			return errIDExists
 		}
+
+		if limit := db.config.MaxBieter; !e.asAdmin && limit > 0 && db.activeBieter() >= limit {
+			return errFull
+		}
 		return nil
 	}
 
-	if !exist {
-		return validationError{fmt.Sprintf("Bieter %q does not exist", e.ID)}
+	if !exist || !db.exists(e.ID) {
+		return validationError{msg: fmt.Sprintf("Bieter %q does not exist", e.ID), code: "BIETER_NOT_FOUND"}
+	}
+
+	if e.version != 0 && e.version != db.versions[e.ID] {
+		return errVersionConflict
 	}
 	return nil
 }
 
 func (e eventUpdate) execute(db *Database) error {
+	// The create flag is not saved in the database file. So a new bieter is
+	// detected by its id.
+	times := db.times[e.ID]
+	if _, exist := db.bieter[e.ID]; !exist {
+		times.CreatedAt = e.CreatedAt
+	}
+
 	db.bieter[e.ID] = e.Payload
+	db.versions[e.ID]++
+
+	// Old database files restore a deleted bieter with an update event.
+	delete(db.deleted, e.ID)
+	times.UpdatedAt = e.CreatedAt
+	db.times[e.ID] = times
 	return nil
 }
 
+func (e eventUpdate) inverse(db *Database) (Event, error) {
+	if e.create {
+		return newEventDelete(e.ID, true), nil
+	}
+
+	return newEventUpdate(e.ID, db.bieter[e.ID], true)
+}
+
 type eventDelete struct {
+	eventMeta
 	ID      string `json:"id"`
 	asAdmin bool
 }
 
 func newEventDelete(id string, asAdmin bool) eventDelete {
-	return eventDelete{id, asAdmin}
+	return eventDelete{eventMeta: newEventMeta(asAdmin), ID: id, asAdmin: asAdmin}
 }
 
 func (e eventDelete) String() string {
@@ -119,27 +251,332 @@ func (e eventDelete) Name() string {
 	return "delete"
 }
 
+func (e *eventDelete) restoreFlags(db *Database) {
+	e.asAdmin = e.Actor == actorAdmin
+}
+
 func (e eventDelete) validate(db *Database) error {
+	if !e.asAdmin && db.state == stateFinished {
+		return errFinished
+	}
+
 	if !e.asAdmin && db.state != stateRegistration {
-		return validationError{"invalid state"}
+		return errInvalidState
+	}
+
+	if !db.exists(e.ID) {
+		return validationError{msg: fmt.Sprintf("Bieter %q does not exist", e.ID), code: "BIETER_NOT_FOUND"}
+	}
+
+	// A bieter could skew the round by deleting the registration after
+	// bidding.
+	if !e.asAdmin && db.offer[e.ID] > 0 {
+		return errHasOffer
 	}
 	return nil
 }
 
+// execute marks the bieter as deleted. The payload and the offer are kept, so
+// the bieter can be restored. The offer of a deleted bieter is not counted and
+// is removed with the purge.
 func (e eventDelete) execute(db *Database) error {
+	db.deleted[e.ID] = e.CreatedAt
+	return nil
+}
+
+func (e eventDelete) inverse(db *Database) (Event, error) {
+	return newEventRestore(e.ID), nil
+}
+
+// eventRestore restores a deleted bieter.
+type eventRestore struct {
+	eventMeta
+	ID string `json:"id"`
+}
+
+func newEventRestore(id string) eventRestore {
+	return eventRestore{eventMeta: newEventMeta(true), ID: id}
+}
+
+func (e eventRestore) String() string {
+	return fmt.Sprintf("Restoring bieter %q", e.ID)
+}
+
+func (e eventRestore) Name() string {
+	return "restore"
+}
+
+func (e eventRestore) validate(db *Database) error {
+	if _, deleted := db.deleted[e.ID]; !deleted {
+		return validationError{msg: fmt.Sprintf("Bieter %q ist nicht gelöscht", e.ID), code: "BIETER_NOT_DELETED"}
+	}
+	return nil
+}
+
+func (e eventRestore) execute(db *Database) error {
+	delete(db.deleted, e.ID)
+	return nil
+}
+
+func (e eventRestore) inverse(db *Database) (Event, error) {
+	return newEventDelete(e.ID, true), nil
+}
+
+// eventPurge removes a deleted bieter with its offer. It can not be undone.
+type eventPurge struct {
+	eventMeta
+	ID string `json:"id"`
+}
+
+func newEventPurge(id string) eventPurge {
+	return eventPurge{newEventMeta(true), id}
+}
+
+func (e eventPurge) String() string {
+	return fmt.Sprintf("Purging bieter %q", e.ID)
+}
+
+func (e eventPurge) Name() string {
+	return "purge"
+}
+
+func (e eventPurge) validate(db *Database) error {
+	if _, deleted := db.deleted[e.ID]; !deleted {
+		return validationError{msg: fmt.Sprintf("Bieter %q ist nicht gelöscht", e.ID), code: "BIETER_NOT_DELETED"}
+	}
+	return nil
+}
+
+func (e eventPurge) execute(db *Database) error {
 	delete(db.bieter, e.ID)
+	delete(db.times, e.ID)
+	delete(db.offer, e.ID)
+	delete(db.deleted, e.ID)
+	delete(db.versions, e.ID)
+	return nil
+}
+
+func (e eventPurge) inverse(db *Database) (Event, error) {
+	return nil, nil
+}
+
+// eventRename gives a bieter a new id. The payload, the offers and the
+// history of the bieter are moved to the new id.
+type eventRename struct {
+	eventMeta
+	ID    string `json:"id"`
+	NewID string `json:"new_id"`
+}
+
+// maxIDLength is the maximal length of an id, that is set by an admin.
+const maxIDLength = 32
+
+func newEventRename(id, newID string) (eventRename, error) {
+	if err := checkBieterID(newID); err != nil {
+		return eventRename{}, err
+	}
+	return eventRename{eventMeta: newEventMeta(true), ID: id, NewID: newID}, nil
+}
+
+// checkBieterID returns an error, if the id can not be used in urls and
+// qr codes.
+func checkBieterID(id string) error {
+	if id == "" || len(id) > maxIDLength {
+		return validationError{msg: fmt.Sprintf("Die Bieternummer muss 1 bis %d Zeichen lang sein", maxIDLength), code: "INVALID_ID"}
+	}
+
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return validationError{msg: fmt.Sprintf("Die Bieternummer %q darf nur Großbuchstaben und Ziffern enthalten", id), code: "INVALID_ID"}
+		}
+	}
+	return nil
+}
+
+func (e eventRename) String() string {
+	return fmt.Sprintf("Renaming bieter %q to %q", e.ID, e.NewID)
+}
+
+func (e eventRename) Name() string {
+	return "rename"
+}
+
+func (e eventRename) validate(db *Database) error {
+	if !db.exists(e.ID) {
+		return validationError{msg: fmt.Sprintf("Bieter %q does not exist", e.ID), code: "BIETER_NOT_FOUND"}
+	}
+
+	// Deleted bieters keep their id, so they can be restored.
+	if _, exist := db.bieter[e.NewID]; exist {
+		return errIDExists
+	}
+	return nil
+}
+
+func (e eventRename) execute(db *Database) error {
+	db.bieter[e.NewID] = db.bieter[e.ID]
+	delete(db.bieter, e.ID)
+
+	if times, ok := db.times[e.ID]; ok {
+		db.times[e.NewID] = times
+		delete(db.times, e.ID)
+	}
+
+	if versions, ok := db.versions[e.ID]; ok {
+		db.versions[e.NewID] = versions
+		delete(db.versions, e.ID)
+	}
+
+	if offer, ok := db.offer[e.ID]; ok {
+		db.offer[e.NewID] = offer
+		delete(db.offer, e.ID)
+	}
+
+	for _, round := range db.rounds {
+		if offer, ok := round[e.ID]; ok {
+			round[e.NewID] = offer
+			delete(round, e.ID)
+		}
+	}
 	return nil
 }
 
+func (e eventRename) inverse(db *Database) (Event, error) {
+	return eventRename{eventMeta: newEventMeta(true), ID: e.NewID, NewID: e.ID}, nil
+}
+
+// eventMerge merges the duplicate From into the bieter ID. ID keeps its
+// payload except for the Fields, that are taken from From. ID gets the higher
+// offer and From is deleted with its offer.
+type eventMerge struct {
+	eventMeta
+	ID     string   `json:"id"`
+	From   string   `json:"from"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+func newEventMerge(id, from string, fields []string) eventMerge {
+	return eventMerge{eventMeta: newEventMeta(true), ID: id, From: from, Fields: fields}
+}
+
+func (e eventMerge) String() string {
+	return fmt.Sprintf("Merging bieter %q into %q", e.From, e.ID)
+}
+
+func (e eventMerge) Name() string {
+	return "merge"
+}
+
+func (e eventMerge) validate(db *Database) error {
+	if e.ID == e.From {
+		return validationError{msg: "Ein Bieter kann nicht mit sich selbst zusammengeführt werden", code: "INVALID_MERGE"}
+	}
+
+	for _, id := range []string{e.ID, e.From} {
+		if !db.exists(id) {
+			return validationError{msg: fmt.Sprintf("Bieter %q does not exist", id), code: "BIETER_NOT_FOUND"}
+		}
+	}
+
+	payload, err := e.mergedPayload(db)
+	if err != nil {
+		return err
+	}
+
+	return validatePayload(payload, db.config)
+}
+
+// mergedPayload returns the payload of ID with the fields from From.
+func (e eventMerge) mergedPayload(db *Database) (json.RawMessage, error) {
+	if len(e.Fields) == 0 {
+		return db.bieter[e.ID], nil
+	}
+
+	var target, source map[string]json.RawMessage
+	if err := json.Unmarshal(db.bieter[e.ID], &target); err != nil {
+		return nil, fmt.Errorf("decoding payload of %s: %w", e.ID, err)
+	}
+	if err := json.Unmarshal(db.bieter[e.From], &source); err != nil {
+		return nil, fmt.Errorf("decoding payload of %s: %w", e.From, err)
+	}
+
+	if target == nil {
+		target = make(map[string]json.RawMessage)
+	}
+
+	for _, field := range e.Fields {
+		value, ok := source[field]
+		if !ok {
+			delete(target, field)
+			continue
+		}
+		target[field] = value
+	}
+
+	merged, err := json.Marshal(target)
+	if err != nil {
+		return nil, fmt.Errorf("encoding merged payload: %w", err)
+	}
+	return normalizePayload(merged), nil
+}
+
+func (e eventMerge) execute(db *Database) error {
+	payload, err := e.mergedPayload(db)
+	if err != nil {
+		return err
+	}
+
+	db.bieter[e.ID] = payload
+	db.versions[e.ID]++
+	times := db.times[e.ID]
+	times.UpdatedAt = e.CreatedAt
+	db.times[e.ID] = times
+
+	if offer := db.offer[e.From]; offer > db.offer[e.ID] {
+		db.offer[e.ID] = offer
+	}
+	delete(db.offer, e.From)
+
+	// The offers of the previous rounds are moved, so the round results do
+	// not show the merged bieter.
+	for _, round := range db.rounds {
+		if offer, ok := round[e.From]; ok && offer > round[e.ID] {
+			round[e.ID] = offer
+		}
+		delete(round, e.From)
+	}
+
+	db.deleted[e.From] = e.CreatedAt
+	return nil
+}
+
+func (e eventMerge) inverse(db *Database) (Event, error) {
+	return newEventDataRestore(db), nil
+}
+
 type eventServiceState struct {
+	eventMeta
 	NewState ServiceState `json:"state"`
+
+	// force skips the check of the state transition. It is used to undo a
+	// state change.
+	force bool
 }
 
 func newEventStatus(newState ServiceState) (eventServiceState, error) {
-	if int(newState) < 1 || int(newState) > 3 {
-		return eventServiceState{}, validationError{fmt.Sprintf("Ungültiger State mit nummer %q", newState)}
+	if err := checkStateRange(newState); err != nil {
+		return eventServiceState{}, err
+	}
+	return eventServiceState{eventMeta: newEventMeta(true), NewState: newState}, nil
+}
+
+// checkStateRange returns an error, if the state is not one of the known
+// states.
+func checkStateRange(state ServiceState) error {
+	if state < stateRegistration || state > stateFinished {
+		return validationError{msg: fmt.Sprintf("Ungültiger State mit nummer %d", int(state)), code: "INVALID_STATE"}
 	}
-	return eventServiceState{newState}, nil
+	return nil
 }
 
 func (e eventServiceState) String() string {
@@ -151,25 +588,89 @@ func (e eventServiceState) Name() string {
 }
 
 func (e eventServiceState) validate(db *Database) error {
-	return nil
+	// The event can be decoded from an import without newEventStatus. So
+	// the range is checked again, also for forced changes.
+	if err := checkStateRange(e.NewState); err != nil {
+		return err
+	}
+
+	if e.force || e.NewState == db.state {
+		return nil
+	}
+
+	for _, allowed := range stateTransitions[db.state] {
+		if e.NewState == allowed {
+			return nil
+		}
+	}
+
+	return validationError{msg: fmt.Sprintf("Der Status kann nicht von %q zu %q geändert werden", db.state, e.NewState), code: "INVALID_STATE"}
 }
 
 func (e eventServiceState) execute(db *Database) error {
+	// execute is also called on replay without validate.
+	if err := checkStateRange(e.NewState); err != nil {
+		return err
+	}
+
 	db.state = e.NewState
 	return nil
 }
 
+func (e eventServiceState) inverse(db *Database) (Event, error) {
+	inverse, err := newEventStatus(db.state)
+	inverse.force = true
+	return inverse, err
+}
+
+// maxBannerLength is the maximal number of characters of the banner.
+const maxBannerLength = 500
+
+type eventBanner struct {
+	eventMeta
+	Banner string `json:"banner"`
+}
+
+func newEventBanner(banner string) eventBanner {
+	return eventBanner{newEventMeta(true), banner}
+}
+
+func (e eventBanner) String() string {
+	if e.Banner == "" {
+		return "Remove the banner"
+	}
+	return fmt.Sprintf("Set banner to %q", e.Banner)
+}
+
+func (e eventBanner) Name() string {
+	return "banner"
+}
+
+func (e eventBanner) validate(db *Database) error {
+	if n := utf8.RuneCountInString(e.Banner); n > maxBannerLength {
+		return validationError{msg: fmt.Sprintf("Der Banner darf höchstens %d Zeichen lang sein, nicht %d", maxBannerLength, n), code: "BANNER_TOO_LONG"}
+	}
+	return nil
+}
+
+func (e eventBanner) execute(db *Database) error {
+	db.banner = e.Banner
+	return nil
+}
+
+func (e eventBanner) inverse(db *Database) (Event, error) {
+	return newEventBanner(db.banner), nil
+}
+
 type eventOffer struct {
+	eventMeta
 	ID      string `json:"id"`
 	Offer   int    `json:"offer"`
 	asAdmin bool
 }
 
 func newEventOffer(id string, offer int, asAdmin bool) (eventOffer, error) {
-	if int(offer) < lowestOffer {
-		return eventOffer{}, validationError{fmt.Sprintf("Das Gebot muss mindestens %d sein, nicht %q", lowestOffer, offer)}
-	}
-	return eventOffer{id, offer, asAdmin}, nil
+	return eventOffer{newEventMeta(asAdmin), id, offer, asAdmin}, nil
 }
 
 func (e eventOffer) String() string {
@@ -180,12 +681,37 @@ func (e eventOffer) Name() string {
 	return "offer"
 }
 
+func (e *eventOffer) restoreFlags(db *Database) {
+	e.asAdmin = e.Actor == actorAdmin
+}
+
 func (e eventOffer) validate(db *Database) error {
+	if e.Offer < 0 {
+		return validationError{msg: fmt.Sprintf("Das Gebot darf nicht negativ sein, nicht %s", db.config.Currency.format(e.Offer)), code: "INVALID_OFFER"}
+	}
+
+	if lowest := db.config.lowestOffer(); e.Offer < lowest {
+		return validationError{msg: fmt.Sprintf("Das Gebot muss mindestens %s sein, nicht %s", db.config.Currency.format(lowest), db.config.Currency.format(e.Offer)), code: "OFFER_TOO_LOW"}
+	}
+
+	if previous := db.previousOffer(e.ID); e.Offer < previous {
+		return validationError{msg: fmt.Sprintf("Ab der zweiten Runde kann das Gebot nur erhöht werden. Es muss mindestens %s sein, nicht %s", db.config.Currency.format(previous), db.config.Currency.format(e.Offer)), code: "OFFER_TOO_LOW"}
+	}
+
+	if !e.asAdmin && db.state == stateFinished {
+		return errFinished
+	}
+
 	if !e.asAdmin && db.state != stateOffer {
-		return validationError{"invalid state"}
+		return errInvalidState
 	}
-	if _, exist := db.bieter[e.ID]; !exist {
-		return validationError{fmt.Sprintf("Bieter %q does not exist", e.ID)}
+
+	if !e.asAdmin && db.config.deadlinePassed(time.Now()) {
+		return errDeadline
+	}
+
+	if !db.exists(e.ID) {
+		return validationError{msg: fmt.Sprintf("Bieter %q does not exist", e.ID), code: "BIETER_NOT_FOUND"}
 	}
 	return nil
 }
@@ -195,14 +721,82 @@ func (e eventOffer) execute(db *Database) error {
 	return nil
 }
 
-type eventOfferClear struct{}
+func (e eventOffer) inverse(db *Database) (Event, error) {
+	previous, exist := db.offer[e.ID]
+	if !exist {
+		return newEventOfferDelete(e.ID, true), nil
+	}
+
+	return newEventOffer(e.ID, previous, true)
+}
+
+type eventOfferDelete struct {
+	eventMeta
+	ID      string `json:"id"`
+	asAdmin bool
+}
+
+func newEventOfferDelete(id string, asAdmin bool) eventOfferDelete {
+	return eventOfferDelete{newEventMeta(asAdmin), id, asAdmin}
+}
+
+func (e eventOfferDelete) String() string {
+	return fmt.Sprintf("Delete offer of bieter %q", e.ID)
+}
+
+func (e eventOfferDelete) Name() string {
+	return "offer-delete"
+}
+
+func (e *eventOfferDelete) restoreFlags(db *Database) {
+	e.asAdmin = e.Actor == actorAdmin
+}
+
+func (e eventOfferDelete) validate(db *Database) error {
+	if !e.asAdmin && db.state == stateFinished {
+		return errFinished
+	}
+
+	if !e.asAdmin && db.state != stateOffer {
+		return errInvalidState
+	}
+
+	if !e.asAdmin && db.config.deadlinePassed(time.Now()) {
+		return errDeadline
+	}
+
+	if !db.exists(e.ID) {
+		return validationError{msg: fmt.Sprintf("Bieter %q does not exist", e.ID), code: "BIETER_NOT_FOUND"}
+	}
+	return nil
+}
+
+func (e eventOfferDelete) execute(db *Database) error {
+	delete(db.offer, e.ID)
+	return nil
+}
+
+func (e eventOfferDelete) inverse(db *Database) (Event, error) {
+	previous, exist := db.offer[e.ID]
+	if !exist {
+		return newEventOfferDelete(e.ID, true), nil
+	}
+
+	return newEventOffer(e.ID, previous, true)
+}
+
+// eventOfferClear ends the current bidding round. The offers are archived and
+// the next round starts without offers.
+type eventOfferClear struct {
+	eventMeta
+}
 
 func newEventOfferClear() eventOfferClear {
-	return eventOfferClear{}
+	return eventOfferClear{newEventMeta(true)}
 }
 
 func (e eventOfferClear) String() string {
-	return fmt.Sprintf("Clear all offers")
+	return "Clear all offers and start the next round"
 }
 
 func (e eventOfferClear) Name() string {
@@ -214,12 +808,216 @@ func (e eventOfferClear) validate(db *Database) error {
 }
 
 func (e eventOfferClear) execute(db *Database) error {
+	db.rounds = append(db.rounds, db.offer)
 	db.offer = make(map[string]int)
 	return nil
 }
 
+func (e eventOfferClear) inverse(db *Database) (Event, error) {
+	return newEventRoundRestore(), nil
+}
+
+// eventRoundRestore goes back to the previous bidding round. The archived
+// offers of that round become the current offers again. It is used to undo
+// eventOfferClear.
+type eventRoundRestore struct {
+	eventMeta
+}
+
+func newEventRoundRestore() eventRoundRestore {
+	return eventRoundRestore{newEventMeta(true)}
+}
+
+func (e eventRoundRestore) String() string {
+	return "Go back to the previous round"
+}
+
+func (e eventRoundRestore) Name() string {
+	return "round-restore"
+}
+
+func (e eventRoundRestore) validate(db *Database) error {
+	if len(db.rounds) == 0 {
+		return validationError{msg: "Es gibt keine vorherige Runde", code: "NO_PREVIOUS_ROUND"}
+	}
+	return nil
+}
+
+func (e eventRoundRestore) execute(db *Database) error {
+	if len(db.rounds) == 0 {
+		return fmt.Errorf("there is no previous round")
+	}
+
+	last := len(db.rounds) - 1
+	db.offer = db.rounds[last]
+	db.rounds = db.rounds[:last]
+	return nil
+}
+
+func (e eventRoundRestore) inverse(db *Database) (Event, error) {
+	return newEventOfferClear(), nil
+}
+
+// eventOfferRestore replaces all offers. It is used to undo changes to the
+// offers.
+type eventOfferRestore struct {
+	eventMeta
+	Offers map[string]int `json:"offers"`
+}
+
+func newEventOfferRestore(offers map[string]int) eventOfferRestore {
+	c := make(map[string]int, len(offers))
+	for k, v := range offers {
+		c[k] = v
+	}
+
+	return eventOfferRestore{newEventMeta(true), c}
+}
+
+func (e eventOfferRestore) String() string {
+	return fmt.Sprintf("Restore %d offers", len(e.Offers))
+}
+
+func (e eventOfferRestore) Name() string {
+	return "offer-restore"
+}
+
+func (e eventOfferRestore) validate(db *Database) error {
+	return nil
+}
+
+func (e eventOfferRestore) execute(db *Database) error {
+	db.offer = make(map[string]int, len(e.Offers))
+	for k, v := range e.Offers {
+		db.offer[k] = v
+	}
+	return nil
+}
+
+func (e eventOfferRestore) inverse(db *Database) (Event, error) {
+	return newEventOfferRestore(db.offer), nil
+}
+
+// eventReset removes all bieters and offers and sets the state to
+// registration.
+type eventReset struct {
+	eventMeta
+}
+
+func newEventReset() eventReset {
+	return eventReset{newEventMeta(true)}
+}
+
+func (e eventReset) String() string {
+	return "Reset all data"
+}
+
+func (e eventReset) Name() string {
+	return "reset"
+}
+
+func (e eventReset) validate(db *Database) error {
+	return nil
+}
+
+func (e eventReset) execute(db *Database) error {
+	empty := emptyDatabase()
+	db.bieter = empty.bieter
+	db.times = empty.times
+	db.offer = empty.offer
+	db.state = empty.state
+	db.deleted = empty.deleted
+	db.versions = empty.versions
+	db.rounds = empty.rounds
+	return nil
+}
+
+func (e eventReset) inverse(db *Database) (Event, error) {
+	return newEventDataRestore(db), nil
+}
+
+// eventDataRestore replaces all data. It is used to undo a reset.
+type eventDataRestore struct {
+	eventMeta
+	Bieter   map[string]json.RawMessage `json:"bieter"`
+	Times    map[string]BieterTimes     `json:"times"`
+	Offer    map[string]int             `json:"offer"`
+	State    ServiceState               `json:"state"`
+	Deleted  map[string]time.Time       `json:"deleted"`
+	Versions map[string]int             `json:"versions"`
+	Rounds   []map[string]int           `json:"rounds,omitempty"`
+	Banner   string                     `json:"banner,omitempty"`
+}
+
+func newEventDataRestore(db *Database) eventDataRestore {
+	return eventDataRestore{
+		eventMeta: newEventMeta(true),
+		Bieter:    copyMap(db.bieter),
+		Times:     copyMap(db.times),
+		Offer:     copyMap(db.offer),
+		State:     db.state,
+		Deleted:   copyMap(db.deleted),
+		Versions:  copyMap(db.versions),
+		Rounds:    copyRounds(db.rounds),
+		Banner:    db.banner,
+	}
+}
+
+func (e eventDataRestore) String() string {
+	return fmt.Sprintf("Restore %d bieters and %d offers", len(e.Bieter), len(e.Offer))
+}
+
+func (e eventDataRestore) Name() string {
+	return "data-restore"
+}
+
+func (e eventDataRestore) validate(db *Database) error {
+	return nil
+}
+
+func (e eventDataRestore) execute(db *Database) error {
+	db.bieter = copyMap(e.Bieter)
+	db.times = copyMap(e.Times)
+	db.offer = copyMap(e.Offer)
+	db.state = e.State
+	db.deleted = copyMap(e.Deleted)
+	db.versions = copyMap(e.Versions)
+	db.rounds = copyRounds(e.Rounds)
+	db.banner = e.Banner
+	return nil
+}
+
+func (e eventDataRestore) inverse(db *Database) (Event, error) {
+	return newEventDataRestore(db), nil
+}
+
+// copyMap returns a copy of m. It never returns nil.
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// copyRounds returns a copy of the offers of the previous rounds.
+func copyRounds(rounds []map[string]int) []map[string]int {
+	if len(rounds) == 0 {
+		return nil
+	}
+
+	c := make([]map[string]int, len(rounds))
+	for i, offers := range rounds {
+		c[i] = copyMap(offers)
+	}
+	return c
+}
+
 type validationError struct {
 	msg string
+
+	// code is the error code for the client. Empty means "INVALID_DATA".
+	code string
 }
 
 func (e validationError) Error() string {
@@ -230,4 +1028,23 @@ func (e validationError) forClient() string {
 	return "Ungültige Daten: " + e.msg
 }
 
-var errIDExists = validationError{"Bieter ID existiert bereits"}
+func (e validationError) errorCode() string {
+	if e.code == "" {
+		return "INVALID_DATA"
+	}
+	return e.code
+}
+
+var errIDExists = validationError{msg: "Bieter ID existiert bereits", code: "BIETER_EXISTS"}
+
+var errFull = validationError{msg: "Die Anmeldung ist voll", code: "REGISTRATION_FULL"}
+
+var errFinished = validationError{msg: "Die Bieterrunde ist abgeschlossen", code: "FINISHED"}
+
+var errDeadline = validationError{msg: "Die Frist für Gebote ist abgelaufen", code: "DEADLINE_PASSED"}
+
+var errInvalidState = validationError{msg: "invalid state", code: "INVALID_STATE"}
+
+var errHasOffer = validationError{msg: "Nach der Abgabe eines Gebots kann die Anmeldung nicht mehr gelöscht werden. Bitte wende dich an die Bieterrunde", code: "HAS_OFFER"}
+
+var errVersionConflict = clientError{msg: "Der Bieter wurde in der Zwischenzeit geändert", status: 409, code: "VERSION_CONFLICT"}
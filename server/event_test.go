@@ -0,0 +1,278 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventMeta(t *testing.T) {
+	before := time.Now()
+
+	event, err := newEventOffer("1234", 5000, false)
+	if err != nil {
+		t.Fatalf("newEventOffer: %v", err)
+	}
+
+	meta := event.meta()
+	if meta.CreatedAt.Before(before) || meta.CreatedAt.After(time.Now()) {
+		t.Errorf("got created at %v, expected the current time", meta.CreatedAt)
+	}
+
+	if meta.Actor != actorPublic {
+		t.Errorf("got actor %q, expected %q", meta.Actor, actorPublic)
+	}
+
+	if actor := newEventDelete("1234", true).meta().Actor; actor != actorAdmin {
+		t.Errorf("got actor %q for admin event, expected %q", actor, actorAdmin)
+	}
+}
+
+func TestEventMetaIsPersisted(t *testing.T) {
+	event, err := newEventUpdate("1234", []byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("newEventUpdate: %v", err)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("encoding event: %v", err)
+	}
+
+	line, err := json.Marshal(map[string]json.RawMessage{
+		"type":    []byte(`"` + event.Name() + `"`),
+		"payload": payload,
+	})
+	if err != nil {
+		t.Fatalf("encoding line: %v", err)
+	}
+
+	decoded, err := decodeEvent(line)
+	if err != nil {
+		t.Fatalf("decodeEvent: %v", err)
+	}
+
+	got := decoded.meta()
+	if !got.CreatedAt.Equal(event.CreatedAt) {
+		t.Errorf("got created at %v, expected %v", got.CreatedAt, event.CreatedAt)
+	}
+
+	if got.Actor != actorAdmin {
+		t.Errorf("got actor %q, expected %q", got.Actor, actorAdmin)
+	}
+}
+
+func TestStateTransition(t *testing.T) {
+	db := emptyDatabase()
+
+	for _, tt := range []struct {
+		from  ServiceState
+		to    ServiceState
+		legal bool
+	}{
+		{stateRegistration, stateValidation, true},
+		{stateValidation, stateOffer, true},
+		{stateRegistration, stateOffer, true},
+		{stateOffer, stateRegistration, true},
+		{stateOffer, stateOffer, true},
+		{stateOffer, stateValidation, false},
+	} {
+		db.state = tt.from
+		event, err := newEventStatus(tt.to)
+		if err != nil {
+			t.Fatalf("newEventStatus: %v", err)
+		}
+
+		err = event.validate(db)
+		if tt.legal && err != nil {
+			t.Errorf("transition from %s to %s returned: %v", tt.from, tt.to, err)
+		}
+
+		if !tt.legal {
+			var errValidation validationError
+			if !errors.As(err, &errValidation) {
+				t.Errorf("transition from %s to %s returned %v, expected a validationError", tt.from, tt.to, err)
+			}
+		}
+	}
+}
+
+func TestOfferTooLowMessage(t *testing.T) {
+	db := emptyDatabase()
+	db.config = DefaultConfig()
+	db.state = stateOffer
+	db.bieter["ABC"] = []byte(`{"name":"hugo","mail":"hugo@example.com"}`)
+
+	event, err := newEventOffer("ABC", 3000, false)
+	if err != nil {
+		t.Fatalf("newEventOffer: %v", err)
+	}
+
+	err = event.validate(db)
+	expect := "Das Gebot muss mindestens 40,00 € sein, nicht 30,00 €"
+	if err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+}
+
+func TestNegativeOfferMessage(t *testing.T) {
+	db := emptyDatabase()
+	db.config = DefaultConfig()
+	db.config.Currency = Currency{Symbol: "$", DecimalSeparator: ".", ThousandsSeparator: ",", SymbolFirst: true}
+	db.state = stateOffer
+	db.bieter["ABC"] = []byte(`{"name":"hugo","mail":"hugo@example.com"}`)
+
+	event, err := newEventOffer("ABC", -3000, false)
+	if err != nil {
+		t.Fatalf("newEventOffer: %v", err)
+	}
+
+	err = event.validate(db)
+	expect := "Das Gebot darf nicht negativ sein, nicht -$30.00"
+	if err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+}
+
+func TestStateOutOfRange(t *testing.T) {
+	db := emptyDatabase()
+
+	for _, tt := range []struct {
+		event  eventServiceState
+		expect string
+	}{
+		{eventServiceState{NewState: 99}, "Ungültiger State mit nummer 99"},
+		{eventServiceState{NewState: 99, force: true}, "Ungültiger State mit nummer 99"},
+		{eventServiceState{NewState: 0}, "Ungültiger State mit nummer 0"},
+	} {
+		err := tt.event.validate(db)
+
+		var errValidation validationError
+		if !errors.As(err, &errValidation) {
+			t.Errorf("validate of state %d (force %t) returned %v, expected a validationError", int(tt.event.NewState), tt.event.force, err)
+			continue
+		}
+
+		if errValidation.msg != tt.expect {
+			t.Errorf("got message %q, expected %q", errValidation.msg, tt.expect)
+		}
+	}
+}
+
+func TestReplayStateOutOfRange(t *testing.T) {
+	events := `{"type":"state","payload":{"state":99}}` + "\n"
+
+	if _, err := loadDatabase(strings.NewReader(events)); err == nil {
+		t.Errorf("loadDatabase with state 99 did not return an error")
+	}
+
+	if got := ServiceState(99).String(); got != "99 - Ungültig" {
+		t.Errorf("got %q for state 99, expected \"99 - Ungültig\"", got)
+	}
+}
+
+func TestStateTransitionUndo(t *testing.T) {
+	db := emptyDatabase()
+	db.state = stateValidation
+
+	event, err := newEventStatus(stateOffer)
+	if err != nil {
+		t.Fatalf("newEventStatus: %v", err)
+	}
+
+	inverse, err := event.inverse(db)
+	if err != nil {
+		t.Fatalf("inverse: %v", err)
+	}
+
+	if err := event.execute(db); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	// offer to validation is not allowed, but undo has to work.
+	if err := inverse.validate(db); err != nil {
+		t.Errorf("validate inverse state event: %v", err)
+	}
+}
+
+func TestOfferDeadline(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		deadline time.Time
+		asAdmin  bool
+		allowed  bool
+	}{
+		{"no deadline", time.Time{}, false, true},
+		{"future", time.Now().Add(time.Hour), false, true},
+		{"past", time.Now().Add(-time.Hour), false, false},
+		{"past as admin", time.Now().Add(-time.Hour), true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := emptyDatabase()
+			db.state = stateOffer
+			db.config.OfferDeadline = tt.deadline
+			db.bieter["1234"] = []byte(`{"name":"hugo","mail":"hugo@example.com"}`)
+
+			event, err := newEventOffer("1234", 5000, tt.asAdmin)
+			if err != nil {
+				t.Fatalf("newEventOffer: %v", err)
+			}
+
+			err = event.validate(db)
+			if tt.allowed && err != nil {
+				t.Errorf("validate returned: %v", err)
+			}
+
+			if !tt.allowed && !errors.Is(err, errDeadline) {
+				t.Errorf("validate returned %v, expected %v", err, errDeadline)
+			}
+		})
+	}
+}
+
+func TestOfferSecondRound(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		offer   int
+		allowed bool
+	}{
+		{"lower", 5500, false},
+		{"equal", 6000, true},
+		{"higher", 7000, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := emptyDatabase()
+			db.config.LowestOffer = 4000
+			db.state = stateOffer
+			db.bieter["1234"] = []byte(`{"name":"hugo","mail":"hugo@example.com"}`)
+			db.offer["1234"] = 6000
+
+			if err := newEventOfferClear().execute(db); err != nil {
+				t.Fatalf("clearing offers: %v", err)
+			}
+
+			if db.round() != 2 {
+				t.Fatalf("got round %d, expected 2", db.round())
+			}
+
+			event, err := newEventOffer("1234", tt.offer, false)
+			if err != nil {
+				t.Fatalf("newEventOffer: %v", err)
+			}
+
+			err = event.validate(db)
+			if tt.allowed && err != nil {
+				t.Errorf("validate returned: %v", err)
+			}
+
+			if !tt.allowed {
+				var errValidation validationError
+				if !errors.As(err, &errValidation) {
+					t.Errorf("validate returned %v, expected a validationError", err)
+				}
+			}
+		})
+	}
+}
@@ -1,47 +1,151 @@
 package server
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	_ "embed"
 	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 const (
 	pathPrefixAPI    = "/api"
+	pathPrefixAPIv1  = pathPrefixAPI + "/v1"
 	pathPrefixStatic = "/static"
 )
 
 func registerHandlers(router *mux.Router, config Config, db *Database, defaultFiles DefaultFiles) {
-	fileSystem := MultiFS{
-		fs: []fs.FS{
-			os.DirFS("./static"),
-			defaultFiles.Static,
-		},
-	}
+	fileSystem := staticFS(defaultFiles, config.StaticSources)
 
-	router.Use(loggingMiddleware)
+	router.Use(tracingMiddleware)
+	router.Use(requestIDMiddleware)
+	router.Use(loggingMiddleware(slog.Default()))
+	router.Use(gzipMiddleware)
 
-	handleElmJS(router, defaultFiles.Elm)
+	handleHealth(router, true)
+
+	handleElmJS(router, defaultFiles.Elm, config.StaticMaxAge)
 	handleIndex(router, defaultFiles.Index)
 
-	handleBieter(router, db, config, fileSystem)
-	handleBieterCreate(router, db, config)
+	// Both api versions share the limit, so it can not be doubled by using
+	// the other prefix.
+	createLimit := newRateLimiter(config.CreateRateLimit, time.Minute)
+
+	// The api is served under /api/v1 and for old clients under /api.
+	apiV1 := mux.NewRouter()
+	registerAPIHandlers(apiV1, config, db, fileSystem, createLimit)
+	handleAPIPrefix(router, pathPrefixAPIv1, apiV1)
+	registerAPIHandlers(router, config, db, fileSystem, createLimit)
+
+	handleProfiling(router, config)
+	handleStatic(router, fileSystem, config.StaticMaxAge)
+}
+
+// registerAPIHandlers registers the handlers, that use the database.
+//
+// createLimit limits the public registrations. It can be nil.
+func registerAPIHandlers(router *mux.Router, config Config, db *Database, fileSystem fs.FS, createLimit *rateLimiter) {
+	router.Use(languageMiddleware)
+	router.Use(maintenanceMiddleware(db))
+	router.Use(adminAllowlistMiddleware(config.adminNetworks, config.proxyNetworks))
+
+	// All other paths are handled by handleIndex. So only unknown api
+	// routes reach the NotFoundHandler.
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleError(w, clientError{msg: "Unbekannter API-Pfad", status: 404, code: "UNKNOWN_PATH"})
+	})
+
+	mail := newMailer(config.SMTP)
+
+	// The count and the trash have to be registered before /bieter/{id}.
+	handleBieterCount(router, db, config)
+	handleBieterTrash(router, db, config)
+	handleBieterLookup(router, db, config, mail)
+	handleBieter(router, db, config, fileSystem, mail)
+	handleBieterCreate(router, db, config, mail, createLimit)
+	handleBieterRestore(router, db, config)
+	handleBieterRename(router, db, config)
+	handleBieterMerge(router, db, config)
+	handleBieterPurge(router, db, config)
 	handleBieterList(router, db, config)
+	handleBieterCSV(router, db, config)
+	handleBieterZIP(router, db, config, fileSystem)
 
+	handleVerteilstellen(router, config)
+	handleAbbuchungOptions(router, config)
+	handleStats(router, db, config)
+	handleResults(router, db, config)
+	handleResultsPDF(router, db, config, fileSystem)
 	handleState(router, db, config)
+	// The histogram has to be registered before /offer/{id}.
+	handleOfferHistogram(router, db, config)
 	handleSetOffer(router, db, config)
+	handleImportOffers(router, db, config)
+	handleDeleteOffer(router, db, config)
 	handleClearOffer(router, db, config)
+	handleEventStream(router, db)
+	handleAudit(router, db, config)
+	handleEventExport(router, db, config)
+	handleEventImport(router, db, config)
+	handleUndo(router, db, config)
+	handleReset(router, db, config)
+	handleBackup(router, db, config)
+	handleRestoreBackup(router, db, config)
+	handleMaintenance(router, db, config)
+	handleBanner(router, db, config)
+	handleOpenAPI(router, config.StaticMaxAge)
+}
+
+// handleAPIPrefix passes all requests below prefix to handler as if they were
+// send to /api. For example /api/v1/bieter is passed as /api/bieter.
+func handleAPIPrefix(router *mux.Router, prefix string, handler http.Handler) {
+	router.PathPrefix(prefix + "/").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = pathPrefixAPI + strings.TrimPrefix(r.URL.Path, prefix)
+		r2.URL.RawPath = ""
+		handler.ServeHTTP(w, r2)
+	}))
+}
+
+// staticEmbedded is the name of the embedded static files in
+// Config.StaticSources.
+const staticEmbedded = "embedded"
 
-	handleStatic(router, fileSystem)
+// staticFS returns the file system with the static files. The sources are
+// directories or staticEmbedded for the default files. A file from an
+// earlier source overwrites the files from the later ones.
+func staticFS(defaultFiles DefaultFiles, sources []string) fs.FS {
+	var multi MultiFS
+	for _, source := range sources {
+		if source == staticEmbedded {
+			multi.fs = append(multi.fs, defaultFiles.Static)
+			continue
+		}
+		multi.fs = append(multi.fs, os.DirFS(source))
+	}
+	return multi
 }
 
 // ViewBieter is the bieter data returned to the client
@@ -49,24 +153,28 @@ type ViewBieter struct {
 	ID      string          `json:"id"`
 	Payload json.RawMessage `json:"payload"`
 	Offer   int             `json:"offer"`
+	Version int             `json:"version"`
+	BieterTimes
 }
 
 // handleIndex returns the index.html. It is returned from all urls exept /api
 // and /static.
 //
 // If the file exists in client/index.html, it is used. In other case the default index.html, is used.
+//
+// The response has a Last-Modified header, so the browser can ask with
+// If-Modified-Since, if the file has changed.
 func handleIndex(router *mux.Router, defaultContent []byte) {
+	file := newCachedFile("client/index.html", defaultContent)
+
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		bs, err := os.ReadFile("client/index.html")
+		bs, modTime, _, err := file.get()
 		if err != nil {
-			if !errors.Is(err, os.ErrNotExist) {
-				log.Println(err)
-				http.Error(w, "Internal", 500)
-				return
-			}
-			bs = defaultContent
+			log.Println(err)
+			http.Error(w, "Internal", 500)
+			return
 		}
-		w.Write(bs)
+		http.ServeContent(w, r, "index.html", modTime, bytes.NewReader(bs))
 	}
 
 	router.MatcherFunc(func(r *http.Request, m *mux.RouteMatch) bool {
@@ -79,32 +187,54 @@ func handleIndex(router *mux.Router, defaultContent []byte) {
 //
 // If the file exists in client/elm.js, it is used. In other case the default
 // file, bundeled with the executable is used.
-func handleElmJS(router *mux.Router, defaultContent []byte) {
+func handleElmJS(router *mux.Router, defaultContent []byte, maxAge int) {
+	file := newCachedFile("client/elm.js", defaultContent)
+
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		bs, err := os.ReadFile("client/elm.js")
+		bs, modTime, etag, err := file.get()
 		if err != nil {
-			if !errors.Is(err, os.ErrNotExist) {
-				log.Println(err)
-				http.Error(w, "Internal", 500)
-				return
-			}
-			bs = defaultContent
+			log.Println(err)
+			http.Error(w, "Internal", 500)
+			return
 		}
-		w.Write(bs)
+
+		setCacheHeaders(w, etag, maxAge)
+		http.ServeContent(w, r, "elm.js", modTime, bytes.NewReader(bs))
 	}
 	router.Path("/elm.js").HandlerFunc(handler)
 }
 
+// handleHealth handles the health checks for the load balancer.
+//
+// /healthz returns 200, when the server is running. /readyz returns 503,
+// until the database is loaded.
+func handleHealth(router *mux.Router, ready bool) {
+	router.Path(pathPrefixAPI + "/healthz").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}` + "\n"))
+	})
+
+	router.Path(pathPrefixAPI + "/readyz").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(503)
+			w.Write([]byte(`{"status":"loading"}` + "\n"))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}` + "\n"))
+	})
+}
+
 // handleBieter handles request to /bieter/id. Get returns the bieter, put
-// updates it and delete deletes it
-func handleBieter(router *mux.Router, db *Database, config Config, filesystem fs.FS) {
+// updates it, patch updates some fields and delete deletes it
+func handleBieter(router *mux.Router, db *Database, config Config, filesystem fs.FS, mail *mailer) {
 	path := pathPrefixAPI + "/bieter/{id}"
 
 	router.Path(path).Methods("DELETE").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		bieterID := mux.Vars(r)["id"]
 		_, exist := db.Bieter(bieterID)
 		if !exist {
-			handleError(w, clientError{msg: "Bieter existiert nicht", status: 404})
+			handleError(w, errBieterNotFound)
 			return
 		}
 
@@ -117,14 +247,26 @@ func handleBieter(router *mux.Router, db *Database, config Config, filesystem fs
 		bieterID := mux.Vars(r)["id"]
 		payload, exist := db.Bieter(bieterID)
 		if !exist {
-			handleError(w, clientError{msg: "Bieter existiert nicht", status: 404})
+			handleError(w, errBieterNotFound)
 			return
 		}
 
 		offer := db.Offer(bieterID)
 
 		if r.Method == "PUT" {
-			p, err := db.UpdateBieter(bieterID, r.Body, isAdmin(r, config))
+			if err := checkContentType(r); err != nil {
+				handleError(w, err)
+				return
+			}
+
+			version, err := ifMatchVersion(r)
+			if err != nil {
+				handleError(w, err)
+				return
+			}
+
+			limitBody(w, r, config)
+			p, err := db.UpdateBieter(bieterID, r.Body, version, isAdmin(r, config))
 			if err != nil {
 				handleError(w, fmt.Errorf("update bieter: %w", err))
 				return
@@ -136,6 +278,47 @@ func handleBieter(router *mux.Router, db *Database, config Config, filesystem fs
 			bieterID,
 			payload,
 			offer,
+			db.Version(bieterID),
+			db.Times(bieterID),
+		}
+
+		if err := json.NewEncoder(w).Encode(bieter); err != nil {
+			handleError(w, fmt.Errorf("encoding bieter: %w", err))
+			return
+		}
+	})
+
+	router.Path(path).Methods("PATCH").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bieterID := mux.Vars(r)["id"]
+		if _, exist := db.Bieter(bieterID); !exist {
+			handleError(w, errBieterNotFound)
+			return
+		}
+
+		if err := checkContentType(r, "application/merge-patch+json"); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		limitBody(w, r, config)
+		payload, err := db.PatchBieter(bieterID, r.Body, version, isAdmin(r, config))
+		if err != nil {
+			handleError(w, fmt.Errorf("patch bieter: %w", err))
+			return
+		}
+
+		bieter := ViewBieter{
+			bieterID,
+			payload,
+			db.Offer(bieterID),
+			db.Version(bieterID),
+			db.Times(bieterID),
 		}
 
 		if err := json.NewEncoder(w).Encode(bieter); err != nil {
@@ -148,56 +331,282 @@ func handleBieter(router *mux.Router, db *Database, config Config, filesystem fs
 		bieterID := mux.Vars(r)["id"]
 		payload, exist := db.Bieter(bieterID)
 		if !exist {
-			handleError(w, clientError{msg: "Bieter existiert nicht", status: 404})
+			handleError(w, errBieterNotFound)
 			return
 		}
 
-		f, err := filesystem.Open("static/images/pdf_header_image.png")
+		pdfile, err := bieterContract(r.Context(), db, config, filesystem, bieterID, payload)
 		if err != nil {
-			handleError(w, fmt.Errorf("open header image: %w", err))
+			handleError(w, err)
 			return
 		}
-		imgBytes, err := io.ReadAll(f)
-		if err != nil {
-			handleError(w, fmt.Errorf("reading header image: %w", err))
+		io.Copy(w, pdfile)
+	})
+
+	router.Path(path + "/preview").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bieterID := mux.Vars(r)["id"]
+		payload, exist := db.Bieter(bieterID)
+		if !exist {
+			handleError(w, errBieterNotFound)
 			return
 		}
 
-		headerImage := base64.StdEncoding.EncodeToString(imgBytes)
 		var data pdfData
 		if err := json.Unmarshal(payload, &data); err != nil {
 			handleError(w, fmt.Errorf("decode bieter data: %w", err))
 			return
 		}
 
-		pdfile, err := Bietervertrag(config.Domain, bieterID, headerImage, data)
+		tmpl, err := loadContractTemplate(config.ContractTemplate, config.Currency)
 		if err != nil {
-			handleError(w, fmt.Errorf("creating pdf: %w", err))
+			handleError(w, fmt.Errorf("loading contract template: %w", err))
 			return
 		}
-		io.Copy(w, pdfile)
+
+		page, err := ContractPreview(tmpl, contractData{
+			ID:     bieterID,
+			Bieter: data,
+			Config: config,
+			Offer:  db.Offer(bieterID),
+		})
+		if err != nil {
+			handleError(w, fmt.Errorf("creating preview: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.Copy(w, page)
+	})
+
+	// The bieter id is the only authentication of a bieter. So everyone, who
+	// knows the id, can send the pdf. But it is only sent to the mail address
+	// of the bieter.
+	router.Path(path + "/email-pdf").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mail == nil {
+			handleError(w, clientError{msg: "Es ist kein Mailserver eingerichtet", status: 503, code: "MAIL_DISABLED"})
+			return
+		}
+
+		bieterID := mux.Vars(r)["id"]
+		payload, exist := db.Bieter(bieterID)
+		if !exist {
+			handleError(w, errBieterNotFound)
+			return
+		}
+
+		msg, ok := contractMail(bieterID, payload, config)
+		if !ok {
+			handleError(w, validationError{msg: "Der Bieter hat keine E-Mail-Adresse", code: "NO_MAIL_ADDRESS"})
+			return
+		}
+
+		pdfile, err := bieterContract(r.Context(), db, config, filesystem, bieterID, payload)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		msg.Attachments = []mailAttachment{{
+			Name:        fmt.Sprintf("bietervertrag-%s.pdf", bieterID),
+			ContentType: "application/pdf",
+			Content:     pdfile.Bytes(),
+		}}
+
+		if err := mail.send(msg); err != nil {
+			handleError(w, fmt.Errorf("sending pdf: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sent":true}` + "\n"))
+	})
+
+	router.Path(path + "/qr.png").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bieterID := mux.Vars(r)["id"]
+		if _, exist := db.Bieter(bieterID); !exist {
+			handleError(w, errBieterNotFound)
+			return
+		}
+
+		image, err := qrCodePNG(bieterURL(config.domain(), bieterID), qrCodeSize)
+		if err != nil {
+			handleError(w, fmt.Errorf("creating qr code: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		setCacheHeaders(w, contentETag(image), config.StaticMaxAge)
+		http.ServeContent(w, r, "qr.png", time.Time{}, bytes.NewReader(image))
+	})
+}
+
+// bieterContract returns the bietervertrag of a bieter as pdf.
+func bieterContract(ctx context.Context, db *Database, config Config, filesystem fs.FS, bieterID string, payload json.RawMessage) (*bytes.Buffer, error) {
+	headerImage := loadHeaderImage(filesystem, config.HeaderImage)
+
+	var data pdfData
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("decode bieter data: %w", err)
+	}
+
+	tmpl, err := loadContractTemplate(config.ContractTemplate, config.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("loading contract template: %w", err)
+	}
+
+	pdfile, err := Bietervertrag(ctx, tmpl, headerImage, contractData{
+		ID:     bieterID,
+		Bieter: data,
+		Config: config,
+		Offer:  db.Offer(bieterID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating pdf: %w", err)
+	}
+	return pdfile, nil
+}
+
+// qrCodeSize is the size of the qr code image in pixels.
+const qrCodeSize = 256
+
+// handleBieterZIP returns the bietervertrag of all bieters in one zip file.
+func handleBieterZIP(router *mux.Router, db *Database, config Config, filesystem fs.FS) {
+	router.Path(pathPrefixAPI + "/bieter.zip").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		headerImage := loadHeaderImage(filesystem, config.HeaderImage)
+
+		tmpl, err := loadContractTemplate(config.ContractTemplate, config.Currency)
+		if err != nil {
+			handleError(w, fmt.Errorf("loading contract template: %w", err))
+			return
+		}
+
+		bieterList := db.BieterList()
+		ids := make([]string, 0, len(bieterList))
+		for id := range bieterList {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="bietervertrag.zip"`)
+
+		zw := zip.NewWriter(w)
+		for _, id := range ids {
+			var data pdfData
+			if err := json.Unmarshal(bieterList[id], &data); err != nil {
+				log.Printf("Error: decode bieter %q for zip: %v", id, err)
+				continue
+			}
+
+			pdfile, err := Bietervertrag(r.Context(), tmpl, headerImage, contractData{
+				ID:     id,
+				Bieter: data,
+				Config: config,
+				Offer:  db.Offer(id),
+			})
+			if err != nil {
+				log.Printf("Error: creating pdf for bieter %q: %v", id, err)
+				continue
+			}
+
+			f, err := zw.Create(fmt.Sprintf("bietervertrag-%s.pdf", id))
+			if err != nil {
+				log.Printf("Error: creating zip entry for bieter %q: %v", id, err)
+				return
+			}
+
+			if _, err := io.Copy(f, pdfile); err != nil {
+				log.Printf("Error: writing zip entry for bieter %q: %v", id, err)
+				return
+			}
+		}
+
+		if err := zw.Close(); err != nil {
+			log.Printf("Error: closing zip: %v", err)
+		}
 	})
 }
 
-func handleBieterCreate(router *mux.Router, db *Database, config Config) {
+// loadHeaderImage returns the header image of the pdf as base64 string.
+//
+// The image is only decoration. If it can not be read, a warning is logged
+// and an empty string is returned. The pdf is then created without it.
+func loadHeaderImage(filesystem fs.FS, name string) string {
+	f, err := filesystem.Open(name)
+	if err != nil {
+		log.Printf("Warning: can not open header image %q: %v. Creating pdf without it.", name, err)
+		return ""
+	}
+	defer f.Close()
+
+	imgBytes, err := io.ReadAll(f)
+	if err != nil {
+		log.Printf("Warning: can not read header image %q: %v. Creating pdf without it.", name, err)
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(imgBytes)
+}
+
+// handleBieterCreate creates a new bieter.
+//
+// If a smtp server is configured, the bieter gets a mail with the id. Public
+// requests are checked by the rate limit and the honeypot field.
+func handleBieterCreate(router *mux.Router, db *Database, config Config, mail *mailer, limit *rateLimiter) {
 	router.Path(pathPrefixAPI + "/bieter").Methods("POST").HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
+			if err := checkContentType(r); err != nil {
+				handleError(w, err)
+				return
+			}
+
+			admin := isAdmin(r, config)
+			if !admin && !limit.allow(clientIP(r), time.Now()) {
+				w.Header().Set("Retry-After", "60")
+				handleError(w, errRateLimit)
+				return
+			}
+
+			limitBody(w, r, config)
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
 				handleError(w, fmt.Errorf("reading body for create: %w", err))
 				return
 			}
 
-			bieterID, err := db.NewBieter(body, isAdmin(r, config))
+			if !admin {
+				body, err = checkHoneypot(body, config.Honeypot)
+				if err != nil {
+					handleError(w, err)
+					return
+				}
+			}
+
+			bieterID, err := db.NewBieter(body, admin)
 			if err != nil {
 				handleError(w, fmt.Errorf("creating new bieter: %w", err))
 				return
 			}
 
+			// The saved payload can differ from the body, for example by a
+			// normalized IBAN.
+			payload, _ := db.Bieter(bieterID)
+
+			if msg, ok := confirmationMail(bieterID, payload, config); ok {
+				mail.sendAsync(msg)
+			}
+
 			bieter := ViewBieter{
 				bieterID,
-				body,
+				payload,
 				0,
+				db.Version(bieterID),
+				db.Times(bieterID),
 			}
 
 			if err := json.NewEncoder(w).Encode(bieter); err != nil {
@@ -208,102 +617,1141 @@ func handleBieterCreate(router *mux.Router, db *Database, config Config) {
 	)
 }
 
-func handleBieterList(router *mux.Router, db *Database, config Config) {
-	if config.AdminPW == "" {
-		return
-	}
-
-	router.Path(pathPrefixAPI + "/bieter").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		admin := isAdmin(r, config)
-		if !admin {
+// handleBieterRename gives a bieter a new id. It returns the bieter with the
+// new id.
+func handleBieterRename(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter/{id}/rename").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
 			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
 			return
 		}
 
-		var bieter []ViewBieter
+		if err := checkContentType(r); err != nil {
+			handleError(w, err)
+			return
+		}
 
-		for id, payload := range db.BieterList() {
-			bieter = append(bieter, ViewBieter{
-				ID:      id,
-				Payload: payload,
-				Offer:   db.Offer(id), // TODO: This has to be returned from db.BieterList!
-			})
+		limitBody(w, r, config)
+		newID, err := db.RenameBieter(mux.Vars(r)["id"], r.Body)
+		if err != nil {
+			handleError(w, fmt.Errorf("rename bieter: %w", err))
+			return
+		}
 
+		payload, _ := db.Bieter(newID)
+		bieter := ViewBieter{
+			newID,
+			payload,
+			db.Offer(newID),
+			db.Version(newID),
+			db.Times(newID),
 		}
 
 		if err := json.NewEncoder(w).Encode(bieter); err != nil {
 			handleError(w, fmt.Errorf("encoding bieter: %w", err))
+			return
 		}
 	})
 }
 
-// handleState gets or sets the service status.
-func handleState(router *mux.Router, db *Database, config Config) {
-	router.Path(pathPrefixAPI+"/state").Methods("GET", "PUT").
-		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == "PUT" {
-				if !isAdmin(r, config) {
-					handleError(w, clientError{msg: "not allowed", status: 403})
-					return
-				}
+// handleBieterMerge merges a duplicate into the bieter. It returns the merged
+// bieter.
+func handleBieterMerge(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter/{id}/merge").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
 
-				if err := db.SetState(r.Body); err != nil {
-					handleError(w, fmt.Errorf("set state: %w", err))
-					return
-				}
-			}
+		if err := checkContentType(r); err != nil {
+			handleError(w, err)
+			return
+		}
 
-			s := db.State()
-			response := struct {
-				State int    `json:"state"`
-				Name  string `json:"state_name"`
-			}{
-				int(s),
-				s.String(),
-			}
+		bieterID := mux.Vars(r)["id"]
+		limitBody(w, r, config)
+		if err := db.MergeBieter(bieterID, r.Body); err != nil {
+			handleError(w, fmt.Errorf("merge bieter: %w", err))
+			return
+		}
 
-			if err := json.NewEncoder(w).Encode(response); err != nil {
-				handleError(w, fmt.Errorf("encoding state: %w", err))
-				return
-			}
-		})
-}
+		payload, _ := db.Bieter(bieterID)
+		bieter := ViewBieter{
+			bieterID,
+			payload,
+			db.Offer(bieterID),
+			db.Version(bieterID),
+			db.Times(bieterID),
+		}
 
-func handleClearOffer(router *mux.Router, db *Database, config Config) {
-	router.Path(pathPrefixAPI + "/offer").Methods("DELETE").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := db.ClearOffer(isAdmin(r, config)); err != nil {
-			handleError(w, fmt.Errorf("clear offers: %w", err))
+		if err := json.NewEncoder(w).Encode(bieter); err != nil {
+			handleError(w, fmt.Errorf("encoding bieter: %w", err))
 			return
 		}
 	})
 }
 
-func handleSetOffer(router *mux.Router, db *Database, config Config) {
-	router.Path(pathPrefixAPI + "/offer/{id}").Methods("PUT").
-		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			bieterID := mux.Vars(r)["id"]
+// handleBieterPurge removes a deleted bieter for ever.
+func handleBieterPurge(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter/{id}/purge").Methods("DELETE").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
 
-			if err := db.UpdateOffer(bieterID, r.Body, isAdmin(r, config)); err != nil {
-				handleError(w, fmt.Errorf("save offer: %w", err))
-				return
-			}
+		if err := db.PurgeBieter(mux.Vars(r)["id"]); err != nil {
+			handleError(w, fmt.Errorf("purge bieter: %w", err))
+			return
+		}
+	})
+}
 
-			offer := db.Offer(bieterID)
+// handleBieterRestore restores a deleted bieter.
+func handleBieterRestore(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter/{id}/restore").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		bieterID := mux.Vars(r)["id"]
+		if err := db.RestoreBieter(bieterID); err != nil {
+			handleError(w, fmt.Errorf("restore bieter: %w", err))
+			return
+		}
+
+		payload, _ := db.Bieter(bieterID)
+		bieter := ViewBieter{
+			bieterID,
+			payload,
+			db.Offer(bieterID),
+			db.Version(bieterID),
+			db.Times(bieterID),
+		}
+
+		if err := json.NewEncoder(w).Encode(bieter); err != nil {
+			handleError(w, fmt.Errorf("encoding bieter: %w", err))
+			return
+		}
+	})
+}
+
+func handleBieterList(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := isAdmin(r, config)
+		if !admin {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		// The list is streamed, so it does not have to be in memory twice.
+		// After the first byte, the status is sent, so errors can only be
+		// logged.
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := io.WriteString(w, "["); err != nil {
+			log.Printf("Error: writing bieter list: %v", err)
+			return
+		}
+
+		enc := json.NewEncoder(w)
+		first := true
+		for _, id := range db.BieterIDs() {
+			payload, exist := db.Bieter(id)
+			if !exist {
+				// Deleted while streaming.
+				continue
+			}
+
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					log.Printf("Error: writing bieter list: %v", err)
+					return
+				}
+			}
+			first = false
+
+			bieter := ViewBieter{
+				ID:      id,
+				Payload: payload,
+				Offer:   db.Offer(id),
+				Version: db.Version(id),
+
+				BieterTimes: db.Times(id),
+			}
+
+			if err := enc.Encode(bieter); err != nil {
+				log.Printf("Error: encoding bieter %q: %v", id, err)
+				return
+			}
+		}
+
+		if _, err := io.WriteString(w, "]\n"); err != nil {
+			log.Printf("Error: writing bieter list: %v", err)
+		}
+	})
+}
+
+// handleBieterCSV returns all bieters as csv file.
+func handleBieterCSV(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter.csv").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		bieterList := db.BieterList()
+		ids := make([]string, 0, len(bieterList))
+		for id := range bieterList {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="bieter.csv"`)
+
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "name", "mail", "verteilstelle", "abbuchung", "IBAN", "kontoinhaber", "adresse", "offer"})
+
+		for _, id := range ids {
+			var data pdfData
+			if err := json.Unmarshal(bieterList[id], &data); err != nil {
+				log.Printf("Error: decode bieter %q for csv: %v", id, err)
+				continue
+			}
+
+			cw.Write([]string{
+				id,
+				data.Name,
+				data.Mail,
+				config.verteilstelleName(int(data.Verteilstelle)),
+				config.abbuchungName(int(data.Abbuchung)),
+				data.IBAN,
+				data.Kontoinhaber,
+				data.Adresse,
+				strconv.Itoa(db.Offer(id)),
+			})
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Printf("Error: writing csv: %v", err)
+		}
+	})
+}
+
+// handleBieterCount returns the number of bieters and offers. It is cheaper
+// than the stats.
+func handleBieterCount(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter/count").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		bieter, offers := db.Count()
+		count := struct {
+			Bieter int `json:"bieter"`
+			Offers int `json:"offers"`
+		}{bieter, offers}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(count); err != nil {
+			handleError(w, fmt.Errorf("encoding count: %w", err))
+		}
+	})
+}
+
+// handleBieterTrash lists the deleted bieters, so an admin can restore or
+// purge them.
+func handleBieterTrash(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/bieter/trash").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		trash, err := db.Trash()
+		if err != nil {
+			handleError(w, fmt.Errorf("reading trash: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(trash); err != nil {
+			handleError(w, fmt.Errorf("encoding trash: %w", err))
+		}
+	})
+}
+
+// lookupMessage is the answer to all public lookups. It does not tell, if the
+// mail address exists.
+const lookupMessage = "Wenn es eine Anmeldung mit dieser E-Mail-Adresse gibt, bekommst du eine Nachricht."
+
+// handleBieterLookup finds the bieter with a mail address.
+//
+// The public always gets the same answer, so the endpoint can not be used to
+// find out, which mail addresses are registered. If exactly one bieter
+// matches, the id is sent to the mail address. Admins get the id in the
+// response.
+func handleBieterLookup(router *mux.Router, db *Database, config Config, mail *mailer) {
+	router.Path(pathPrefixAPI + "/bieter/lookup").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkContentType(r); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		limitBody(w, r, config)
+		var content struct {
+			Mail string `json:"mail"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&content); err != nil {
+			handleError(w, validationError{msg: "Ungültige Anfrage"})
+			return
+		}
+
+		ids := db.BieterByMail(content.Mail)
+
+		if !isAdmin(r, config) {
+			if len(ids) == 1 {
+				mail.sendAsync(lookupMail(ids[0], content.Mail, config))
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(struct {
+				Message string `json:"message"`
+			}{translate(requestLanguage(r), "LOOKUP_SENT", lookupMessage)})
+			return
+		}
+
+		if len(ids) == 0 {
+			handleError(w, clientError{msg: "Es gibt keinen Bieter mit dieser E-Mail-Adresse", status: 404})
+			return
+		}
+
+		if len(ids) > 1 {
+			handleError(w, clientError{msg: fmt.Sprintf("Es gibt %d Bieter mit dieser E-Mail-Adresse", len(ids)), status: 409})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			ID string `json:"id"`
+		}{ids[0]}); err != nil {
+			handleError(w, fmt.Errorf("encoding lookup: %w", err))
+		}
+	})
+}
+
+// handleStats returns the number of bieters and the sum of the offers grouped
+// by verteilstelle and abbuchung.
+func handleStats(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/stats").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		s := buildStats(db.BieterList(), db.Offer, config)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s); err != nil {
+			handleError(w, fmt.Errorf("encoding stats: %w", err))
+		}
+	})
+}
+
+// handleResults returns the offers ranked from the highest to the lowest and
+// marks the offers, that are needed to reach the budget.
+func handleResults(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/results").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		result := buildResults(db.BieterList(), db.Offer, config.Budget)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			handleError(w, fmt.Errorf("encoding results: %w", err))
+		}
+	})
+}
+
+// handleResultsPDF returns a pdf with a summary of the offers.
+func handleResultsPDF(router *mux.Router, db *Database, config Config, filesystem fs.FS) {
+	router.Path(pathPrefixAPI + "/results.pdf").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		headerImage := loadHeaderImage(filesystem, config.HeaderImage)
+
+		bieterList := db.BieterList()
+		pdfile, err := Results(
+			headerImage,
+			config,
+			buildStats(bieterList, db.Offer, config),
+			buildResults(bieterList, db.Offer, config.Budget),
+		)
+		if err != nil {
+			handleError(w, fmt.Errorf("creating results pdf: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		io.Copy(w, pdfile)
+	})
+}
+
+// handleVerteilstellen returns the configured verteilstellen.
+func handleVerteilstellen(router *mux.Router, config Config) {
+	router.Path(pathPrefixAPI + "/verteilstellen").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verteilstellen := config.Verteilstellen
+		if verteilstellen == nil {
+			verteilstellen = []Verteilstelle{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(verteilstellen); err != nil {
+			handleError(w, fmt.Errorf("encoding verteilstellen: %w", err))
+		}
+	})
+}
+
+// handleAbbuchungOptions returns the configured abbuchung options.
+func handleAbbuchungOptions(router *mux.Router, config Config) {
+	router.Path(pathPrefixAPI + "/abbuchung-options").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		options := config.Abbuchungen
+		if options == nil {
+			options = []AbbuchungOption{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(options); err != nil {
+			handleError(w, fmt.Errorf("encoding abbuchung options: %w", err))
+		}
+	})
+}
+
+// handleState gets or sets the service status.
+func handleState(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI+"/state").Methods("GET", "PUT").
+		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "PUT" {
+				if !isAdmin(r, config) {
+					handleError(w, clientError{msg: "not allowed", status: 403})
+					return
+				}
+
+				if err := checkContentType(r); err != nil {
+					handleError(w, err)
+					return
+				}
+
+				limitBody(w, r, config)
+
+				if isDryRun(r) {
+					s, checkErr := db.CheckState(r.Body)
+					result, err := newDryRunResult(w, checkErr)
+					if err != nil {
+						handleError(w, fmt.Errorf("check state: %w", err))
+						return
+					}
+
+					if !result.Valid {
+						s = db.State()
+					}
+
+					response := struct {
+						dryRunResult
+						State int    `json:"state"`
+						Name  string `json:"state_name"`
+					}{
+						result,
+						int(s),
+						s.String(),
+					}
+
+					if err := json.NewEncoder(w).Encode(response); err != nil {
+						handleError(w, fmt.Errorf("encoding state: %w", err))
+					}
+					return
+				}
+
+				if err := db.SetState(r.Body); err != nil {
+					handleError(w, fmt.Errorf("set state: %w", err))
+					return
+				}
+			}
+
+			summary := db.Summary(time.Now())
+			response := struct {
+				State      int        `json:"state"`
+				Name       string     `json:"state_name"`
+				Round      int        `json:"round"`
+				Bieter     int        `json:"bieter_count"`
+				Offers     int        `json:"offer_count"`
+				OffersOpen bool       `json:"offers_open"`
+				Deadline   *time.Time `json:"offer_deadline,omitempty"`
+			}{
+				State:      int(summary.State),
+				Name:       summary.State.String(),
+				Round:      summary.Round,
+				Bieter:     summary.Bieter,
+				Offers:     summary.Offers,
+				OffersOpen: summary.OffersOpen,
+			}
+
+			if !summary.Deadline.IsZero() {
+				response.Deadline = &summary.Deadline
+			}
+
+			if err := json.NewEncoder(w).Encode(response); err != nil {
+				handleError(w, fmt.Errorf("encoding state: %w", err))
+				return
+			}
+		})
+}
+
+// isDryRun returns true, if the request should only validate the change
+// without executing it.
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dryRun") == "true"
+}
+
+// dryRunResult is the response to a request with the dryRun query parameter.
+// Error and Code are set, if the change is not valid.
+type dryRunResult struct {
+	DryRun bool   `json:"dry_run"`
+	Valid  bool   `json:"valid"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// newDryRunResult returns the dryRunResult for the validation error of an
+// event. Other errors, like an invalid body, are returned.
+func newDryRunResult(w http.ResponseWriter, validationErr error) (dryRunResult, error) {
+	result := dryRunResult{DryRun: true, Valid: validationErr == nil}
+	if validationErr == nil {
+		return result, nil
+	}
+
+	var invalid validationError
+	if !errors.As(validationErr, &invalid) {
+		return dryRunResult{}, validationErr
+	}
+
+	msg, code, _ := describeError(validationErr)
+	result.Error = translate(responseLanguage(w), code, msg)
+	result.Code = code
+	return result, nil
+}
+
+func handleClearOffer(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/offer").Methods("DELETE").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := db.ClearOffer(isAdmin(r, config)); err != nil {
+			handleError(w, fmt.Errorf("clear offers: %w", err))
+			return
+		}
+	})
+}
+
+// handleOfferHistogram returns the distribution of the offers. It does not
+// need the admin password, so the public screen can show it.
+func handleOfferHistogram(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/offer/histogram").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := buildHistogram(db.OfferValues(), config.HistogramBucket)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(h); err != nil {
+			handleError(w, fmt.Errorf("encoding histogram: %w", err))
+		}
+	})
+}
+
+// handleSetOffer returns or sets the offer of one bieter.
+//
+// Admins can set the offer in every state, for example for a bid, that was
+// phoned in during the registration. The event is saved with the admin as
+// actor.
+func handleSetOffer(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI+"/offer/{id}").Methods("GET", "PUT").
+		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bieterID := mux.Vars(r)["id"]
+
+			if r.Method == "GET" {
+				if _, exist := db.Bieter(bieterID); !exist {
+					handleError(w, errBieterNotFound)
+					return
+				}
+			}
+
+			if r.Method == "PUT" {
+				if err := checkContentType(r); err != nil {
+					handleError(w, err)
+					return
+				}
+
+				limitBody(w, r, config)
+				if err := db.UpdateOffer(bieterID, r.Body, isAdmin(r, config)); err != nil {
+					handleError(w, fmt.Errorf("save offer: %w", err))
+					return
+				}
+			}
+
+			offer := db.Offer(bieterID)
 
 			if err := json.NewEncoder(w).Encode(offer); err != nil {
 				handleError(w, fmt.Errorf("encoding offer: %w", err))
 				return
 			}
-		})
+		})
+}
+
+// handleImportOffers sets the offers of many bieters at once.
+//
+// The body is a list of objects with id and offer. If one row is invalid, no
+// offer is saved, unless the query parameter partial=true is set. The result
+// of each row is returned in both cases. If writing fails, the status is 500
+// and the results tell, which rows were saved.
+func handleImportOffers(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/offers").Methods("PUT").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		if err := checkContentType(r); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		limitBody(w, r, config)
+		var rows []OfferRow
+		if err := json.NewDecoder(r.Body).Decode(&rows); err != nil {
+			handleError(w, fmt.Errorf("decoding offers: %w", clientError{msg: "Ungültige Daten übergeben"}))
+			return
+		}
+
+		results, err := db.ImportOffers(rows, r.URL.Query().Get("partial") == "true")
+
+		var body struct {
+			Error   string        `json:"error,omitempty"`
+			Results []OfferResult `json:"results"`
+		}
+		body.Results = results
+
+		if err != nil {
+			status := 400
+			body.Error = errOfferImport.forClient()
+			if !errors.Is(err, errOfferImport) {
+				// Some offers can already be saved, so the results are
+				// returned with the error.
+				log.Printf("Error: import offers: %v", err)
+				status = 500
+				body.Error = "Interner Fehler. Nur die Gebote mit saved sind gespeichert"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+		}
+
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			handleError(w, fmt.Errorf("encoding offer results: %w", err))
+			return
+		}
+	})
+}
+
+// handleDeleteOffer removes the offer of one bieter.
+func handleDeleteOffer(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/offer/{id}").Methods("DELETE").
+		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bieterID := mux.Vars(r)["id"]
+			if _, exist := db.Bieter(bieterID); !exist {
+				handleError(w, errBieterNotFound)
+				return
+			}
+
+			if err := db.DeleteOffer(bieterID, isAdmin(r, config)); err != nil {
+				handleError(w, fmt.Errorf("delete offer: %w", err))
+				return
+			}
+		})
+}
+
+// handleEventStream sends a server-sent event, each time an offer or the state
+// changes.
+//
+// The messages only contain the type of the change, so the client has to fetch
+// the new data.
+func handleEventStream(router *mux.Router, db *Database) {
+	router.Path(pathPrefixAPI + "/events/stream").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			handleError(w, errors.New("response writer does not support flushing"))
+			return
+		}
+
+		events, unsubscribe := db.subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case event := <-events:
+				msg, ok := streamMessage(event)
+				if !ok {
+					continue
+				}
+
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", msg); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// streamMessage returns the message for the event stream. Returns false, if
+// the event should not be send.
+func streamMessage(event Event) ([]byte, bool) {
+	msg := struct {
+		Type  string `json:"type"`
+		State int    `json:"state,omitempty"`
+	}{
+		Type: event.Name(),
+	}
+
+	switch e := event.(type) {
+	case eventOffer, eventOfferDelete, eventOfferClear, eventRoundRestore, eventBanner:
+	case eventServiceState:
+		msg.State = int(e.NewState)
+	case eventReset:
+		msg.State = int(stateRegistration)
+	case eventDataRestore:
+		msg.State = int(e.State)
+	default:
+		return nil, false
+	}
+
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return nil, false
+	}
+	return bs, true
+}
+
+// handleAudit returns all events with the time and the actor.
+//
+// The query parameter since can be used to only return events, that were
+// created after a RFC3339 timestamp.
+func handleAudit(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/audit").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		var since time.Time
+		if s := r.URL.Query().Get("since"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				handleError(w, clientError{msg: "Ungültiger Zeitpunkt in since", status: 400})
+				return
+			}
+			since = t
+		}
+
+		events, err := db.EventLog()
+		if err != nil {
+			handleError(w, fmt.Errorf("reading events: %w", err))
+			return
+		}
+
+		type auditEntry struct {
+			Name        string    `json:"name"`
+			Description string    `json:"description"`
+			Actor       string    `json:"actor"`
+			Time        time.Time `json:"time"`
+		}
+
+		entries := []auditEntry{}
+		for _, event := range events {
+			meta := event.meta()
+			if meta.CreatedAt.Before(since) {
+				continue
+			}
+
+			entries = append(entries, auditEntry{
+				Name:        event.Name(),
+				Description: event.String(),
+				Actor:       meta.Actor,
+				Time:        meta.CreatedAt,
+			})
+		}
+
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			handleError(w, fmt.Errorf("encoding audit log: %w", err))
+		}
+	})
+}
+
+// handleEventExport returns all events as ndjson with one event per line.
+//
+// The lines are written and flushed one by one, so the export is not
+// buffered in the response.
+func handleEventExport(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/events.ndjson").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		events, err := db.EventLog()
+		if err != nil {
+			handleError(w, fmt.Errorf("reading events: %w", err))
+			return
+		}
+
+		flusher, _ := w.(http.Flusher)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="events.ndjson"`)
+
+		encoder := json.NewEncoder(w)
+		for _, event := range events {
+			payload, err := json.Marshal(event)
+			if err != nil {
+				// The header is already sent, so the error can only be logged.
+				log.Printf("Error: encoding event %s: %v", event.Name(), err)
+				return
+			}
+
+			meta := event.meta()
+			line := exportedEvent{
+				Name:    event.Name(),
+				Time:    meta.CreatedAt,
+				Actor:   meta.Actor,
+				Payload: payload,
+			}
+
+			if err := encoder.Encode(line); err != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// handleEventImport reads events in the format of handleEventExport and
+// executes them.
+//
+// With the query parameter validateOnly=true, the events are only checked.
+func handleEventImport(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/events/import").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		if err := checkContentType(r, "application/x-ndjson"); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		// The events can be as big as a backup.
+		r.Body = http.MaxBytesReader(w, r.Body, maxBackupSize)
+		result, err := db.ImportEvents(r.Body, r.URL.Query().Get("validateOnly") == "true")
+		if err != nil {
+			handleError(w, fmt.Errorf("import events: %w", err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			handleError(w, fmt.Errorf("encoding import result: %w", err))
+		}
+	})
+}
+
+// handleUndo reverts the last change.
+func handleUndo(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/undo").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		inverse, err := db.Undo(true)
+		if err != nil {
+			handleError(w, fmt.Errorf("undo: %w", err))
+			return
+		}
+
+		response := struct {
+			Undo string `json:"undo"`
+		}{
+			inverse.String(),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			handleError(w, fmt.Errorf("encoding undo: %w", err))
+		}
+	})
+}
+
+// handleBackup returns the current state of the database as a file.
+func handleBackup(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/backup").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		bs, err := db.Backup()
+		if err != nil {
+			handleError(w, fmt.Errorf("creating backup: %w", err))
+			return
+		}
+
+		filename := fmt.Sprintf("%s%s.json", backupFilePrefix, time.Now().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Write(bs)
+	})
+}
+
+// maxBackupSize is the maximal size of a backup in bytes, that can be
+// restored.
+const maxBackupSize = 64 << 20
+
+// handleRestoreBackup replaces all data with a backup from handleBackup.
+//
+// To prevent accidents, the query parameter confirm=true has to be set.
+func handleRestoreBackup(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/restore").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		if r.URL.Query().Get("confirm") != "true" {
+			handleError(w, clientError{msg: "Zum Wiederherstellen muss confirm=true gesetzt sein", code: "CONFIRMATION_REQUIRED"})
+			return
+		}
+
+		if err := checkContentType(r); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		// A backup is much bigger than the other requests.
+		r.Body = http.MaxBytesReader(w, r.Body, maxBackupSize)
+		if err := db.RestoreBackup(r.Body); err != nil {
+			handleError(w, fmt.Errorf("restore backup: %w", err))
+			return
+		}
+	})
+}
+
+// handleReset removes all data for a new bieterrunde.
+func handleReset(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI + "/reset").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		if err := checkContentType(r); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		limitBody(w, r, config)
+		if err := db.Reset(r.Body, true); err != nil {
+			handleError(w, fmt.Errorf("reset: %w", err))
+			return
+		}
+	})
+}
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI returns the OpenAPI description of the api.
+func handleOpenAPI(router *mux.Router, maxAge int) {
+	etag := contentETag(openAPISpec)
+	router.Path(pathPrefixAPI + "/openapi.json").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		setCacheHeaders(w, etag, maxAge)
+		http.ServeContent(w, r, "openapi.json", time.Time{}, bytes.NewReader(openAPISpec))
+	})
+}
+
+// handleBanner returns and sets the banner, that is shown to all users.
+func handleBanner(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI+"/banner").Methods("GET", "PUT").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			if !isAdmin(r, config) {
+				handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+				return
+			}
+
+			if err := checkContentType(r); err != nil {
+				handleError(w, err)
+				return
+			}
+
+			limitBody(w, r, config)
+			if err := db.SetBanner(r.Body); err != nil {
+				handleError(w, fmt.Errorf("set banner: %w", err))
+				return
+			}
+		}
+
+		response := struct {
+			Banner string `json:"banner"`
+		}{
+			db.Banner(),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			handleError(w, fmt.Errorf("encoding banner: %w", err))
+		}
+	})
+}
+
+// handleMaintenance returns and switches the maintenance mode.
+func handleMaintenance(router *mux.Router, db *Database, config Config) {
+	router.Path(pathPrefixAPI+"/maintenance").Methods("GET", "PUT").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			if !isAdmin(r, config) {
+				handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+				return
+			}
+
+			if err := checkContentType(r); err != nil {
+				handleError(w, err)
+				return
+			}
+
+			limitBody(w, r, config)
+			var body struct {
+				Maintenance bool `json:"maintenance"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				handleError(w, fmt.Errorf("decoding maintenance: %w", clientError{msg: "Ungültige Daten übergeben"}))
+				return
+			}
+
+			db.SetMaintenance(body.Maintenance)
+			log.Printf("Maintenance mode: %t", body.Maintenance)
+		}
+
+		response := struct {
+			Maintenance bool `json:"maintenance"`
+		}{
+			db.Maintenance(),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			handleError(w, fmt.Errorf("encoding maintenance: %w", err))
+		}
+	})
+}
+
+// handleProfiling serves the pprof handlers under /api/debug/pprof/, if
+// profiling is enabled. Only admins can use them.
+func handleProfiling(router *mux.Router, config Config) {
+	if !config.EnableProfiling {
+		return
+	}
+
+	prefix := pathPrefixAPI + "/debug/pprof/"
+	router.PathPrefix(prefix).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, config) {
+			handleError(w, clientError{msg: "Passwort ist falsch", status: 401})
+			return
+		}
+
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			// pprof.Index expects the path /debug/pprof/{name}.
+			http.StripPrefix(pathPrefixAPI, http.HandlerFunc(pprof.Index)).ServeHTTP(w, r)
+		}
+	})
 }
 
 // handleStatic returns static files.
 //
 // It looks for each file in a directory "static/". It the file does not exist
 // there, it looks in the default static files, the binary was creaded with.
-func handleStatic(router *mux.Router, fileSystem fs.FS) {
+//
+// Each file gets an ETag from its content, so the browser can ask with
+// If-None-Match, if the file has changed.
+func handleStatic(router *mux.Router, fileSystem fs.FS, maxAge int) {
+	fileServer := http.FileServer(http.FS(fileSystem))
+
+	var mu sync.Mutex
+	files := make(map[string]*cachedFile)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+		mu.Lock()
+		file, ok := files[name]
+		if !ok {
+			file = newCachedFSFile(fileSystem, name)
+		}
+		mu.Unlock()
+
+		if _, _, etag, err := file.get(); err == nil {
+			if !ok {
+				// Only existing files are remembered, so unknown paths do
+				// not fill the map.
+				mu.Lock()
+				files[name] = file
+				mu.Unlock()
+			}
+
+			// http.FileServer answers with 304, if the ETag matches.
+			setCacheHeaders(w, etag, maxAge)
+		}
+		fileServer.ServeHTTP(w, r)
+	}
 
-	router.PathPrefix(pathPrefixStatic).Handler(http.StripPrefix(pathPrefixStatic, http.FileServer(http.FS(fileSystem))))
+	router.PathPrefix(pathPrefixStatic).Handler(http.StripPrefix(pathPrefixStatic, http.HandlerFunc(handler)))
+}
+
+// contentETag returns an ETag for the content.
+func contentETag(content []byte) string {
+	hash := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// setCacheHeaders sets the ETag and the Cache-Control header.
+func setCacheHeaders(w http.ResponseWriter, etag string, maxAge int) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
 }
 
 // MultiFS implements fs.FS but uses many sources.
@@ -311,44 +1759,162 @@ type MultiFS struct {
 	fs []fs.FS
 }
 
-// Open opens the file from the first source that contains it.
-func (fs MultiFS) Open(name string) (fs.File, error) {
-	for i, fs := range fs.fs {
-		f, err := fs.Open(name)
+// Open opens the file from the first source that contains it. A directory
+// lists the entries of all sources.
+func (m MultiFS) Open(name string) (fs.File, error) {
+	for i, source := range m.fs {
+		f, err := source.Open(name)
 		if err != nil {
 			if !errors.Is(err, os.ErrNotExist) {
 				return nil, fmt.Errorf("try open file from source %d: %w", i, err)
 			}
 			continue
 		}
+
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("stat file from source %d: %w", i, err)
+		}
+
+		if info.IsDir() {
+			return &multiDir{File: f, fs: m, name: name}, nil
+		}
 		return f, nil
 	}
 	return nil, os.ErrNotExist
 }
 
-type responselogger struct {
-	http.ResponseWriter
-	code int
+// Stat returns the file info from the first source that contains the file.
+func (m MultiFS) Stat(name string) (fs.FileInfo, error) {
+	for i, source := range m.fs {
+		info, err := fs.Stat(source, name)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("stat file from source %d: %w", i, err)
+			}
+			continue
+		}
+		return info, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// ReadDir returns the entries of the directory from all sources sorted by
+// name. If more sources have an entry with the same name, the first source
+// wins.
+func (m MultiFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	var found bool
+	seen := make(map[string]bool)
+	for i, source := range m.fs {
+		sourceEntries, err := fs.ReadDir(source, name)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("read dir from source %d: %w", i, err)
+			}
+			continue
+		}
+
+		found = true
+		for _, entry := range sourceEntries {
+			if seen[entry.Name()] {
+				continue
+			}
+			seen[entry.Name()] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	if !found {
+		return nil, os.ErrNotExist
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
 }
 
-func (r *responselogger) WriteHeader(h int) {
-	r.code = h
-	r.ResponseWriter.WriteHeader(h)
+// multiDir is a directory opened from a MultiFS. ReadDir returns the merged
+// entries of all sources.
+type multiDir struct {
+	fs.File
+	fs   MultiFS
+	name string
+
+	entries []fs.DirEntry
+	read    bool
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+func (d *multiDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
 
-		writer := responselogger{w, 200}
-		next.ServeHTTP(w, r)
-		log.Printf("%s %d %s", r.Method, writer.code, r.RequestURI)
-	})
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
 }
 
 func handleError(w http.ResponseWriter, err error) {
-	msg := "Interner Fehler"
-	status := 500
-	var skipLog bool
+	var errTooLarge *http.MaxBytesError
+	if errors.As(err, &errTooLarge) {
+		err = fmt.Errorf(
+			"%w: %v",
+			clientError{msg: fmt.Sprintf("Die Anfrage ist zu groß. Erlaubt sind %d Bytes", errTooLarge.Limit), status: 413},
+			err,
+		)
+	}
+
+	msg, code, status := describeError(err)
+	msg = translate(responseLanguage(w), code, msg)
+
+	// The header is set by the requestIDMiddleware.
+	reqID := w.Header().Get(headerRequestID)
+
+	log.Printf("Error: request %s: %v", reqID, err)
+
+	body := struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		RequestID string `json:"request_id,omitempty"`
+	}{
+		msg,
+		code,
+		reqID,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error: writing error response: %v", err)
+	}
+}
+
+// describeError returns the untranslated message, the error code and the
+// http status for an error. Errors, that are not meant for the client, are
+// reported as internal errors.
+func describeError(err error) (msg string, code string, status int) {
+	msg = "Interner Fehler"
+	status = 500
 
 	var forClient interface {
 		forClient() string
@@ -356,7 +1922,6 @@ func handleError(w http.ResponseWriter, err error) {
 	if errors.As(err, &forClient) {
 		msg = forClient.forClient()
 		status = 400
-		//skipLog = true
 	}
 
 	var httpStatus interface {
@@ -366,17 +1931,24 @@ func handleError(w http.ResponseWriter, err error) {
 		status = httpStatus.httpStatus()
 	}
 
-	if !skipLog {
-		log.Printf("Error: %v", err)
+	code = statusErrorCode(status)
+	var errorCode interface {
+		errorCode() string
+	}
+	if errors.As(err, &errorCode) {
+		code = errorCode.errorCode()
 	}
 
-	http.Error(w, msg, status)
-	return
+	return msg, code, status
 }
 
 type clientError struct {
 	msg    string
 	status int
+
+	// code is the error code for the client. Empty means a code from the
+	// status, see statusErrorCode.
+	code string
 }
 
 func (err clientError) Error() string {
@@ -394,11 +1966,104 @@ func (err clientError) httpStatus() int {
 	return err.status
 }
 
+func (err clientError) errorCode() string {
+	if err.code == "" {
+		return statusErrorCode(err.httpStatus())
+	}
+	return err.code
+}
+
+// errBieterNotFound is returned, when the bieter in the url does not exist.
+var errBieterNotFound = clientError{msg: "Bieter existiert nicht", status: 404, code: "BIETER_NOT_FOUND"}
+
+// statusErrorCode returns the error code for errors without an own code.
+func statusErrorCode(status int) string {
+	switch status {
+	case 401:
+		return "UNAUTHORIZED"
+	case 403:
+		return "FORBIDDEN"
+	case 404:
+		return "NOT_FOUND"
+	case 409:
+		return "CONFLICT"
+	case 413:
+		return "TOO_LARGE"
+	case 415:
+		return "UNSUPPORTED_MEDIA_TYPE"
+	case 429:
+		return "TOO_MANY_REQUESTS"
+	case 500:
+		return "INTERNAL_ERROR"
+	case 503:
+		return "UNAVAILABLE"
+	default:
+		return "BAD_REQUEST"
+	}
+}
+
+// ifMatchVersion returns the bieter version from the If-Match header. It
+// returns 0, if the header is not set.
+//
+// The version can be quoted like an ETag.
+func ifMatchVersion(r *http.Request) (int, error) {
+	value := r.Header.Get("If-Match")
+	if value == "" {
+		return 0, nil
+	}
+
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 0 {
+		return 0, clientError{msg: "Ungültige Version im If-Match Header", code: "INVALID_VERSION"}
+	}
+	return version, nil
+}
+
+// limitBody limits the size of the request body. Reading more bytes returns an
+// error, that handleError returns as 413.
+func limitBody(w http.ResponseWriter, r *http.Request, config Config) {
+	r.Body = http.MaxBytesReader(w, r.Body, config.MaxBodySize)
+}
+
+// checkContentType returns an error, if the request body is not json.
+//
+// Additional media types, that are allowed, can be given as arguments.
+func checkContentType(r *http.Request, allowed ...string) error {
+	errUnsupported := clientError{msg: "Die Anfrage muss vom Typ application/json sein", status: 415}
+
+	// An invalid parameter like an empty charset returns the media type with
+	// ErrInvalidMediaParameter.
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && !errors.Is(err, mime.ErrInvalidMediaParameter) {
+		return errUnsupported
+	}
+
+	if mediaType != "application/json" && !containsString(allowed, mediaType) {
+		return errUnsupported
+	}
+
+	if charset, ok := params["charset"]; ok && charset != "" && !strings.EqualFold(charset, "utf-8") {
+		return errUnsupported
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 func isAdmin(r *http.Request, c Config) bool {
-	if c.AdminPW == "" {
+	password := c.adminPassword()
+	if password == "" {
 		return false
 	}
 
 	adminPW := r.Header.Get("Auth")
-	return adminPW == c.AdminPW
+	return adminPW == password && c.adminIPAllowed(r)
 }
@@ -0,0 +1,2398 @@
+package server
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const testAdminPW = "secret"
+
+func newTestDB(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDB returned: %v", err)
+	}
+	return db
+}
+
+func newTestRouter(t *testing.T, db *Database) *mux.Router {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.AdminPW = testAdminPW
+
+	router := mux.NewRouter()
+	// The embedded static files have the prefix static/
+	registerHandlers(router, config, db, DefaultFiles{Static: os.DirFS("..")})
+	return router
+}
+
+func doRequest(router http.Handler, method, path, body string, admin bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if admin {
+		req.Header.Set("Auth", testAdminPW)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBieterCSV(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"Müller, Hugo","mail":"hugo@example.com","verteilstelle":2,"abbuchung":1,"IBAN":"DE02120300000000202051","adresse":"Am Wald 1"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":4500}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	if _, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true); err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "GET", "/api/bieter.csv", "", false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	rec := doRequest(router, "GET", "/api/bieter.csv", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("got content type %q, expected text/csv", ct)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing csv: %v", err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("got %d records, expected 3", len(records))
+	}
+
+	expectHeader := "id,name,mail,verteilstelle,abbuchung,IBAN,kontoinhaber,adresse,offer"
+	if got := strings.Join(records[0], ","); got != expectHeader {
+		t.Errorf("got header %q, expected %q", got, expectHeader)
+	}
+
+	var row []string
+	for _, r := range records[1:] {
+		if r[0] == id {
+			row = r
+		}
+	}
+
+	expectRow := []string{id, "Müller, Hugo", "hugo@example.com", "Schwenningen", "Jährlich", "DE02120300000000202051", "", "Am Wald 1", "4500"}
+	if strings.Join(row, "|") != strings.Join(expectRow, "|") {
+		t.Errorf("got row %q, expected %q", row, expectRow)
+	}
+}
+
+func TestBieterZIP(t *testing.T) {
+	db := newTestDB(t)
+	for _, name := range []string{"hugo", "erik"} {
+		if _, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), true); err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+	}
+	// A bieter, that can not be decoded, is skipped.
+	db.bieter["broken"] = []byte(`{"name":5}`)
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "GET", "/api/bieter.zip", "", false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	rec := doRequest(router, "GET", "/api/bieter.zip", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("reading zip: %v", err)
+	}
+
+	if len(zr.File) != 2 {
+		t.Fatalf("got %d files, expected 2", len(zr.File))
+	}
+
+	for _, f := range zr.File {
+		if !strings.HasPrefix(f.Name, "bietervertrag-") || !strings.HasSuffix(f.Name, ".pdf") {
+			t.Errorf("got unexpected file name %q", f.Name)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	srv := httptest.NewServer(newTestRouter(t, db))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/events/stream", nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connecting to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got content type %q", ct)
+	}
+
+	// Changes to a bieter are not send.
+	if _, err := db.UpdateBieter(id, strings.NewReader(`{"name":"hugo2","mail":"hugo2@example.com"}`), 0, true); err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":4500}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+
+	if expect := `data: {"type":"offer"}` + "\n"; line != expect {
+		t.Errorf("got %q, expected %q", line, expect)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	if err := db.ClearOffer(true); err != nil {
+		t.Fatalf("ClearOffer: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "GET", "/api/audit", "", false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	rec := doRequest(router, "GET", "/api/audit", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var entries []struct {
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		Actor       string    `json:"actor"`
+		Time        time.Time `json:"time"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("decoding audit log: %v", err)
+	}
+
+	expect := []struct{ name, actor string }{
+		{"update", actorPublic},
+		{"state", actorAdmin},
+		{"offer", actorPublic},
+		{"offer-clear", actorAdmin},
+	}
+
+	if len(entries) != len(expect) {
+		t.Fatalf("got %d entries, expected %d", len(entries), len(expect))
+	}
+
+	for i, e := range expect {
+		if entries[i].Name != e.name || entries[i].Actor != e.actor {
+			t.Errorf("entry %d is %s by %s, expected %s by %s", i, entries[i].Name, entries[i].Actor, e.name, e.actor)
+		}
+
+		if entries[i].Time.IsZero() || entries[i].Description == "" {
+			t.Errorf("entry %d has no time or description", i)
+		}
+	}
+
+	since := time.Now().Add(time.Hour).Format(time.RFC3339)
+	rec = doRequest(router, "GET", "/api/audit?since="+since, "", true)
+	if got := strings.TrimSpace(rec.Body.String()); got != "[]" {
+		t.Errorf("got %s with since in the future, expected no entries", got)
+	}
+
+	if rec := doRequest(router, "GET", "/api/audit?since=yesterday", "", true); rec.Code != 400 {
+		t.Errorf("got status %d for invalid since, expected 400", rec.Code)
+	}
+}
+
+func TestUndoHandler(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "DELETE", "/api/offer", "", true); rec.Code != 200 {
+		t.Fatalf("clear offers returned status %d", rec.Code)
+	}
+
+	if rec := doRequest(router, "POST", "/api/undo", "", false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	if rec := doRequest(router, "POST", "/api/undo", "", true); rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if got := db.Offer(id); got != 5000 {
+		t.Errorf("got offer %d after undo, expected 5000", got)
+	}
+}
+
+func TestDeleteOffer(t *testing.T) {
+	db := newTestDB(t)
+
+	var ids []string
+	for _, name := range []string{"hugo", "erik"} {
+		id, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+			t.Fatalf("UpdateOffer: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	router := newTestRouter(t, db)
+
+	// Public deletes are only allowed in the offer state.
+	if rec := doRequest(router, "DELETE", "/api/offer/"+ids[0], "", false); rec.Code != 400 {
+		t.Errorf("got status %d for public delete in registration state, expected 400", rec.Code)
+	}
+
+	if rec := doRequest(router, "DELETE", "/api/offer/unknown", "", true); rec.Code != 404 {
+		t.Errorf("got status %d for unknown bieter, expected 404", rec.Code)
+	}
+
+	if rec := doRequest(router, "DELETE", "/api/offer/"+ids[0], "", true); rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if _, exist := db.offer[ids[0]]; exist {
+		t.Errorf("offer of %s still exists", ids[0])
+	}
+
+	if got := db.Offer(ids[1]); got != 5000 {
+		t.Errorf("got offer %d for other bieter, expected 5000", got)
+	}
+}
+
+func TestBieterListStream(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	rec := doRequest(router, "GET", "/api/bieter", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != "[]" {
+		t.Errorf("got %q for empty list, expected []", got)
+	}
+
+	expect := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		id, err := db.NewBieter([]byte(fmt.Sprintf(`{"name":"bieter %d","mail":"bieter%d@example.com"}`, i, i)), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		expect[id] = true
+	}
+
+	rec = doRequest(router, "GET", "/api/bieter", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got []ViewBieter
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding streamed list: %v", err)
+	}
+
+	if len(got) != len(expect) {
+		t.Errorf("got %d bieters, expected %d", len(got), len(expect))
+	}
+
+	for _, b := range got {
+		if !expect[b.ID] {
+			t.Errorf("got unexpected bieter %q", b.ID)
+		}
+		delete(expect, b.ID)
+	}
+
+	if len(expect) > 0 {
+		t.Errorf("missing bieters: %v", expect)
+	}
+}
+
+func TestBieterPDFWithoutHeaderImage(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.AdminPW = testAdminPW
+	filesystem := MultiFS{fs: []fs.FS{fstest.MapFS{}, fstest.MapFS{"other.txt": {}}}}
+
+	router := mux.NewRouter()
+	handleBieter(router, db, config, filesystem, nil)
+
+	rec := doRequest(router, "GET", "/api/bieter/"+id+"/pdf", "", false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF")) {
+		t.Errorf("response is not a pdf, starts with %q", rec.Body.Bytes()[:min(10, rec.Body.Len())])
+	}
+}
+
+func TestContractPreview(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"Hugo <Hase>","mail":"hugo@example.com","verteilstelle":2}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "GET", "/api/bieter/unknown/preview", "", false); rec.Code != 404 {
+		t.Errorf("got status %d for unknown bieter, expected 404", rec.Code)
+	}
+
+	rec := doRequest(router, "GET", "/api/bieter/"+id+"/preview", "", false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("got content type %q, expected text/html", ct)
+	}
+
+	body := rec.Body.String()
+	for _, expect := range []string{"Hugo &lt;Hase&gt;", "Schwenningen", "Mandatsreferenz: 22" + id} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("preview does not contain %q:\n%s", expect, body)
+		}
+	}
+}
+
+func TestBieterCount(t *testing.T) {
+	db := newTestDB(t)
+
+	var ids []string
+	for _, name := range []string{"hugo", "erik", "anna", "paul"} {
+		id, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	for _, id := range ids[:3] {
+		if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+			t.Fatalf("UpdateOffer: %v", err)
+		}
+	}
+
+	// Deleted bieters and their offers are not counted.
+	if err := db.DeleteBieter(ids[0], true); err != nil {
+		t.Fatalf("DeleteBieter: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "GET", "/api/bieter/count", "", false); rec.Code != 401 {
+		t.Errorf("got status %d without password, expected 401", rec.Code)
+	}
+
+	rec := doRequest(router, "GET", "/api/bieter/count", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var count struct {
+		Bieter int `json:"bieter"`
+		Offers int `json:"offers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &count); err != nil {
+		t.Fatalf("decoding count: %v", err)
+	}
+
+	if count.Bieter != 3 || count.Offers != 2 {
+		t.Errorf("got %d bieter and %d offers, expected 3 and 2", count.Bieter, count.Offers)
+	}
+}
+
+func TestBieterLookup(t *testing.T) {
+	db := newTestDB(t)
+
+	hugo, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	// Admins can save a mail address twice.
+	for _, name := range []string{"erik", "anna"} {
+		if _, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"family@example.com"}`), true); err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+	}
+
+	router := newTestRouter(t, db)
+
+	for _, tt := range []struct {
+		name       string
+		mail       string
+		admin      bool
+		expectCode int
+		expectID   string
+	}{
+		{"match as admin", "Hugo@Example.com", true, 200, hugo},
+		{"no match as admin", "nobody@example.com", true, 404, ""},
+		{"multiple matches as admin", "family@example.com", true, 409, ""},
+		{"match as public", "hugo@example.com", false, 200, ""},
+		{"no match as public", "nobody@example.com", false, 200, ""},
+		{"multiple matches as public", "family@example.com", false, 200, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, "POST", "/api/bieter/lookup", `{"mail":"`+tt.mail+`"}`, tt.admin)
+			if rec.Code != tt.expectCode {
+				t.Fatalf("got status %d, expected %d: %s", rec.Code, tt.expectCode, rec.Body.String())
+			}
+
+			if !tt.admin {
+				if strings.Contains(rec.Body.String(), hugo) {
+					t.Errorf("public response contains the id: %s", rec.Body.String())
+				}
+
+				var got struct {
+					Message string `json:"message"`
+				}
+				json.Unmarshal(rec.Body.Bytes(), &got)
+				if got.Message != lookupMessage {
+					t.Errorf("got message %q, expected %q", got.Message, lookupMessage)
+				}
+				return
+			}
+
+			if tt.expectID == "" {
+				return
+			}
+
+			var got struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if got.ID != tt.expectID {
+				t.Errorf("got id %q, expected %q", got.ID, tt.expectID)
+			}
+		})
+	}
+}
+
+func TestAdminOfferInRegistration(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "PUT", "/api/offer/"+id, `{"offer":5000}`, false); rec.Code != 400 {
+		t.Errorf("got status %d for public offer in registration state, expected 400", rec.Code)
+	}
+
+	if rec := doRequest(router, "PUT", "/api/offer/"+id, `{"offer":5000}`, true); rec.Code != 200 {
+		t.Fatalf("got status %d for admin offer: %s", rec.Code, rec.Body.String())
+	}
+
+	if got := db.Offer(id); got != 5000 {
+		t.Errorf("got offer %d, expected 5000", got)
+	}
+
+	events, err := db.EventLog()
+	if err != nil {
+		t.Fatalf("EventLog: %v", err)
+	}
+
+	last := events[len(events)-1]
+	if last.Name() != "offer" {
+		t.Fatalf("got last event %q, expected offer", last.Name())
+	}
+
+	if actor := last.meta().Actor; actor != actorAdmin {
+		t.Errorf("got actor %q, expected %q", actor, actorAdmin)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	router := newTestRouter(t, newTestDB(t))
+
+	rec := doRequest(router, "GET", "/api/healthz", "", false)
+	if rec.Code != 200 || strings.TrimSpace(rec.Body.String()) != `{"status":"ok"}` {
+		t.Errorf("healthz returned %d %q", rec.Code, rec.Body.String())
+	}
+
+	if rec := doRequest(router, "GET", "/api/readyz", "", false); rec.Code != 200 {
+		t.Errorf("readyz returned %d after the database was loaded", rec.Code)
+	}
+}
+
+func TestHealthWhileLoading(t *testing.T) {
+	router := startupRouter()
+
+	if rec := doRequest(router, "GET", "/api/healthz", "", false); rec.Code != 200 {
+		t.Errorf("healthz returned %d while loading, expected 200", rec.Code)
+	}
+
+	if rec := doRequest(router, "GET", "/api/readyz", "", false); rec.Code != 503 {
+		t.Errorf("readyz returned %d while loading, expected 503", rec.Code)
+	}
+
+	if rec := doRequest(router, "GET", "/api/bieter", "", true); rec.Code != 503 {
+		t.Errorf("other routes returned %d while loading, expected 503", rec.Code)
+	}
+}
+
+func TestStaticETag(t *testing.T) {
+	router := mux.NewRouter()
+	handleStatic(router, fstest.MapFS{"css/style.css": {Data: []byte("body {}")}}, 60)
+	handleElmJS(router, []byte("elm code"), 60)
+
+	for _, path := range []string{"/static/css/style.css", "/elm.js"} {
+		t.Run(path, func(t *testing.T) {
+			resp := doRequest(router, "GET", path, "", false)
+			if resp.Code != 200 {
+				t.Fatalf("got status %d, expected 200", resp.Code)
+			}
+
+			etag := resp.Header().Get("ETag")
+			if etag == "" {
+				t.Fatalf("response has no ETag")
+			}
+
+			if got := resp.Header().Get("Cache-Control"); got != "public, max-age=60" {
+				t.Errorf("got Cache-Control %q, expected max-age=60", got)
+			}
+
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("If-None-Match", etag)
+			resp = httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusNotModified {
+				t.Errorf("got status %d for conditional request, expected 304", resp.Code)
+			}
+		})
+	}
+}
+
+func TestStaticETagChanges(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "style.css")
+	if err := os.WriteFile(file, []byte("body {}"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	router := mux.NewRouter()
+	handleStatic(router, os.DirFS(dir), 60)
+
+	first := doRequest(router, "GET", "/static/style.css", "", false).Header().Get("ETag")
+	if first == "" {
+		t.Fatalf("response has no ETag")
+	}
+
+	modTime := time.Now().Add(time.Hour)
+	if err := os.WriteFile(file, []byte("body {color: red}"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	second := doRequest(router, "GET", "/static/style.css", "", false).Header().Get("ETag")
+	if second == "" || second == first {
+		t.Errorf("got ETag %q after the file changed, expected a new one (old: %q)", second, first)
+	}
+
+	if etag := doRequest(router, "GET", "/static/missing.css", "", false).Header().Get("ETag"); etag != "" {
+		t.Errorf("got ETag %q for a missing file", etag)
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	router := mux.NewRouter()
+	handleElmJS(router, []byte("elm code"), 60)
+	handleIndex(router, []byte("<html></html>"))
+
+	for _, path := range []string{"/", "/bieter/123", "/elm.js"} {
+		t.Run(path, func(t *testing.T) {
+			resp := doRequest(router, "GET", path, "", false)
+			if resp.Code != 200 {
+				t.Fatalf("got status %d, expected 200", resp.Code)
+			}
+
+			lastModified := resp.Header().Get("Last-Modified")
+			if lastModified != defaultModTime.UTC().Format(http.TimeFormat) {
+				t.Fatalf("got Last-Modified %q, expected the time of the executable", lastModified)
+			}
+
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("If-Modified-Since", lastModified)
+			resp = httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusNotModified {
+				t.Errorf("got status %d for conditional request, expected 304", resp.Code)
+			}
+		})
+	}
+}
+
+func TestProfiling(t *testing.T) {
+	db := newTestDB(t)
+	config := DefaultConfig()
+	config.AdminPW = testAdminPW
+	config.EnableProfiling = true
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, DefaultFiles{Static: os.DirFS("..")})
+
+	for _, path := range []string{"/api/debug/pprof/", "/api/debug/pprof/goroutine", "/api/debug/pprof/cmdline"} {
+		if rec := doRequest(router, "GET", path, "", false); rec.Code != 401 {
+			t.Errorf("%s: got status %d without auth, expected 401", path, rec.Code)
+		}
+
+		if rec := doRequest(router, "GET", path, "", true); rec.Code != 200 {
+			t.Errorf("%s: got status %d as admin, expected 200: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(router, "GET", "/api/debug/pprof/goroutine?debug=1", "", true)
+	if !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Errorf("got %q, expected the goroutine profile", rec.Body.String()[:min(100, rec.Body.Len())])
+	}
+
+	if rec := doRequest(newTestRouter(t, db), "GET", "/api/debug/pprof/", "", true); rec.Code != 404 {
+		t.Errorf("got status %d with disabled profiling, expected 404", rec.Code)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		admin  bool
+		status int
+		code   string
+	}{
+		{"unknown bieter", "GET", "/api/bieter/unknown", "", false, 404, "BIETER_NOT_FOUND"},
+		{"offer in registration", "PUT", "/api/offer/" + id, `{"offer":5000}`, false, 400, "INVALID_STATE"},
+		{"wrong password", "GET", "/api/bieter", "", false, 401, "UNAUTHORIZED"},
+		{"invalid field", "PUT", "/api/bieter/" + id, `{"name":"hugo","mail":"hugo@example.com","verteilstelle":99}`, false, 400, "INVALID_FIELDS"},
+		{"set state", "PUT", "/api/state", `{"state":3}`, true, 200, ""},
+		{"offer too low", "PUT", "/api/offer/" + id, `{"offer":100}`, false, 400, "OFFER_TOO_LOW"},
+		{"unknown path", "GET", "/api/unknown", "", false, 404, "UNKNOWN_PATH"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(router, tt.method, tt.path, tt.body, tt.admin)
+			if resp.Code != tt.status {
+				t.Fatalf("got status %d, expected %d: %s", resp.Code, tt.status, resp.Body.String())
+			}
+
+			if tt.code == "" {
+				return
+			}
+
+			var body struct {
+				Error string `json:"error"`
+				Code  string `json:"code"`
+			}
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding error %q: %v", resp.Body.String(), err)
+			}
+
+			if body.Code != tt.code {
+				t.Errorf("got code %q, expected %q", body.Code, tt.code)
+			}
+
+			if body.Error == "" {
+				t.Errorf("error has no message")
+			}
+		})
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	padding := strings.Repeat(" ", int(DefaultConfig().MaxBodySize))
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"POST", "/api/bieter", `{"name":"hugo"` + padding + `}`},
+		{"PUT", "/api/bieter/" + id, `{"name":"hugo"` + padding + `}`},
+		{"PUT", "/api/offer/" + id, `{"offer":` + padding + `5000}`},
+		{"PUT", "/api/state", `{"state":` + padding + `2}`},
+	} {
+		resp := doRequest(router, tt.method, tt.path, tt.body, true)
+		if resp.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s %s: got status %d, expected 413: %s", tt.method, tt.path, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	for _, tt := range []struct {
+		contentType string
+		expect      int
+	}{
+		{"application/json", 200},
+		{"application/json; charset=utf-8", 200},
+		{"application/json; charset=", 200},
+		{"text/plain", 415},
+		{"application/x-www-form-urlencoded", 415},
+		{"application/json; charset=latin1", 415},
+		{"", 415},
+	} {
+		req := httptest.NewRequest("POST", "/api/bieter", strings.NewReader(`{"name":"hugo","mail":"hugo@example.com"}`))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != tt.expect {
+			t.Errorf("Content-Type %q: got status %d, expected %d: %s", tt.contentType, resp.Code, tt.expect, resp.Body.String())
+		}
+	}
+
+	if resp := doRequest(router, "GET", "/api/bieter", "", true); resp.Code != 200 {
+		t.Errorf("GET without Content-Type: got status %d, expected 200", resp.Code)
+	}
+}
+
+func TestPatchBieter(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com","verteilstelle":1}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	resp := doRequest(router, "PATCH", "/api/bieter/"+id, `{"verteilstelle":2}`, false)
+	if resp.Code != 200 {
+		t.Fatalf("got status %d, expected 200: %s", resp.Code, resp.Body.String())
+	}
+
+	payload, _ := db.Bieter(id)
+	var got map[string]interface{}
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("decoding payload: %v", err)
+	}
+
+	expect := map[string]interface{}{"name": "hugo", "mail": "hugo@example.com", "verteilstelle": float64(2)}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got payload %v, expected %v", got, expect)
+	}
+
+	resp = doRequest(router, "PATCH", "/api/bieter/"+id, `{"name":null}`, false)
+	if resp.Code != 400 {
+		t.Errorf("patch removing the name: got status %d, expected 400", resp.Code)
+	}
+
+	resp = doRequest(router, "PATCH", "/api/bieter/unknown", `{"verteilstelle":2}`, false)
+	if resp.Code != 404 {
+		t.Errorf("patch of unknown bieter: got status %d, expected 404", resp.Code)
+	}
+}
+
+func TestUpdateBieterVersion(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	put := func(body, version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/bieter/"+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", version)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var bieter ViewBieter
+	resp := doRequest(router, "GET", "/api/bieter/"+id, "", false)
+	if err := json.Unmarshal(resp.Body.Bytes(), &bieter); err != nil {
+		t.Fatalf("decoding bieter: %v", err)
+	}
+	if bieter.Version != 1 {
+		t.Fatalf("got version %d, expected 1", bieter.Version)
+	}
+
+	resp = put(`{"name":"erik","mail":"erik@example.com"}`, `"1"`)
+	if resp.Code != 200 {
+		t.Fatalf("update with current version: got status %d: %s", resp.Code, resp.Body.String())
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &bieter); err != nil {
+		t.Fatalf("decoding bieter: %v", err)
+	}
+	if bieter.Version != 2 {
+		t.Errorf("got version %d after update, expected 2", bieter.Version)
+	}
+
+	resp = put(`{"name":"otto","mail":"otto@example.com"}`, "1")
+	if resp.Code != 409 {
+		t.Errorf("update with stale version: got status %d, expected 409", resp.Code)
+	}
+
+	if payload, _ := db.Bieter(id); string(payload) != `{"name":"erik","mail":"erik@example.com"}` {
+		t.Errorf("stale update changed the payload to %s", payload)
+	}
+
+	if resp := put(`{"name":"otto","mail":"otto@example.com"}`, "abc"); resp.Code != 400 {
+		t.Errorf("update with invalid version: got status %d, expected 400", resp.Code)
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if resp := doRequest(router, "DELETE", "/api/bieter/"+id, "", true); resp.Code != 200 {
+		t.Fatalf("delete: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp := doRequest(router, "GET", "/api/bieter", "", true)
+	if strings.Contains(resp.Body.String(), id) {
+		t.Errorf("deleted bieter is in the list: %s", resp.Body.String())
+	}
+
+	if resp := doRequest(router, "GET", "/api/bieter/"+id, "", false); resp.Code != 404 {
+		t.Errorf("get deleted bieter: got status %d, expected 404", resp.Code)
+	}
+
+	if resp := doRequest(router, "POST", "/api/bieter/"+id+"/restore", "", false); resp.Code != 401 {
+		t.Errorf("restore without admin: got status %d, expected 401", resp.Code)
+	}
+
+	if resp := doRequest(router, "POST", "/api/bieter/"+id+"/restore", "", true); resp.Code != 200 {
+		t.Fatalf("restore: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = doRequest(router, "GET", "/api/bieter", "", true)
+	if !strings.Contains(resp.Body.String(), id) {
+		t.Errorf("restored bieter is not in the list: %s", resp.Body.String())
+	}
+
+	if offer := db.Offer(id); offer != 5000 {
+		t.Errorf("restored bieter has offer %d, expected 5000", offer)
+	}
+
+	if resp := doRequest(router, "POST", "/api/bieter/"+id+"/restore", "", true); resp.Code != 400 {
+		t.Errorf("restore of a bieter, that is not deleted: got status %d, expected 400", resp.Code)
+	}
+}
+
+func TestDeleteBieterWithOffer(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	// The offer is from the last round. The public can delete in the
+	// registration state.
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	rec := doRequest(router, "DELETE", "/api/bieter/"+id, "", false)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "HAS_OFFER") {
+		t.Fatalf("got status %d for public delete with offer, expected 400 with HAS_OFFER: %s", rec.Code, rec.Body.String())
+	}
+
+	if _, exist := db.Bieter(id); !exist || db.Offer(id) != 5000 {
+		t.Fatalf("public delete changed the bieter or the offer")
+	}
+
+	if rec := doRequest(router, "DELETE", "/api/bieter/"+id, "", true); rec.Code != 200 {
+		t.Fatalf("got status %d for admin delete: %s", rec.Code, rec.Body.String())
+	}
+
+	if offer := db.Offer(id); offer != 0 {
+		t.Errorf("deleted bieter has offer %d, expected 0", offer)
+	}
+
+	if resp := doRequest(router, "GET", "/api/bieter/count", "", true); !strings.Contains(resp.Body.String(), `"offers":0`) {
+		t.Errorf("offer of the deleted bieter is counted: %s", resp.Body.String())
+	}
+
+	if err := db.PurgeBieter(id); err != nil {
+		t.Fatalf("PurgeBieter: %v", err)
+	}
+
+	if _, ok := db.offer[id]; ok {
+		t.Errorf("offer was not removed with the purge")
+	}
+}
+
+func TestRenameBieter(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if rec := doRequest(router, "POST", "/api/bieter/"+id+"/rename", `{"id":"HUGO"}`, false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	rec := doRequest(router, "POST", "/api/bieter/"+id+"/rename", `{"id":"hugo"}`, true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got ViewBieter
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding bieter: %v", err)
+	}
+
+	if got.ID != "HUGO" || got.Offer != 5000 || !strings.Contains(string(got.Payload), "hugo") {
+		t.Errorf("got bieter %+v, expected HUGO with the old payload and offer", got)
+	}
+
+	if _, exist := db.Bieter(id); exist {
+		t.Errorf("bieter with the old id still exists")
+	}
+
+	if rec := doRequest(router, "GET", "/api/bieter/HUGO/qr.png", "", false); rec.Code != 200 {
+		t.Errorf("got status %d for the qr code of the new id", rec.Code)
+	}
+
+	if rec := doRequest(router, "GET", "/api/bieter/"+id+"/qr.png", "", false); rec.Code != 404 {
+		t.Errorf("got status %d for the qr code of the old id, expected 404", rec.Code)
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	if _, exist := db.Bieter(id); !exist || db.Offer(id) != 5000 {
+		t.Errorf("undo did not restore the old id with the offer")
+	}
+}
+
+func TestRenameBieterCollision(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	hugo, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	erik, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	rec := doRequest(router, "POST", "/api/bieter/"+hugo+"/rename", `{"id":"`+erik+`"}`, true)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "BIETER_EXISTS") {
+		t.Errorf("got status %d for an existing id, expected 400 with BIETER_EXISTS: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := doRequest(router, "POST", "/api/bieter/"+hugo+"/rename", `{"id":"../admin"}`, true); rec.Code != 400 {
+		t.Errorf("got status %d for an invalid id, expected 400", rec.Code)
+	}
+
+	if payload, _ := db.Bieter(hugo); !strings.Contains(string(payload), "hugo") {
+		t.Errorf("rejected rename changed the bieter")
+	}
+}
+
+func TestMergeBieter(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	target, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	duplicate, err := db.NewBieter([]byte(`{"name":"Hugo","adresse":"am bach","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.UpdateOffer(target, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	if err := db.UpdateOffer(duplicate, strings.NewReader(`{"offer":6500}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	body := `{"from":"` + duplicate + `","fields":["mail"]}`
+	if rec := doRequest(router, "POST", "/api/bieter/"+target+"/merge", body, false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	rec := doRequest(router, "POST", "/api/bieter/"+target+"/merge", body, true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	payload, _ := db.Bieter(target)
+	var fields map[string]string
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		t.Fatalf("decoding payload: %v", err)
+	}
+
+	expect := map[string]string{"name": "hugo", "adresse": "beim wald", "mail": "hugo@example.com"}
+	if !reflect.DeepEqual(fields, expect) {
+		t.Errorf("got payload %v, expected %v", fields, expect)
+	}
+
+	if offer := db.Offer(target); offer != 6500 {
+		t.Errorf("got offer %d, expected the higher offer 6500", offer)
+	}
+
+	if _, exist := db.Bieter(duplicate); exist {
+		t.Errorf("duplicate was not deleted")
+	}
+
+	events, err := db.EventLog()
+	if err != nil {
+		t.Fatalf("EventLog: %v", err)
+	}
+	if last := events[len(events)-1]; last.Name() != "merge" {
+		t.Errorf("last event is %q, expected one merge event", last.Name())
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	if _, exist := db.Bieter(duplicate); !exist || db.Offer(duplicate) != 6500 || db.Offer(target) != 5000 {
+		t.Errorf("undo did not restore both bieters with their offers")
+	}
+}
+
+func TestMergeBieterRounds(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	target, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	duplicate, err := db.NewBieter([]byte(`{"name":"Hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.UpdateOffer(target, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	if err := db.UpdateOffer(duplicate, strings.NewReader(`{"offer":6500}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	if err := db.ClearOffer(true); err != nil {
+		t.Fatalf("ClearOffer: %v", err)
+	}
+
+	body := `{"from":"` + duplicate + `"}`
+	if rec := doRequest(router, "POST", "/api/bieter/"+target+"/merge", body, true); rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	round := db.rounds[0]
+	if _, ok := round[duplicate]; ok {
+		t.Errorf("round still contains the merged bieter: %v", round)
+	}
+	if round[target] != 6500 {
+		t.Errorf("got round offer %d, expected the higher offer 6500", round[target])
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	round = db.rounds[0]
+	if round[duplicate] != 6500 || round[target] != 5000 {
+		t.Errorf("undo did not restore the round offers, got %v", round)
+	}
+}
+
+func TestMergeBieterInvalid(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	for _, from := range []string{id, "unknown"} {
+		rec := doRequest(router, "POST", "/api/bieter/"+id+"/merge", `{"from":"`+from+`"}`, true)
+		if rec.Code != 400 {
+			t.Errorf("got status %d for merge from %s, expected 400", rec.Code, from)
+		}
+	}
+
+	if _, exist := db.Bieter(id); !exist {
+		t.Errorf("invalid merge deleted the bieter")
+	}
+}
+
+func TestVerteilstellen(t *testing.T) {
+	db := newTestDB(t)
+
+	resp := doRequest(newTestRouter(t, db), "GET", "/api/verteilstellen", "", false)
+	var got []Verteilstelle
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding response %q: %v", resp.Body.String(), err)
+	}
+
+	if !reflect.DeepEqual(got, DefaultConfig().Verteilstellen) {
+		t.Errorf("got %v, expected the default verteilstellen", got)
+	}
+
+	config := DefaultConfig()
+	config.Verteilstellen = append(config.Verteilstellen, Verteilstelle{4, "Überauchen (Hof)"})
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, DefaultFiles{Static: os.DirFS("..")})
+
+	resp = doRequest(router, "GET", "/api/verteilstellen", "", false)
+	got = nil
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding response %q: %v", resp.Body.String(), err)
+	}
+
+	if len(got) != 4 || got[3] != (Verteilstelle{4, "Überauchen (Hof)"}) {
+		t.Errorf("got %v, expected the configured fourth verteilstelle", got)
+	}
+}
+
+func TestAbbuchungOptions(t *testing.T) {
+	resp := doRequest(newTestRouter(t, newTestDB(t)), "GET", "/api/abbuchung-options", "", false)
+	if resp.Code != 200 {
+		t.Fatalf("got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var got []AbbuchungOption
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding response %q: %v", resp.Body.String(), err)
+	}
+
+	expect := []AbbuchungOption{{0, "Monatlich"}, {1, "Jährlich"}}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v, expected %v", got, expect)
+	}
+}
+
+func TestImportOffers(t *testing.T) {
+	newBieter := func(t *testing.T, db *Database) string {
+		t.Helper()
+		id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		return id
+	}
+
+	decode := func(t *testing.T, resp *httptest.ResponseRecorder) []OfferResult {
+		t.Helper()
+		var body struct {
+			Results []OfferResult `json:"results"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		return body.Results
+	}
+
+	t.Run("clean batch", func(t *testing.T) {
+		db := newTestDB(t)
+		router := newTestRouter(t, db)
+		id1 := newBieter(t, db)
+		id2 := newBieter(t, db)
+
+		body := fmt.Sprintf(`[{"id":%q,"offer":5000},{"id":%q,"offer":6000}]`, id1, id2)
+		if resp := doRequest(router, "PUT", "/api/offers", body, false); resp.Code != 401 {
+			t.Errorf("without admin: got status %d, expected 401", resp.Code)
+		}
+
+		resp := doRequest(router, "PUT", "/api/offers", body, true)
+		if resp.Code != 200 {
+			t.Fatalf("got status %d: %s", resp.Code, resp.Body.String())
+		}
+
+		if got := decode(t, resp); len(got) != 2 || got[0].Error != "" || got[1].Error != "" {
+			t.Errorf("got results %v, expected two valid rows", got)
+		}
+
+		if db.Offer(id1) != 5000 || db.Offer(id2) != 6000 {
+			t.Errorf("got offers %d and %d, expected 5000 and 6000", db.Offer(id1), db.Offer(id2))
+		}
+	})
+
+	for _, tt := range []struct {
+		name       string
+		query      string
+		expectCode int
+		expectSave bool
+	}{
+		{"bad row", "", 400, false},
+		{"bad row partial", "?partial=true", 200, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			router := newTestRouter(t, db)
+			id1 := newBieter(t, db)
+			id2 := newBieter(t, db)
+
+			body := fmt.Sprintf(`[{"id":%q,"offer":5000},{"id":"unknown","offer":5000},{"id":%q,"offer":100}]`, id1, id2)
+			resp := doRequest(router, "PUT", "/api/offers"+tt.query, body, true)
+			if resp.Code != tt.expectCode {
+				t.Fatalf("got status %d, expected %d: %s", resp.Code, tt.expectCode, resp.Body.String())
+			}
+
+			got := decode(t, resp)
+			if len(got) != 3 {
+				t.Fatalf("got %d results, expected 3", len(got))
+			}
+			if got[0].Error != "" || got[1].Error == "" || got[2].Error == "" {
+				t.Errorf("got results %v, expected only the first row to be valid", got)
+			}
+
+			if saved := db.Offer(id1) == 5000; saved != tt.expectSave {
+				t.Errorf("valid row saved: %t, expected %t", saved, tt.expectSave)
+			}
+			if db.Offer(id2) != 0 {
+				t.Errorf("offer below the minimum was saved")
+			}
+		})
+	}
+}
+
+// failingStore fails to append after the given number of events.
+type failingStore struct {
+	eventStore
+	appends int
+}
+
+func (s *failingStore) append(event []byte) error {
+	if s.appends == 0 {
+		return errors.New("disk full")
+	}
+	s.appends--
+	return s.eventStore.append(event)
+}
+
+func TestImportOffersWriteError(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	db.store = &failingStore{eventStore: db.store, appends: 1}
+
+	body := fmt.Sprintf(`[{"id":%q,"offer":5000},{"id":%q,"offer":6000},{"id":%q,"offer":7000}]`, ids[0], ids[1], ids[2])
+	resp := doRequest(router, "PUT", "/api/offers", body, true)
+	if resp.Code != 500 {
+		t.Fatalf("got status %d, expected 500: %s", resp.Code, resp.Body.String())
+	}
+
+	var got struct {
+		Error   string        `json:"error"`
+		Results []OfferResult `json:"results"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	if len(got.Results) != 3 {
+		t.Fatalf("got %d results, expected 3", len(got.Results))
+	}
+	if !got.Results[0].Saved || got.Results[1].Saved || got.Results[2].Saved {
+		t.Errorf("got results %v, expected only the first row to be saved", got.Results)
+	}
+	if got.Results[1].Error == "" || got.Results[2].Error == "" {
+		t.Errorf("got results %v, expected an error for the rows, that were not saved", got.Results)
+	}
+
+	if db.Offer(ids[0]) != 5000 || db.Offer(ids[1]) != 0 {
+		t.Errorf("got offers %d and %d, expected 5000 and 0", db.Offer(ids[0]), db.Offer(ids[1]))
+	}
+}
+
+func TestReset(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if resp := doRequest(router, "POST", "/api/reset", `{"confirm":"reset"}`, false); resp.Code != 401 {
+		t.Errorf("without admin: got status %d, expected 401", resp.Code)
+	}
+
+	if resp := doRequest(router, "POST", "/api/reset", `{}`, true); resp.Code != 400 {
+		t.Errorf("without confirmation: got status %d, expected 400", resp.Code)
+	}
+
+	if len(db.BieterList()) != 1 {
+		t.Fatalf("data was removed without confirmation")
+	}
+
+	if resp := doRequest(router, "POST", "/api/reset", `{"confirm":"reset"}`, true); resp.Code != 200 {
+		t.Fatalf("reset: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if got := len(db.BieterList()); got != 0 {
+		t.Errorf("got %d bieters after reset, expected 0", got)
+	}
+	if got := db.Offer(id); got != 0 {
+		t.Errorf("got offer %d after reset, expected 0", got)
+	}
+	if got := db.State(); got != stateRegistration {
+		t.Errorf("got state %s after reset, expected %s", got, stateRegistration)
+	}
+
+	events, err := db.EventLog()
+	if err != nil {
+		t.Fatalf("EventLog: %v", err)
+	}
+	if last := events[len(events)-1]; last.Name() != "reset" {
+		t.Errorf("got last event %q, expected reset", last.Name())
+	}
+
+	if _, err := db.Undo(true); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	if _, exist := db.Bieter(id); !exist || db.Offer(id) != 5000 || db.State() != stateOffer {
+		t.Errorf("undo did not restore the data")
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	if resp := doRequest(router, "PUT", "/api/maintenance", `{"maintenance":true}`, false); resp.Code != 401 {
+		t.Errorf("switch without admin: got status %d, expected 401", resp.Code)
+	}
+
+	if resp := doRequest(router, "PUT", "/api/maintenance", `{"maintenance":true}`, true); resp.Code != 200 {
+		t.Fatalf("switch maintenance: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := doRequest(router, "POST", "/api/bieter", `{"name":"erik","mail":"erik@example.com"}`, false); resp.Code != 503 {
+		t.Errorf("create in maintenance: got status %d, expected 503", resp.Code)
+	}
+
+	if resp := doRequest(router, "GET", "/api/bieter/"+id, "", false); resp.Code != 200 {
+		t.Errorf("get in maintenance: got status %d, expected 200", resp.Code)
+	}
+
+	if resp := doRequest(router, "PUT", "/api/maintenance", `{"maintenance":false}`, true); resp.Code != 200 {
+		t.Fatalf("switch maintenance off: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := doRequest(router, "POST", "/api/bieter", `{"name":"erik","mail":"erik@example.com"}`, false); resp.Code != 200 {
+		t.Errorf("create after maintenance: got status %d, expected 200", resp.Code)
+	}
+}
+
+func TestBanner(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	getBanner := func() string {
+		t.Helper()
+		resp := doRequest(router, "GET", "/api/banner", "", false)
+		if resp.Code != 200 {
+			t.Fatalf("get banner: got status %d: %s", resp.Code, resp.Body.String())
+		}
+
+		var body struct {
+			Banner string `json:"banner"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding banner: %v", err)
+		}
+		return body.Banner
+	}
+
+	if got := getBanner(); got != "" {
+		t.Errorf("got banner %q, expected none", got)
+	}
+
+	if resp := doRequest(router, "PUT", "/api/banner", `{"banner":"Gebote bis 20:00"}`, false); resp.Code != 401 {
+		t.Errorf("set banner without admin: got status %d, expected 401", resp.Code)
+	}
+
+	if resp := doRequest(router, "PUT", "/api/banner", `{"banner":"Gebote bis 20:00"}`, true); resp.Code != 200 {
+		t.Fatalf("set banner: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if got := getBanner(); got != "Gebote bis 20:00" {
+		t.Errorf("got banner %q, expected %q", got, "Gebote bis 20:00")
+	}
+
+	reopened, err := NewDB(db.file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopen database: %v", err)
+	}
+	if got := reopened.Banner(); got != "Gebote bis 20:00" {
+		t.Errorf("got banner %q after reopening, expected %q", got, "Gebote bis 20:00")
+	}
+
+	if resp := doRequest(router, "PUT", "/api/banner", `{"banner":""}`, true); resp.Code != 200 {
+		t.Fatalf("clear banner: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if got := getBanner(); got != "" {
+		t.Errorf("got banner %q after clearing, expected none", got)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	resp := doRequest(router, "GET", "/api/openapi.json", "", false)
+	if resp.Code != 200 {
+		t.Fatalf("got status %d, expected 200", resp.Code)
+	}
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decoding spec: %v", err)
+	}
+
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("got openapi version %q, expected 3.x", spec.OpenAPI)
+	}
+
+	for _, path := range []string{"/bieter", "/bieter/{id}", "/bieter/{id}/pdf", "/offer/{id}", "/state"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec has no path %s", path)
+		}
+	}
+}
+
+func TestAPIv1(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	resp := doRequest(router, "POST", "/api/v1/bieter", `{"name":"hugo","mail":"hugo@example.com"}`, false)
+	if resp.Code != 200 {
+		t.Fatalf("create with v1: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var created ViewBieter
+	if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decoding bieter: %v", err)
+	}
+
+	v1 := doRequest(router, "GET", "/api/v1/bieter/"+created.ID, "", false)
+	legacy := doRequest(router, "GET", "/api/bieter/"+created.ID, "", false)
+
+	if v1.Code != 200 || legacy.Code != 200 {
+		t.Fatalf("got status %d for v1 and %d for legacy, expected 200", v1.Code, legacy.Code)
+	}
+
+	if v1.Body.String() != legacy.Body.String() {
+		t.Errorf("v1 response %s differs from legacy response %s", v1.Body.String(), legacy.Body.String())
+	}
+
+	if resp := doRequest(router, "GET", "/api/v1/bieter", "", true); resp.Code != 200 || !strings.Contains(resp.Body.String(), created.ID) {
+		t.Errorf("v1 bieter list: got status %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	db := newTestDB(t)
+	config := DefaultConfig()
+	config.AdminPW = testAdminPW
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, DefaultFiles{Index: []byte("<html>index</html>"), Static: os.DirFS("..")})
+
+	for _, path := range []string{"/api/does-not-exist", "/api/v1/does-not-exist"} {
+		resp := doRequest(router, "GET", path, "", false)
+		if resp.Code != 404 {
+			t.Errorf("%s: got status %d, expected 404", path, resp.Code)
+		}
+
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil || body.Error == "" {
+			t.Errorf("%s: got body %q, expected a json error", path, resp.Body.String())
+		}
+	}
+
+	resp := doRequest(router, "GET", "/some/spa/route", "", false)
+	if resp.Code != 200 || resp.Body.String() != "<html>index</html>" {
+		t.Errorf("spa route: got status %d with body %q, expected index.html", resp.Code, resp.Body.String())
+	}
+}
+
+func TestGetOffer(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	withOffer, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.UpdateOffer(withOffer, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	withoutOffer, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name         string
+		id           string
+		expectStatus int
+		expectBody   string
+	}{
+		{"with offer", withOffer, 200, "5000\n"},
+		{"without offer", withoutOffer, 200, "0\n"},
+		{"missing bieter", "unknown", 404, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(router, "GET", "/api/offer/"+tt.id, "", false)
+			if resp.Code != tt.expectStatus {
+				t.Fatalf("got status %d, expected %d", resp.Code, tt.expectStatus)
+			}
+
+			if tt.expectBody != "" && resp.Body.String() != tt.expectBody {
+				t.Errorf("got body %q, expected %q", resp.Body.String(), tt.expectBody)
+			}
+		})
+	}
+}
+
+func TestBieterQRCode(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	resp := doRequest(router, "GET", "/api/bieter/"+id+"/qr.png", "", false)
+	if resp.Code != 200 {
+		t.Fatalf("got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if got := resp.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("got Content-Type %q, expected image/png", got)
+	}
+
+	if resp.Header().Get("ETag") == "" {
+		t.Errorf("response has no ETag")
+	}
+
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("decoding png: %v", err)
+	}
+
+	if size := img.Bounds().Size(); size.X != qrCodeSize || size.Y != qrCodeSize {
+		t.Errorf("got image size %v, expected %dx%d", size, qrCodeSize, qrCodeSize)
+	}
+
+	if resp := doRequest(router, "GET", "/api/bieter/unknown/qr.png", "", false); resp.Code != 404 {
+		t.Errorf("unknown bieter: got status %d, expected 404", resp.Code)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if resp := doRequest(router, "GET", "/api/backup", "", false); resp.Code != 401 {
+		t.Errorf("without admin: got status %d, expected 401", resp.Code)
+	}
+
+	resp := doRequest(router, "GET", "/api/backup", "", true)
+	if resp.Code != 200 {
+		t.Fatalf("got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if got := resp.Header().Get("Content-Disposition"); !strings.Contains(got, "bieterrunde-backup-") {
+		t.Errorf("got Content-Disposition %q, expected a backup filename", got)
+	}
+
+	var got struct {
+		CreatedAt time.Time                  `json:"created_at"`
+		Bieter    map[string]json.RawMessage `json:"bieter"`
+		Times     map[string]BieterTimes     `json:"times"`
+		Offer     map[string]int             `json:"offer"`
+		State     ServiceState               `json:"state"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding backup: %v", err)
+	}
+
+	if got.CreatedAt.IsZero() {
+		t.Errorf("backup has no creation time")
+	}
+
+	if string(got.Bieter[id]) != `{"name":"hugo","mail":"hugo@example.com"}` {
+		t.Errorf("got bieter %s, expected hugo", got.Bieter[id])
+	}
+
+	if got.Times[id].CreatedAt.IsZero() {
+		t.Errorf("backup has no times of the bieter")
+	}
+
+	if got.Offer[id] != 5000 {
+		t.Errorf("got offer %d, expected 5000", got.Offer[id])
+	}
+
+	if got.State != stateOffer {
+		t.Errorf("got state %s, expected %s", got.State, stateOffer)
+	}
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if _, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true); err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), true); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	if err := db.SetBanner(strings.NewReader(`{"banner":"Wartung am Abend"}`)); err != nil {
+		t.Fatalf("SetBanner: %v", err)
+	}
+
+	original := db.BieterList()
+
+	resp := doRequest(router, "GET", "/api/backup", "", true)
+	if resp.Code != 200 {
+		t.Fatalf("backup: got status %d: %s", resp.Code, resp.Body.String())
+	}
+	backupBody := resp.Body.String()
+
+	if resp := doRequest(router, "POST", "/api/reset", `{"confirm":"reset"}`, true); resp.Code != 200 {
+		t.Fatalf("reset: got status %d: %s", resp.Code, resp.Body.String())
+	}
+	if err := db.SetBanner(strings.NewReader(`{"banner":""}`)); err != nil {
+		t.Fatalf("SetBanner: %v", err)
+	}
+
+	if resp := doRequest(router, "POST", "/api/restore", backupBody, true); resp.Code != 400 {
+		t.Errorf("restore without confirm: got status %d, expected 400", resp.Code)
+	}
+
+	for _, invalid := range []string{`{"bieter":{}}`, `{"bieter":{},"offer":{"X":5000},"state":1}`, `{"bieter":{},"offer":{},"state":9}`, `not json`} {
+		if resp := doRequest(router, "POST", "/api/restore?confirm=true", invalid, true); resp.Code != 400 {
+			t.Errorf("restore of %s: got status %d, expected 400", invalid, resp.Code)
+		}
+	}
+
+	if len(db.BieterList()) != 0 {
+		t.Fatalf("invalid backup changed the database")
+	}
+
+	if resp := doRequest(router, "POST", "/api/restore?confirm=true", backupBody, true); resp.Code != 200 {
+		t.Fatalf("restore: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if got := db.BieterList(); !reflect.DeepEqual(got, original) {
+		t.Errorf("got bieters %v after restore, expected %v", got, original)
+	}
+	if got := db.Offer(id); got != 5000 {
+		t.Errorf("got offer %d after restore, expected 5000", got)
+	}
+	if got := db.State(); got != stateOffer {
+		t.Errorf("got state %s after restore, expected %s", got, stateOffer)
+	}
+	if got := db.Banner(); got != "Wartung am Abend" {
+		t.Errorf("got banner %q after restore", got)
+	}
+
+	reopened, err := NewDB(db.file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopen database: %v", err)
+	}
+	if got := reopened.BieterList(); !reflect.DeepEqual(got, original) {
+		t.Errorf("got bieters %v after reopening, expected %v", got, original)
+	}
+	if got := reopened.Banner(); got != "Wartung am Abend" {
+		t.Errorf("got banner %q after reopening", got)
+	}
+}
+
+func TestSetStateDryRun(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	type dryRunState struct {
+		DryRun bool         `json:"dry_run"`
+		Valid  bool         `json:"valid"`
+		Error  string       `json:"error"`
+		Code   string       `json:"code"`
+		State  ServiceState `json:"state"`
+	}
+
+	for _, tt := range []struct {
+		name      string
+		from      ServiceState
+		body      string
+		valid     bool
+		expectNew ServiceState
+	}{
+		{"legal", stateRegistration, `{"state":3}`, true, stateOffer},
+		{"illegal", stateOffer, `{"state":2}`, false, stateOffer},
+		{"unknown state", stateOffer, `{"state":9}`, false, stateOffer},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db.state = tt.from
+			events := len(db.undo)
+
+			rec := doRequest(router, "PUT", "/api/state?dryRun=true", tt.body, true)
+			if rec.Code != 200 {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+			}
+
+			var got dryRunState
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+
+			if !got.DryRun || got.Valid != tt.valid || got.State != tt.expectNew {
+				t.Errorf("got %+v, expected valid %t and state %s", got, tt.valid, tt.expectNew)
+			}
+
+			if !tt.valid && (got.Error == "" || got.Code != "INVALID_STATE") {
+				t.Errorf("got error %q with code %q, expected a reason with INVALID_STATE", got.Error, got.Code)
+			}
+
+			if db.State() != tt.from {
+				t.Errorf("dry-run changed the state to %s", db.State())
+			}
+
+			if len(db.undo) != events {
+				t.Errorf("dry-run wrote an event")
+			}
+		})
+	}
+
+	if rec := doRequest(router, "PUT", "/api/state?dryRun=true", `not json`, true); rec.Code == 200 {
+		t.Errorf("got status 200 for dry-run with invalid body")
+	}
+
+	if rec := doRequest(router, "PUT", "/api/state?dryRun=true", `{"state":3}`, false); rec.Code != 403 {
+		t.Errorf("got status %d for dry-run without admin, expected 403", rec.Code)
+	}
+}
+
+func TestStateSummary(t *testing.T) {
+	config := DefaultConfig()
+	config.OfferDeadline = time.Date(2030, 3, 1, 12, 0, 0, 0, time.UTC)
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	var ids []string
+	for _, name := range []string{"hugo", "erik", "anna"} {
+		id, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	for _, id := range ids[:2] {
+		if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), false); err != nil {
+			t.Fatalf("UpdateOffer: %v", err)
+		}
+	}
+
+	rec := doRequest(newTestRouter(t, db), "GET", "/api/state", "", false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got struct {
+		State      int       `json:"state"`
+		Name       string    `json:"state_name"`
+		Round      int       `json:"round"`
+		Bieter     int       `json:"bieter_count"`
+		Offers     int       `json:"offer_count"`
+		OffersOpen bool      `json:"offers_open"`
+		Deadline   time.Time `json:"offer_deadline"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding state: %v", err)
+	}
+
+	if got.State != int(stateOffer) || got.Name != stateOffer.String() || got.Round != 1 {
+		t.Errorf("got state %d (%q) in round %d", got.State, got.Name, got.Round)
+	}
+
+	if got.Bieter != 3 || got.Offers != 2 {
+		t.Errorf("got %d bieters with %d offers, expected 3 with 2", got.Bieter, got.Offers)
+	}
+
+	if !got.OffersOpen {
+		t.Errorf("offers are not open in the offer state before the deadline")
+	}
+
+	if !got.Deadline.Equal(config.OfferDeadline) {
+		t.Errorf("got deadline %s, expected %s", got.Deadline, config.OfferDeadline)
+	}
+
+	if summary := db.Summary(config.OfferDeadline.Add(time.Minute)); summary.OffersOpen {
+		t.Errorf("offers are open after the deadline")
+	}
+}
+
+func TestStaticSources(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "css"), 0o755); err != nil {
+		t.Fatalf("creating dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "css", "style.css"), []byte("disk"), 0o644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	defaultFiles := DefaultFiles{Static: fstest.MapFS{"css/style.css": {Data: []byte("embedded")}}}
+
+	for _, tt := range []struct {
+		name    string
+		sources []string
+		expect  string
+	}{
+		{"disk first", []string{dir, staticEmbedded}, "disk"},
+		{"embedded first", []string{staticEmbedded, dir}, "embedded"},
+		{"override disabled", []string{staticEmbedded}, "embedded"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.StaticSources = tt.sources
+
+			router := mux.NewRouter()
+			registerHandlers(router, config, newTestDB(t), defaultFiles)
+
+			rec := doRequest(router, "GET", "/static/css/style.css", "", false)
+			if rec.Code != 200 {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+			}
+
+			if got := rec.Body.String(); got != tt.expect {
+				t.Errorf("got %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestMultiFS(t *testing.T) {
+	multi := MultiFS{fs: []fs.FS{
+		fstest.MapFS{
+			"css/style.css": {Data: []byte("first")},
+			"css/first.css": {Data: []byte("first")},
+		},
+		fstest.MapFS{
+			"css/style.css":   {Data: []byte("second")},
+			"css/second.css":  {Data: []byte("second")},
+			"images/logo.png": {Data: []byte("second")},
+		},
+	}}
+
+	if err := fstest.TestFS(multi, "css/style.css", "css/first.css", "css/second.css", "images/logo.png"); err != nil {
+		t.Fatalf("TestFS: %v", err)
+	}
+
+	bs, err := fs.ReadFile(multi, "images/logo.png")
+	if err != nil || string(bs) != "second" {
+		t.Errorf("got %q (%v) for file from the second source", bs, err)
+	}
+
+	if bs, _ := fs.ReadFile(multi, "css/style.css"); string(bs) != "first" {
+		t.Errorf("got %q for file in both sources, expected the first", bs)
+	}
+
+	entries, err := fs.ReadDir(multi, "css")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if expect := []string{"first.css", "second.css", "style.css"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("got entries %v, expected %v", names, expect)
+	}
+
+	if _, err := fs.Stat(multi, "unknown"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v for unknown file, expected ErrNotExist", err)
+	}
+}
+
+func TestEventExport(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id, strings.NewReader(`{"offer":5000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	if rec := doRequest(router, "GET", "/api/events.ndjson", "", false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	rec := doRequest(router, "GET", "/api/events.ndjson", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("got content type %q", ct)
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var line exportedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("decoding line %q: %v", scanner.Text(), err)
+		}
+
+		if line.Time.IsZero() || line.Actor == "" || len(line.Payload) == 0 {
+			t.Errorf("line %q is incomplete", scanner.Text())
+		}
+		names = append(names, line.Name)
+	}
+
+	if expect := []string{"update", "state", "offer"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("got events %v, expected %v", names, expect)
+	}
+}
+
+func TestEventImportRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	hugo, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	erik, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.DeleteBieter(erik, false); err != nil {
+		t.Fatalf("DeleteBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(hugo, strings.NewReader(`{"offer":5000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+	// Only an admin can change the bieter in the offer state.
+	if _, err := db.UpdateBieter(hugo, strings.NewReader(`{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald"}`), 0, true); err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+
+	router := newTestRouter(t, db)
+
+	rec := doRequest(router, "GET", "/api/events.ndjson", "", true)
+	if rec.Code != 200 {
+		t.Fatalf("export: got status %d: %s", rec.Code, rec.Body.String())
+	}
+	export := rec.Body.String()
+
+	bieter := maps.Clone(db.bieter)
+	offer := maps.Clone(db.offer)
+	state := db.state
+
+	if err := db.Reset(strings.NewReader(`{"confirm":"reset"}`), true); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+
+	if rec := doRequest(router, "POST", "/api/events/import", export, false); rec.Code != 401 {
+		t.Errorf("got status %d without auth, expected 401", rec.Code)
+	}
+
+	rec = doRequest(router, "POST", "/api/events/import", export, true)
+	if rec.Code != 200 {
+		t.Fatalf("import: got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result EventImport
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+
+	if result.Applied != 6 || len(result.Failed) != 0 {
+		t.Errorf("got %d applied and failures %v, expected 6 applied", result.Applied, result.Failed)
+	}
+
+	if !reflect.DeepEqual(db.bieter, bieter) {
+		t.Errorf("got bieter %q, expected %q", db.bieter, bieter)
+	}
+
+	if !reflect.DeepEqual(db.offer, offer) {
+		t.Errorf("got offers %v, expected %v", db.offer, offer)
+	}
+
+	if db.state != state {
+		t.Errorf("got state %s, expected %s", db.state, state)
+	}
+
+	if _, ok := db.deleted[erik]; !ok {
+		t.Errorf("bieter %s is not deleted after the import", erik)
+	}
+}
+
+func TestEventImportStream(t *testing.T) {
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+
+	srv := httptest.NewServer(newTestRouter(t, db))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/events/stream", nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connecting to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	line := `{"name":"offer","actor":"admin","payload":{"id":"` + id + `","offer":5000}}`
+	result, err := db.ImportEvents(strings.NewReader(line), false)
+	if err != nil {
+		t.Fatalf("ImportEvents: %v", err)
+	}
+	if result.Applied != 1 {
+		t.Fatalf("got result %v, expected one applied event", result)
+	}
+
+	got, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+
+	if expect := `data: {"type":"offer"}` + "\n"; got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestEventImportValidateOnly(t *testing.T) {
+	db := newTestDB(t)
+	events := strings.Join([]string{
+		`{"name":"update","payload":{"created_at":"2024-01-01T10:00:00Z","actor":"public","id":"ABC","payload":{"name":"hugo","mail":"hugo@example.com"}}}`,
+		`{"name":"state","payload":{"created_at":"2024-01-01T10:01:00Z","actor":"admin","state":3}}`,
+		`{"name":"offer","payload":{"created_at":"2024-01-01T10:02:00Z","actor":"public","id":"ABC","offer":5000}}`,
+		`{"name":"offer","payload":{"created_at":"2024-01-01T10:03:00Z","actor":"public","id":"unknown","offer":5000}}`,
+		`{"name":"unknown","payload":{}}`,
+		`not json`,
+	}, "\n")
+
+	rec := doRequest(newTestRouter(t, db), "POST", "/api/events/import?validateOnly=true", events, true)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result EventImport
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+
+	// The offer of the third line is only valid, because the first two
+	// lines were executed on the copy.
+	if result.Applied != 3 {
+		t.Errorf("got %d applied events, expected 3", result.Applied)
+	}
+
+	var failedLines []int
+	for _, f := range result.Failed {
+		failedLines = append(failedLines, f.Line)
+	}
+	if expect := []int{4, 5, 6}; !reflect.DeepEqual(failedLines, expect) {
+		t.Errorf("got failed lines %v, expected %v", failedLines, expect)
+	}
+
+	if len(db.bieter) != 0 || db.state != stateRegistration {
+		t.Errorf("validateOnly changed the database")
+	}
+
+	if events, err := db.EventLog(); err != nil || len(events) != 0 {
+		t.Errorf("validateOnly wrote %d events (%v)", len(events), err)
+	}
+}
+
+func TestBieterTrash(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	restored, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	purged, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	if resp := doRequest(router, "DELETE", "/api/bieter/"+restored, "", true); resp.Code != 200 {
+		t.Fatalf("delete: got status %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := doRequest(router, "DELETE", "/api/bieter/"+purged, "", false); resp.Code != 200 {
+		t.Fatalf("delete: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := doRequest(router, "GET", "/api/bieter/trash", "", false); resp.Code != 401 {
+		t.Errorf("trash without admin: got status %d, expected 401", resp.Code)
+	}
+
+	trash := func() map[string]TrashEntry {
+		t.Helper()
+
+		resp := doRequest(router, "GET", "/api/bieter/trash", "", true)
+		if resp.Code != 200 {
+			t.Fatalf("trash: got status %d: %s", resp.Code, resp.Body.String())
+		}
+
+		var entries []TrashEntry
+		if err := json.Unmarshal(resp.Body.Bytes(), &entries); err != nil {
+			t.Fatalf("decoding trash: %v", err)
+		}
+
+		byID := make(map[string]TrashEntry)
+		for _, e := range entries {
+			byID[e.ID] = e
+		}
+		return byID
+	}
+
+	entries := trash()
+	if len(entries) != 2 {
+		t.Fatalf("got %d bieters in the trash, expected 2", len(entries))
+	}
+
+	if e := entries[restored]; e.DeletedBy != "admin" || e.DeletedAt.IsZero() || !strings.Contains(string(e.Payload), "hugo") {
+		t.Errorf("got trash entry %+v", e)
+	}
+
+	if e := entries[purged]; e.DeletedBy != "public" {
+		t.Errorf("got actor %q, expected public", e.DeletedBy)
+	}
+
+	if resp := doRequest(router, "POST", "/api/bieter/"+restored+"/restore", "", true); resp.Code != 200 {
+		t.Fatalf("restore: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if _, ok := trash()[restored]; ok {
+		t.Errorf("restored bieter is still in the trash")
+	}
+
+	if resp := doRequest(router, "DELETE", "/api/bieter/"+purged+"/purge", "", false); resp.Code != 401 {
+		t.Errorf("purge without admin: got status %d, expected 401", resp.Code)
+	}
+
+	if resp := doRequest(router, "DELETE", "/api/bieter/"+restored+"/purge", "", true); resp.Code != 400 {
+		t.Errorf("purge of a bieter, that is not deleted: got status %d, expected 400", resp.Code)
+	}
+
+	if resp := doRequest(router, "DELETE", "/api/bieter/"+purged+"/purge", "", true); resp.Code != 200 {
+		t.Fatalf("purge: got status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if len(trash()) != 0 {
+		t.Errorf("trash is not empty after restore and purge")
+	}
+
+	if _, ok := db.bieter[purged]; ok {
+		t.Errorf("purged bieter is still in the database")
+	}
+
+	if resp := doRequest(router, "POST", "/api/bieter/"+purged+"/restore", "", true); resp.Code == 200 {
+		t.Errorf("purged bieter could be restored")
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import "sort"
+
+// histogramBucket counts the offers from From to To in cent, both included.
+type histogramBucket struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Count int `json:"count"`
+}
+
+// histogram is the distribution of the offers. It does not contain the ids
+// of the bieters, so it can be shown to the public.
+type histogram struct {
+	BucketSize int               `json:"bucket_size"`
+	Buckets    []histogramBucket `json:"buckets"`
+}
+
+// buildHistogram counts the offers in buckets of bucketSize cent.
+//
+// The buckets go from the lowest to the highest offer. Buckets between them
+// are also returned, if they are empty.
+func buildHistogram(offers []int, bucketSize int) histogram {
+	h := histogram{BucketSize: bucketSize, Buckets: []histogramBucket{}}
+	if len(offers) == 0 || bucketSize <= 0 {
+		return h
+	}
+
+	sorted := append([]int(nil), offers...)
+	sort.Ints(sorted)
+
+	first := sorted[0] / bucketSize
+	last := sorted[len(sorted)-1] / bucketSize
+	for i := first; i <= last; i++ {
+		h.Buckets = append(h.Buckets, histogramBucket{
+			From: i * bucketSize,
+			To:   (i+1)*bucketSize - 1,
+		})
+	}
+
+	for _, offer := range sorted {
+		h.Buckets[offer/bucketSize-first].Count++
+	}
+	return h
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBuildHistogram(t *testing.T) {
+	got := buildHistogram([]int{4000, 4499, 4500, 5600, 5999, 4200}, 500)
+
+	expect := histogram{
+		BucketSize: 500,
+		Buckets: []histogramBucket{
+			{From: 4000, To: 4499, Count: 3},
+			{From: 4500, To: 4999, Count: 1},
+			{From: 5000, To: 5499, Count: 0},
+			{From: 5500, To: 5999, Count: 2},
+		},
+	}
+
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v, expected %v", got, expect)
+	}
+}
+
+func TestBuildHistogramEmpty(t *testing.T) {
+	got := buildHistogram(nil, 500)
+	if len(got.Buckets) != 0 {
+		t.Errorf("got %d buckets, expected none", len(got.Buckets))
+	}
+}
+
+func TestOfferHistogram(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	var ids []string
+	for i, offer := range []int{5000, 5100, 6000, 0} {
+		id, err := db.NewBieter([]byte(`{"name":"bieter`+strconv.Itoa(i)+`","mail":"bieter`+strconv.Itoa(i)+`@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		ids = append(ids, id)
+
+		if offer == 0 {
+			continue
+		}
+		body := strings.NewReader(`{"offer":` + strconv.Itoa(offer) + `}`)
+		if err := db.UpdateOffer(id, body, true); err != nil {
+			t.Fatalf("UpdateOffer: %v", err)
+		}
+	}
+
+	rec := doRequest(router, "GET", "/api/offer/histogram", "", false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, id := range ids {
+		if strings.Contains(rec.Body.String(), id) {
+			t.Errorf("response contains bieter id %s: %s", id, rec.Body.String())
+		}
+	}
+
+	var got histogram
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding histogram: %v", err)
+	}
+
+	expect := histogram{
+		BucketSize: 500,
+		Buckets: []histogramBucket{
+			{From: 5000, To: 5499, Count: 2},
+			{From: 5500, To: 5999, Count: 0},
+			{From: 6000, To: 6499, Count: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v, expected %v", got, expect)
+	}
+}
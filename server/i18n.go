@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The languages of the messages for the client. German is the language of
+// the messages in the code. For the other languages, the messages are looked
+// up in translations.
+const (
+	langGerman = "de"
+	langFrench = "fr"
+)
+
+// translations are the messages for the client by language and message key.
+// The keys of error messages are the error codes.
+//
+// A translation does not contain the details of the German message like the
+// names of invalid fields.
+var translations = map[string]map[string]string{
+	langFrench: {
+		"INVALID_DATA":           "Données invalides",
+		"INVALID_FIELDS":         "Certains champs sont invalides",
+		"BAD_REQUEST":            "Requête invalide",
+		"UNAUTHORIZED":           "Mot de passe incorrect",
+		"FORBIDDEN":              "Accès refusé",
+		"NOT_ALLOWED":            "Action non autorisée",
+		"NOT_FOUND":              "Introuvable",
+		"UNKNOWN_PATH":           "Chemin d'API inconnu",
+		"CONFLICT":               "Conflit avec les données existantes",
+		"TOO_LARGE":              "La requête est trop grande",
+		"UNSUPPORTED_MEDIA_TYPE": "La requête doit être de type application/json",
+		"TOO_MANY_REQUESTS":      "Trop d'inscriptions. Veuillez réessayer plus tard",
+		"INTERNAL_ERROR":         "Erreur interne",
+		"UNAVAILABLE":            "Le service n'est pas disponible",
+		"STARTING":               "Le serveur est en train de démarrer",
+		"SHUTTING_DOWN":          "Le serveur est en train de s'arrêter",
+		"MAINTENANCE":            "Maintenance en cours : aucune donnée ne peut être modifiée pour le moment",
+		"ADMIN_IP_NOT_ALLOWED":   "L'accès administrateur n'est pas autorisé depuis cette adresse",
+		"BIETER_NOT_FOUND":       "Ce participant n'existe pas",
+		"BIETER_EXISTS":          "Ce numéro de participant existe déjà",
+		"INVALID_ID":             "Le numéro de participant ne peut contenir que des majuscules et des chiffres",
+		"BIETER_NOT_DELETED":     "Ce participant n'est pas supprimé",
+		"INVALID_MERGE":          "Un participant ne peut pas être fusionné avec lui-même",
+		"REGISTRATION_FULL":      "Les inscriptions sont complètes",
+		"FINISHED":               "Le tour d'enchères est terminé",
+		"DEADLINE_PASSED":        "Le délai pour les offres est dépassé",
+		"INVALID_STATE":          "Cette action n'est pas possible dans l'état actuel",
+		"HAS_OFFER":              "Après avoir fait une offre, l'inscription ne peut plus être supprimée. Veuillez contacter le tour d'enchères",
+		"VERSION_CONFLICT":       "Le participant a été modifié entre-temps",
+		"INVALID_VERSION":        "Version invalide dans l'en-tête If-Match",
+		"INVALID_OFFER":          "L'offre est invalide",
+		"INVALID_OFFERS":         "Au moins une offre est invalide. Aucune offre n'a été enregistrée",
+		"OFFER_TOO_LOW":          "L'offre est trop basse",
+		"NO_PREVIOUS_ROUND":      "Il n'y a pas de tour précédent",
+		"NOTHING_TO_UNDO":        "Il n'y a rien à annuler",
+		"CONFIRMATION_REQUIRED":  "Une confirmation est nécessaire",
+		"BANNER_TOO_LONG":        "La bannière est trop longue",
+		"MAIL_DISABLED":          "Aucun serveur de messagerie n'est configuré",
+		"NO_MAIL_ADDRESS":        "Le participant n'a pas d'adresse e-mail",
+		"MAIL_EXISTS":            "Une inscription existe déjà avec cette adresse e-mail. Veuillez vous connecter avec votre numéro de participant",
+		"UNKNOWN_FIELDS":         "L'inscription contient des champs inconnus",
+		"SPAM":                   "L'inscription a été détectée comme spam",
+		"INVALID_BACKUP":         "La sauvegarde est invalide",
+
+		"LOOKUP_SENT": "S'il existe une inscription avec cette adresse e-mail, vous recevrez un message.",
+	},
+}
+
+// translate returns the message with the key in the language. If there is
+// no translation, german is returned.
+func translate(lang, key, german string) string {
+	if msg, ok := translations[lang][key]; ok {
+		return msg
+	}
+	return german
+}
+
+// requestLanguage returns the language from the Accept-Language header, that
+// has the highest quality and is supported. Without a supported language,
+// German is returned.
+func requestLanguage(r *http.Request) string {
+	type candidate struct {
+		lang    string
+		quality float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if lang != langGerman && translations[lang] == nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = v
+		}
+
+		if quality > 0 {
+			candidates = append(candidates, candidate{lang, quality})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return langGerman
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	return candidates[0].lang
+}
+
+// languageWriter keeps the language of the request, so handleError can use
+// it.
+type languageWriter struct {
+	http.ResponseWriter
+	lang string
+}
+
+// Flush is needed for the event stream.
+func (w *languageWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *languageWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// languageMiddleware saves the language of the request in the
+// ResponseWriter.
+//
+// The middlewares after it have to pass the ResponseWriter unchanged, so the
+// handlers get the languageWriter.
+func languageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&languageWriter{w, requestLanguage(r)}, r)
+	})
+}
+
+// responseLanguage returns the language, that was saved by the
+// languageMiddleware.
+func responseLanguage(w http.ResponseWriter) string {
+	if lw, ok := w.(*languageWriter); ok {
+		return lw.lang
+	}
+	return langGerman
+}
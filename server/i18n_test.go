@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLanguage(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		expect string
+	}{
+		{"", langGerman},
+		{"fr", langFrench},
+		{"fr-CH, fr;q=0.9, en;q=0.8", langFrench},
+		{"en-US,en;q=0.9", langGerman},
+		{"de-DE,fr;q=0.5", langGerman},
+		{"en;q=0.9, fr;q=0.8, de;q=0.7", langFrench},
+		{"fr;q=0", langGerman},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", tt.header)
+		if got := requestLanguage(req); got != tt.expect {
+			t.Errorf("Accept-Language %q: got %q, expected %q", tt.header, got, tt.expect)
+		}
+	}
+}
+
+func TestTranslatedError(t *testing.T) {
+	router := newTestRouter(t, newTestDB(t))
+
+	for _, tt := range []struct {
+		lang   string
+		expect string
+	}{
+		{"fr", "Ce participant n'existe pas"},
+		{"fr-CH,de;q=0.5", "Ce participant n'existe pas"},
+		{"en", "Bieter existiert nicht"},
+		{"", "Bieter existiert nicht"},
+	} {
+		req := httptest.NewRequest("GET", "/api/bieter/unknown", nil)
+		req.Header.Set("Accept-Language", tt.lang)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var body struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding error %q: %v", resp.Body.String(), err)
+		}
+
+		if body.Error != tt.expect {
+			t.Errorf("Accept-Language %q: got %q, expected %q", tt.lang, body.Error, tt.expect)
+		}
+
+		if body.Code != "BIETER_NOT_FOUND" {
+			t.Errorf("Accept-Language %q: got code %q", tt.lang, body.Code)
+		}
+	}
+}
+
+func TestTranslationsHaveAllCodes(t *testing.T) {
+	for _, status := range []int{400, 401, 403, 404, 409, 413, 415, 429, 500, 503} {
+		code := statusErrorCode(status)
+		if _, ok := translations[langFrench][code]; !ok {
+			t.Errorf("no french translation for %s", code)
+		}
+	}
+}
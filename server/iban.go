@@ -0,0 +1,65 @@
+package server
+
+import (
+	"strings"
+)
+
+// ibanLength is the length of an IBAN in the SEPA countries.
+var ibanLength = map[string]int{
+	"AD": 24, "AT": 20, "BE": 16, "BG": 22, "CH": 21, "CY": 28, "CZ": 24,
+	"DE": 22, "DK": 18, "EE": 20, "ES": 24, "FI": 18, "FR": 27, "GB": 22,
+	"GI": 23, "GR": 27, "HR": 21, "HU": 28, "IE": 22, "IS": 26, "IT": 27,
+	"LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MT": 31, "NL": 18,
+	"NO": 15, "PL": 28, "PT": 25, "RO": 24, "SE": 24, "SI": 19, "SK": 24,
+	"SM": 27, "VA": 22,
+}
+
+// normalizeIBAN removes all spaces and returns the IBAN in upper case.
+func normalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// formatIBAN returns the IBAN in groups of four characters, for example
+// "DE89 3704 0044 0532 0130 00".
+func formatIBAN(iban string) string {
+	iban = normalizeIBAN(iban)
+
+	var groups []string
+	for len(iban) > 4 {
+		groups = append(groups, iban[:4])
+		iban = iban[4:]
+	}
+	if iban != "" {
+		groups = append(groups, iban)
+	}
+	return strings.Join(groups, " ")
+}
+
+// validIBAN checks the country, the length and the checksum of a normalized
+// IBAN.
+func validIBAN(iban string) bool {
+	if len(iban) < 4 {
+		return false
+	}
+
+	length, ok := ibanLength[iban[:2]]
+	if !ok || len(iban) != length {
+		return false
+	}
+
+	// The first four characters are moved to the end. Each letter is replaced
+	// by two digits (A=10, B=11, ...). The resulting number modulo 97 has to
+	// be 1.
+	var mod int
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			mod = (mod*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			mod = (mod*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return mod == 1
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidIBAN(t *testing.T) {
+	for _, tt := range []struct {
+		iban  string
+		valid bool
+	}{
+		{"DE89370400440532013000", true},
+		{"DE02120300000000202051", true},
+		{"AT611904300234573201", true},
+		{"DE89370400440532013001", false},
+		{"DE8937040044053201300", false},
+		{"XX89370400440532013000", false},
+		{"DE89-70400440532013000", false},
+		{"", false},
+	} {
+		if got := validIBAN(tt.iban); got != tt.valid {
+			t.Errorf("validIBAN(%q) = %t, expected %t", tt.iban, got, tt.valid)
+		}
+	}
+}
+
+func TestIBANNormalized(t *testing.T) {
+	db := newTestDB(t)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com","IBAN":"de89 3704 0044 0532 0130 00"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	payload, _ := db.Bieter(id)
+	var got struct {
+		IBAN string `json:"IBAN"`
+	}
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("decoding payload: %v", err)
+	}
+
+	if got.IBAN != "DE89370400440532013000" {
+		t.Errorf("got IBAN %q, expected DE89370400440532013000", got.IBAN)
+	}
+}
+
+func TestIBANInvalidChecksum(t *testing.T) {
+	db := newTestDB(t)
+
+	_, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com","IBAN":"DE89370400440532013001"}`), false)
+	if err == nil || !strings.Contains(err.Error(), "IBAN (ungültig)") {
+		t.Errorf("got error %v, expected invalid IBAN", err)
+	}
+}
+
+func TestFormatIBAN(t *testing.T) {
+	for iban, expect := range map[string]string{
+		"DE89370400440532013000":      "DE89 3704 0044 0532 0130 00",
+		"de89 3704 0044 0532 0130 00": "DE89 3704 0044 0532 0130 00",
+		"AT611904300234573201":        "AT61 1904 3002 3457 3201",
+		"":                            "",
+	} {
+		if got := formatIBAN(iban); got != expect {
+			t.Errorf("formatIBAN(%q) = %q, expected %q", iban, got, expect)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig is the server, that sends the mails. Mails are only sent, if
+// Host is set.
+type SMTPConfig struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	User     string `toml:"user"`
+	Password string `toml:"password"`
+
+	// From is the sender address of the mails.
+	From string `toml:"from"`
+}
+
+func (c SMTPConfig) enabled() bool {
+	return c.Host != ""
+}
+
+// smtpSendMail sends a mail. It can be replaced in tests.
+var smtpSendMail = smtp.SendMail
+
+// mailMessage is a mail to one recipient.
+type mailMessage struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []mailAttachment
+}
+
+// mailAttachment is a file, that is attached to a mail.
+type mailAttachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// mailer sends mails with the smtp server from the config.
+type mailer struct {
+	config SMTPConfig
+}
+
+// newMailer returns a mailer or nil, if no smtp server is configured.
+func newMailer(config SMTPConfig) *mailer {
+	if !config.enabled() {
+		return nil
+	}
+	return &mailer{config: config}
+}
+
+// send sends the message and waits until the smtp server accepted it.
+func (m *mailer) send(msg mailMessage) error {
+	bs, err := msg.encode(m.config.From, time.Now())
+	if err != nil {
+		return fmt.Errorf("encoding mail: %w", err)
+	}
+
+	port := m.config.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if m.config.User != "" {
+		auth = smtp.PlainAuth("", m.config.User, m.config.Password, m.config.Host)
+	}
+
+	if err := smtpSendMail(addr, auth, m.config.From, []string{msg.To}, bs); err != nil {
+		return fmt.Errorf("sending mail: %w", err)
+	}
+	return nil
+}
+
+// sendAsync sends the message in the background. Errors are only logged, so
+// a broken smtp server does not break the request, that triggered the mail.
+//
+// It does nothing, if m is nil.
+func (m *mailer) sendAsync(msg mailMessage) {
+	if m == nil {
+		return
+	}
+
+	go func() {
+		if err := m.send(msg); err != nil {
+			log.Printf("Error: sending mail %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// encode returns the message in the format of RFC 5322. With attachments,
+// the mail is a multipart/mixed message.
+func (msg mailMessage) encode(from string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", from},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+	}
+
+	var mw *multipart.Writer
+	if len(msg.Attachments) == 0 {
+		headers = append(headers,
+			[2]string{"Content-Type", "text/plain; charset=utf-8"},
+			[2]string{"Content-Transfer-Encoding", "quoted-printable"},
+		)
+	} else {
+		mw = multipart.NewWriter(&buf)
+		headers = append(headers, [2]string{"Content-Type", "multipart/mixed; boundary=" + mw.Boundary()})
+	}
+
+	var head bytes.Buffer
+	for _, header := range headers {
+		if strings.ContainsAny(header[1], "\r\n") {
+			return nil, fmt.Errorf("header %s contains a line break", header[0])
+		}
+		fmt.Fprintf(&head, "%s: %s\r\n", header[0], header[1])
+	}
+	head.WriteString("\r\n")
+
+	if mw == nil {
+		if err := writeQuotedPrintable(&buf, msg.Body); err != nil {
+			return nil, err
+		}
+		return append(head.Bytes(), buf.Bytes()...), nil
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating text part: %w", err)
+	}
+	if err := writeQuotedPrintable(part, msg.Body); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating part for %s: %w", a.Name, err)
+		}
+
+		if err := writeBase64Lines(part, a.Content); err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", a.Name, err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("closing multipart: %w", err)
+	}
+	return append(head.Bytes(), buf.Bytes()...), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return fmt.Errorf("encoding body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("encoding body: %w", err)
+	}
+	return nil
+}
+
+// writeBase64Lines writes content as base64 with lines of 76 characters as
+// required by RFC 2045.
+func writeBase64Lines(w io.Writer, content []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 0 {
+		n := min(76, len(encoded))
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// confirmationMail returns the mail, that is sent after a bieter registered.
+// It returns false, if the bieter has no mail address.
+func confirmationMail(id string, payload json.RawMessage, config Config) (mailMessage, bool) {
+	var data struct {
+		Name string `json:"name"`
+		Mail string `json:"mail"`
+	}
+	json.Unmarshal(payload, &data)
+
+	if strings.TrimSpace(data.Mail) == "" {
+		return mailMessage{}, false
+	}
+
+	body := fmt.Sprintf(`Hallo %s,
+
+vielen Dank für deine Anmeldung zur Bieterrunde.
+
+Deine Bieternummer ist: %s
+
+Mit diesem Link kommst du direkt zu deiner Anmeldung:
+%s
+
+%s
+`, data.Name, id, bieterURL(config.domain(), id), config.Org.Name)
+
+	return mailMessage{
+		To:      strings.TrimSpace(data.Mail),
+		Subject: "Deine Anmeldung zur Bieterrunde",
+		Body:    body,
+	}, true
+}
+
+// contractMail returns the mail for the bietervertrag without the
+// attachment. It returns false, if the bieter has no mail address.
+func contractMail(id string, payload json.RawMessage, config Config) (mailMessage, bool) {
+	var data struct {
+		Name string `json:"name"`
+		Mail string `json:"mail"`
+	}
+	json.Unmarshal(payload, &data)
+
+	if strings.TrimSpace(data.Mail) == "" {
+		return mailMessage{}, false
+	}
+
+	body := fmt.Sprintf(`Hallo %s,
+
+im Anhang ist dein Bietervertrag mit der Bieternummer %s.
+
+%s
+`, data.Name, id, config.Org.Name)
+
+	return mailMessage{
+		To:      strings.TrimSpace(data.Mail),
+		Subject: "Dein Bietervertrag",
+		Body:    body,
+	}, true
+}
+
+// lookupMail returns the mail, that is sent, when a bieter looks up the id
+// with the mail address.
+func lookupMail(id string, mailAddr string, config Config) mailMessage {
+	body := fmt.Sprintf(`Hallo,
+
+deine Bieternummer ist: %s
+
+Mit diesem Link kommst du direkt zu deiner Anmeldung:
+%s
+
+Wenn du nicht nach deiner Bieternummer gefragt hast, kannst du diese
+Nachricht ignorieren.
+
+%s
+`, id, bieterURL(config.domain(), id), config.Org.Name)
+
+	return mailMessage{
+		To:      strings.TrimSpace(mailAddr),
+		Subject: "Deine Bieternummer",
+		Body:    body,
+	}
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sentMail is a mail, that was given to the mock smtp transport.
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  []byte
+}
+
+// mockSMTP replaces the smtp transport until the end of the test. All mails
+// are written to the returned channel. If err is not nil, it is returned for
+// each mail.
+func mockSMTP(t *testing.T, err error) <-chan sentMail {
+	t.Helper()
+
+	sent := make(chan sentMail, 10)
+	original := smtpSendMail
+	smtpSendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent <- sentMail{addr, from, to, msg}
+		return err
+	}
+	t.Cleanup(func() { smtpSendMail = original })
+	return sent
+}
+
+func waitForMail(t *testing.T, sent <-chan sentMail) sentMail {
+	t.Helper()
+
+	select {
+	case m := <-sent:
+		return m
+	case <-time.After(time.Second):
+		t.Fatalf("no mail was sent")
+		return sentMail{}
+	}
+}
+
+// decodeMail returns the decoded subject and body of a mail.
+func decodeMail(t *testing.T, raw []byte) (subject string, body string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("reading mail: %v", err)
+	}
+
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("decoding subject: %v", err)
+	}
+
+	bs, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	return subject, string(bs)
+}
+
+func newMailTestRouter(t *testing.T, db *Database) *mux.Router {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.AdminPW = testAdminPW
+	config.SMTP = SMTPConfig{Host: "smtp.example.com", Port: 25, From: "bieterrunde@example.com"}
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, DefaultFiles{Static: os.DirFS("..")})
+	return router
+}
+
+func TestConfirmationMail(t *testing.T) {
+	sent := mockSMTP(t, nil)
+	db := newTestDB(t)
+	router := newMailTestRouter(t, db)
+
+	rec := doRequest(router, "POST", "/api/bieter", `{"name":"Jürgen","mail":"juergen@example.com"}`, false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ids := db.BieterByMail("juergen@example.com")
+	if len(ids) != 1 {
+		t.Fatalf("got %d bieters, expected 1", len(ids))
+	}
+	id := ids[0]
+
+	m := waitForMail(t, sent)
+
+	if m.addr != "smtp.example.com:25" {
+		t.Errorf("got smtp address %q", m.addr)
+	}
+
+	if m.from != "bieterrunde@example.com" {
+		t.Errorf("got sender %q", m.from)
+	}
+
+	if len(m.to) != 1 || m.to[0] != "juergen@example.com" {
+		t.Errorf("got recipients %v, expected juergen@example.com", m.to)
+	}
+
+	subject, body := decodeMail(t, m.msg)
+	if subject != "Deine Anmeldung zur Bieterrunde" {
+		t.Errorf("got subject %q", subject)
+	}
+
+	for _, expect := range []string{"Hallo Jürgen", id, "http://localhost:9600/bieter/" + id} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("body does not contain %q:\n%s", expect, body)
+		}
+	}
+}
+
+// newTestDBWithoutMail returns a database, where the mail address is not
+// required.
+func newTestDBWithoutMail(t *testing.T) *Database {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.RequiredFields = []string{"name"}
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	return db
+}
+
+func TestConfirmationMailWithoutAddress(t *testing.T) {
+	sent := mockSMTP(t, nil)
+	router := newMailTestRouter(t, newTestDBWithoutMail(t))
+
+	if rec := doRequest(router, "POST", "/api/bieter", `{"name":"hugo"}`, false); rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case <-sent:
+		t.Errorf("a mail was sent to a bieter without mail address")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestConfirmationMailSMTPDown(t *testing.T) {
+	sent := mockSMTP(t, errors.New("connection refused"))
+	router := newMailTestRouter(t, newTestDB(t))
+
+	rec := doRequest(router, "POST", "/api/bieter", `{"name":"hugo","mail":"hugo@example.com"}`, false)
+	if rec.Code != 200 {
+		t.Errorf("got status %d with broken smtp server, expected 200: %s", rec.Code, rec.Body.String())
+	}
+
+	waitForMail(t, sent)
+}
+
+func TestLookupMail(t *testing.T) {
+	sent := mockSMTP(t, nil)
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	router := newMailTestRouter(t, db)
+
+	rec := doRequest(router, "POST", "/api/bieter/lookup", `{"mail":"HUGO@example.com"}`, false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	m := waitForMail(t, sent)
+	if len(m.to) != 1 || m.to[0] != "HUGO@example.com" {
+		t.Errorf("got recipients %v", m.to)
+	}
+
+	_, body := decodeMail(t, m.msg)
+	if !strings.Contains(body, id) {
+		t.Errorf("body does not contain the id %s:\n%s", id, body)
+	}
+}
+
+func TestMailHeaderInjection(t *testing.T) {
+	msg := mailMessage{To: "hugo@example.com\r\nBcc: other@example.com", Subject: "Test", Body: "Test"}
+	if _, err := msg.encode("from@example.com", time.Now()); err == nil {
+		t.Errorf("encode with a line break in the recipient did not return an error")
+	}
+}
+
+func TestEmailPDF(t *testing.T) {
+	sent := mockSMTP(t, nil)
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	router := newMailTestRouter(t, db)
+
+	rec := doRequest(router, "POST", "/api/bieter/"+id+"/email-pdf", "", false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	m := waitForMail(t, sent)
+	if len(m.to) != 1 || m.to[0] != "hugo@example.com" {
+		t.Errorf("got recipients %v, expected hugo@example.com", m.to)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.msg))
+	if err != nil {
+		t.Fatalf("reading mail: %v", err)
+	}
+
+	if to := msg.Header.Get("To"); to != "hugo@example.com" {
+		t.Errorf("got To header %q", to)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("got content type %q, expected multipart/mixed", msg.Header.Get("Content-Type"))
+	}
+
+	var attachments []*multipart.Part
+	var contents [][]byte
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+
+		if part.FileName() == "" {
+			continue
+		}
+
+		content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatalf("decoding attachment: %v", err)
+		}
+		attachments = append(attachments, part)
+		contents = append(contents, content)
+	}
+
+	if len(attachments) != 1 {
+		t.Fatalf("got %d attachments, expected 1", len(attachments))
+	}
+
+	if name := attachments[0].FileName(); name != "bietervertrag-"+id+".pdf" {
+		t.Errorf("got file name %q", name)
+	}
+
+	if ct := attachments[0].Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pdf") {
+		t.Errorf("got attachment content type %q", ct)
+	}
+
+	if !bytes.HasPrefix(contents[0], []byte("%PDF")) {
+		t.Errorf("attachment is not a pdf, starts with %q", contents[0][:min(10, len(contents[0]))])
+	}
+}
+
+func TestEmailPDFErrors(t *testing.T) {
+	mockSMTP(t, nil)
+	db := newTestDBWithoutMail(t)
+	withoutMail, err := db.NewBieter([]byte(`{"name":"hugo"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	withMail, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	router := newMailTestRouter(t, db)
+
+	if rec := doRequest(router, "POST", "/api/bieter/unknown/email-pdf", "", false); rec.Code != 404 {
+		t.Errorf("got status %d for unknown bieter, expected 404", rec.Code)
+	}
+
+	if rec := doRequest(router, "POST", "/api/bieter/"+withoutMail+"/email-pdf", "", true); rec.Code != 400 {
+		t.Errorf("got status %d for bieter without mail, expected 400", rec.Code)
+	}
+
+	// Without smtp config.
+	if rec := doRequest(newTestRouter(t, db), "POST", "/api/bieter/"+withMail+"/email-pdf", "", true); rec.Code != 503 {
+		t.Errorf("got status %d without smtp server, expected 503", rec.Code)
+	}
+}
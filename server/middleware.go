@@ -0,0 +1,369 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type contextKey int
+
+const (
+	contextKeyRequestID contextKey = iota
+)
+
+// requestID returns the id of the request or an empty string, if the request
+// has no id.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyRequestID).(string)
+	return id
+}
+
+const headerRequestID = "X-Request-Id"
+
+// requestIDMiddleware adds an id to each request. It uses the header
+// X-Request-Id, if the client sends it.
+//
+// The id is saved in the request context and returned in the response header.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestID)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+
+		w.Header().Set(headerRequestID, id)
+		ctx := context.WithValue(r.Context(), contextKeyRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms.
+		panic(fmt.Sprintf("creating request id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// newLogger creates a structured logger. format can be "json" or "text".
+func newLogger(w io.Writer, format string) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, nil))
+	}
+	return slog.New(slog.NewTextHandler(w, nil))
+}
+
+type responselogger struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *responselogger) WriteHeader(h int) {
+	r.code = h
+	r.ResponseWriter.WriteHeader(h)
+}
+
+// Flush is needed for the event stream.
+func (r *responselogger) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func loggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			writer := responselogger{w, 200}
+			next.ServeHTTP(&writer, r)
+
+			logger.Info(
+				"request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", writer.code,
+				"duration", time.Since(start),
+				"remote_addr", r.RemoteAddr,
+				"request_id", requestID(r.Context()),
+			)
+		})
+	}
+}
+
+// corsMiddleware allows the origins to use the api from a browser.
+//
+// It has to wrap the router, because the router does not call its
+// middlewares for OPTIONS requests without a matching route. Without
+// origins, it does nothing.
+func corsMiddleware(origins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(origins) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if !containsString(origins, origin) {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+			if !preflight {
+				w.Header().Set("Access-Control-Expose-Headers", headerRequestID)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Auth, Content-Type, If-Match")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// securityHeadersMiddleware sets headers, that tell the browser to be
+// careful with the responses.
+//
+// Strict-Transport-Security is only sent over https. Without
+// config.SecurityHeaders, it does nothing.
+func securityHeadersMiddleware(config Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !config.SecurityHeaders {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+
+			// The bieter id is in the url, so it must not be sent to other
+			// hosts.
+			w.Header().Set("Referrer-Policy", "same-origin")
+
+			if config.ContentSecurityPolicy != "" {
+				w.Header().Set("Content-Security-Policy", config.ContentSecurityPolicy)
+			}
+
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errMaintenance is returned for writing requests in maintenance mode.
+var errMaintenance = clientError{msg: "Wartungsarbeiten: Zur Zeit können keine Daten geändert werden", status: 503, code: "MAINTENANCE"}
+
+// maintenanceMiddleware rejects all api requests, that are not GET or HEAD,
+// while the database is in maintenance mode.
+//
+// The requests to switch the maintenance mode and the requests of other
+// campaigns are always passed.
+func maintenanceMiddleware(db *Database) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !db.Maintenance() ||
+				r.Method == "GET" ||
+				r.Method == "HEAD" ||
+				!strings.HasPrefix(r.URL.Path, pathPrefixAPI+"/") ||
+				strings.HasPrefix(r.URL.Path, pathPrefixCampaign+"/") ||
+				r.URL.Path == pathPrefixAPI+"/maintenance" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			handleError(w, errMaintenance)
+		})
+	}
+}
+
+// gzipMinSize is the minimal size of a response, that is compressed.
+const gzipMinSize = 1024
+
+// gzipMiddleware compresses responses, if the client supports it.
+//
+// Small responses and content types, that are already compressed, are send
+// uncompressed.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if r.Method == "HEAD" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip returns true, if the client accepts gzip. Only q=0 rejects it.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(name) != "q" {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of the response until it knows, if
+// the response should be compressed.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) >= gzipMinSize {
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush is needed for the event stream.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide writes the header and the buffered content.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	compress = compress &&
+		compressible(h.Get("Content-Type")) &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		w.status != http.StatusPartialContent
+
+	if compress {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// compressible returns false for content types, that are already compressed
+// or streamed.
+func compressible(contentType string) bool {
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+
+	for _, prefix := range []string{"image/", "audio/", "video/"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+
+	switch contentType {
+	case "application/pdf", "application/zip", "application/gzip", "text/event-stream":
+		return false
+	}
+	return true
+}
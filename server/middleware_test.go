@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	buf := new(bytes.Buffer)
+	handler := loggingMiddleware(newLogger(buf, "json"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/bieter/123?foo=bar", nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyRequestID, "abc"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decoding log line %q: %v", buf.String(), err)
+	}
+
+	for field, expect := range map[string]interface{}{
+		"method":      "GET",
+		"path":        "/api/bieter/123",
+		"status":      float64(404),
+		"remote_addr": "192.0.2.1:1234",
+		"request_id":  "abc",
+	} {
+		if got := entry[field]; got != expect {
+			t.Errorf("got %s=%v, expected %v", field, got, expect)
+		}
+	}
+
+	if _, ok := entry["duration"]; !ok {
+		t.Errorf("log entry has no duration")
+	}
+}
+
+func TestLoggerTextFormat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	newLogger(buf, "text").Info("request", "method", "GET")
+
+	if got := buf.String(); !bytes.Contains(buf.Bytes(), []byte("method=GET")) {
+		t.Errorf("got %q, expected text format", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	router := newTestRouter(t, newTestDB(t))
+	rec := doRequest(router, "GET", "/api/bieter/unknown", "", false)
+
+	id := rec.Header().Get("X-Request-Id")
+	if id == "" {
+		t.Fatalf("response has no X-Request-Id header")
+	}
+
+	var body struct {
+		Error     string `json:"error"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding error body: %v", err)
+	}
+
+	if body.RequestID != id {
+		t.Errorf("got request id %q in body, expected %q", body.RequestID, id)
+	}
+
+	if !strings.Contains(logs.String(), "Error: request "+id+":") {
+		t.Errorf("log %q does not contain the request id %q", logs.String(), id)
+	}
+}
+
+func TestRequestIDFromClient(t *testing.T) {
+	router := newTestRouter(t, newTestDB(t))
+
+	req := httptest.NewRequest("GET", "/api/healthz", nil)
+	req.Header.Set("X-Request-Id", "my-id")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-Id"); got != "my-id" {
+		t.Errorf("got request id %q, expected my-id", got)
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"name":"hugo","mail":"hugo@example.com"},`, 200)
+
+	for _, tt := range []struct {
+		name        string
+		acceptGzip  bool
+		contentType string
+		body        string
+		expectGzip  bool
+	}{
+		{"large json", true, "application/json", large, true},
+		{"no accept header", false, "application/json", large, false},
+		{"small response", true, "application/json", `{"name":"hugo","mail":"hugo@example.com"}`, false},
+		{"pdf", true, "application/pdf", large, false},
+		{"png", true, "image/png", large, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(201)
+				w.Write([]byte(tt.body))
+			}))
+
+			req := httptest.NewRequest("GET", "/api/bieter", nil)
+			if tt.acceptGzip {
+				req.Header.Set("Accept-Encoding", "gzip, deflate")
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			if resp.Code != 201 {
+				t.Errorf("got status %d, expected 201", resp.Code)
+			}
+
+			gotGzip := resp.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.expectGzip {
+				t.Fatalf("got Content-Encoding %q, expected gzip: %t", resp.Header().Get("Content-Encoding"), tt.expectGzip)
+			}
+
+			body := resp.Body.Bytes()
+			if gotGzip {
+				r, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("gzip reader: %v", err)
+				}
+				body, err = io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("reading gzip body: %v", err)
+				}
+			}
+
+			if string(body) != tt.body {
+				t.Errorf("got body with %d bytes, expected %d bytes", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		expect bool
+	}{
+		{"gzip", true},
+		{"gzip, deflate", true},
+		{"deflate, gzip;q=0.5", true},
+		{"gzip;q=0.01", true},
+		{"gzip;q=1.0", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.000", false},
+		{"deflate", false},
+		{"", false},
+	} {
+		req := httptest.NewRequest("GET", "/api/bieter", nil)
+		req.Header.Set("Accept-Encoding", tt.header)
+
+		if got := acceptsGzip(req); got != tt.expect {
+			t.Errorf("acceptsGzip(%q) = %t, expected %t", tt.header, got, tt.expect)
+		}
+	}
+}
+
+func TestGzipMiddlewareLogsStatus(t *testing.T) {
+	buf := new(bytes.Buffer)
+	handler := loggingMiddleware(newLogger(buf, "json"))(gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(strings.Repeat("x", 2*gzipMinSize)))
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decoding log line %q: %v", buf.String(), err)
+	}
+
+	if entry["status"] != float64(404) {
+		t.Errorf("got status %v, expected 404", entry["status"])
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	db := newTestDB(t)
+	handler := corsMiddleware([]string{"http://localhost:8000"})(newTestRouter(t, db))
+
+	for _, tt := range []struct {
+		name         string
+		origin       string
+		expectStatus int
+		expectOrigin string
+	}{
+		{"allowed origin", "http://localhost:8000", 204, "http://localhost:8000"},
+		{"disallowed origin", "http://evil.example", 403, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/api/bieter", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "auth, content-type")
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			if resp.Code != tt.expectStatus {
+				t.Errorf("got status %d, expected %d", resp.Code, tt.expectStatus)
+			}
+
+			if got := resp.Header().Get("Access-Control-Allow-Origin"); got != tt.expectOrigin {
+				t.Errorf("got Access-Control-Allow-Origin %q, expected %q", got, tt.expectOrigin)
+			}
+
+			if tt.expectOrigin == "" {
+				return
+			}
+
+			if got := resp.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Auth") || !strings.Contains(got, "Content-Type") {
+				t.Errorf("got Access-Control-Allow-Headers %q, expected Auth and Content-Type", got)
+			}
+
+			if got := resp.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("got Access-Control-Allow-Credentials %q, expected true", got)
+			}
+		})
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	db := newTestDB(t)
+	handler := corsMiddleware([]string{"http://localhost:8000"})(newTestRouter(t, db))
+
+	for _, tt := range []struct {
+		origin       string
+		expectOrigin string
+	}{
+		{"http://localhost:8000", "http://localhost:8000"},
+		{"http://evil.example", ""},
+	} {
+		req := httptest.NewRequest("GET", "/api/verteilstellen", nil)
+		req.Header.Set("Origin", tt.origin)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != 200 {
+			t.Errorf("origin %s: got status %d, expected 200", tt.origin, resp.Code)
+		}
+
+		if got := resp.Header().Get("Access-Control-Allow-Origin"); got != tt.expectOrigin {
+			t.Errorf("origin %s: got Access-Control-Allow-Origin %q, expected %q", tt.origin, got, tt.expectOrigin)
+		}
+	}
+}
+
+func TestCORSWithoutOrigins(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("OPTIONS", "/api/bieter", nil)
+	req.Header.Set("Origin", "http://localhost:8000")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp := httptest.NewRecorder()
+	corsMiddleware(nil)(next).ServeHTTP(resp, req)
+
+	if got := resp.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("got Access-Control-Allow-Origin %q without configured origins", got)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := securityHeadersMiddleware(DefaultConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+
+	for header, expect := range map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         "same-origin",
+		"Content-Security-Policy": DefaultConfig().ContentSecurityPolicy,
+	} {
+		if got := resp.Header().Get(header); got != expect {
+			t.Errorf("got %s %q, expected %q", header, got, expect)
+		}
+	}
+
+	if got := resp.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("got Strict-Transport-Security %q over http", got)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "https://example.com/", nil))
+	if got := resp.Header().Get("Strict-Transport-Security"); got == "" {
+		t.Errorf("response over https has no Strict-Transport-Security header")
+	}
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	config := DefaultConfig()
+	config.SecurityHeaders = false
+	handler := securityHeadersMiddleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "https://example.com/", nil))
+
+	for _, header := range []string{"X-Content-Type-Options", "Content-Security-Policy", "Strict-Transport-Security"} {
+		if got := resp.Header().Get(header); got != "" {
+			t.Errorf("got %s %q with disabled security headers", header, got)
+		}
+	}
+}
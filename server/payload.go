@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// payloadFields are the raw values of the known fields of a bieter payload.
+//
+// The field names are the same as in pdfData.
+type payloadFields struct {
+	Name          json.RawMessage `json:"name"`
+	Mail          json.RawMessage `json:"mail"`
+	Verteilstelle json.RawMessage `json:"verteilstelle"`
+	Abbuchung     json.RawMessage `json:"abbuchung"`
+	Kontoinhaber  json.RawMessage `json:"kontoinhaber"`
+	Adresse       json.RawMessage `json:"adresse"`
+	IBAN          json.RawMessage `json:"IBAN"`
+}
+
+func (f payloadFields) byName() map[string]json.RawMessage {
+	return map[string]json.RawMessage{
+		"name":          f.Name,
+		"mail":          f.Mail,
+		"verteilstelle": f.Verteilstelle,
+		"abbuchung":     f.Abbuchung,
+		"kontoinhaber":  f.Kontoinhaber,
+		"adresse":       f.Adresse,
+		"IBAN":          f.IBAN,
+	}
+}
+
+// FieldLengths are the maximal number of characters of the text fields of a
+// bieter payload. 0 means, that the field has no limit.
+type FieldLengths struct {
+	Name         int `toml:"name"`
+	Mail         int `toml:"mail"`
+	Kontoinhaber int `toml:"kontoinhaber"`
+	Adresse      int `toml:"adresse"`
+	IBAN         int `toml:"IBAN"`
+}
+
+func (l FieldLengths) byName() map[string]int {
+	return map[string]int{
+		"name":         l.Name,
+		"mail":         l.Mail,
+		"kontoinhaber": l.Kontoinhaber,
+		"adresse":      l.Adresse,
+		"IBAN":         l.IBAN,
+	}
+}
+
+// The values of Config.UnknownFields.
+const (
+	unknownFieldsKeep   = "keep"
+	unknownFieldsStrip  = "strip"
+	unknownFieldsReject = "reject"
+)
+
+// sanitizePayload removes or rejects the fields of the payload, that are not
+// in payloadFields. With unknownFieldsKeep or an unchanged payload, the
+// payload is returned as it is.
+//
+// A payload, that is not a JSON object, is returned unchanged. It is rejected
+// by validatePayload.
+func sanitizePayload(payload json.RawMessage, mode string) (json.RawMessage, error) {
+	if mode == unknownFieldsKeep || mode == "" {
+		return payload, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(payload, &fields) != nil {
+		return payload, nil
+	}
+
+	known := payloadFields{}.byName()
+	var unknown []string
+	for name := range fields {
+		if _, ok := known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return payload, nil
+	}
+
+	if mode == unknownFieldsReject {
+		sort.Strings(unknown)
+		return nil, validationError{msg: "Unbekannte Felder: " + strings.Join(unknown, ", "), code: "UNKNOWN_FIELDS"}
+	}
+
+	for _, name := range unknown {
+		delete(fields, name)
+	}
+
+	sanitized, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("encoding sanitized payload: %w", err)
+	}
+	return sanitized, nil
+}
+
+// validatePayload checks, that the bieter payload can be used as pdfData.
+//
+// All fields in config.RequiredFields have to be set. Returns a
+// validationError that lists all invalid fields.
+func validatePayload(payload json.RawMessage, config Config) error {
+	var fields payloadFields
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return validationError{msg: "Ungültige Daten übergeben"}
+	}
+
+	var invalid []string
+
+	byName := fields.byName()
+	for _, name := range config.RequiredFields {
+		if isEmptyValue(byName[name]) {
+			invalid = append(invalid, fmt.Sprintf("%s (fehlt)", name))
+		}
+	}
+
+	maxLength := config.MaxLength.byName()
+	for _, name := range []string{"name", "mail", "kontoinhaber", "adresse", "IBAN"} {
+		if !isNull(byName[name]) && !isString(byName[name]) {
+			invalid = append(invalid, fmt.Sprintf("%s (kein Text)", name))
+			continue
+		}
+
+		var value string
+		json.Unmarshal(byName[name], &value)
+		if limit := maxLength[name]; limit > 0 && utf8.RuneCountInString(value) > limit {
+			invalid = append(invalid, fmt.Sprintf("%s (zu lang, höchstens %d Zeichen)", name, limit))
+		}
+	}
+
+	var mailAddr string
+	if json.Unmarshal(fields.Mail, &mailAddr) == nil && strings.TrimSpace(mailAddr) != "" {
+		if !validMail(mailAddr) {
+			invalid = append(invalid, "mail (keine gültige E-Mail-Adresse)")
+		}
+	}
+
+	var iban string
+	if json.Unmarshal(fields.IBAN, &iban) == nil && strings.TrimSpace(iban) != "" {
+		if !validIBAN(normalizeIBAN(iban)) {
+			invalid = append(invalid, "IBAN (ungültig)")
+		}
+	}
+
+	if !isNull(fields.Verteilstelle) {
+		var v int
+		if err := json.Unmarshal(fields.Verteilstelle, &v); err != nil {
+			invalid = append(invalid, "verteilstelle (ungültiger Wert)")
+		} else if _, ok := config.verteilstelle(v); !ok {
+			invalid = append(invalid, "verteilstelle (unbekannte Verteilstelle)")
+		}
+	}
+
+	if !isNull(fields.Abbuchung) {
+		var a int
+		if err := json.Unmarshal(fields.Abbuchung, &a); err != nil {
+			invalid = append(invalid, "abbuchung (ungültiger Wert)")
+		} else if _, ok := config.abbuchung(a); !ok {
+			invalid = append(invalid, "abbuchung (unbekannte Abbuchung)")
+		}
+	}
+
+	if len(invalid) > 0 {
+		return validationError{msg: "Ungültige Felder: " + strings.Join(invalid, ", "), code: "INVALID_FIELDS"}
+	}
+	return nil
+}
+
+// normalizePayload returns the payload with a normalized IBAN.
+//
+// If the payload can not be decoded, it is returned unchanged.
+func normalizePayload(payload json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(payload, &fields) != nil {
+		return payload
+	}
+
+	var iban string
+	if json.Unmarshal(fields["IBAN"], &iban) != nil {
+		return payload
+	}
+
+	normalized := normalizeIBAN(iban)
+	if normalized == iban {
+		return payload
+	}
+
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		return payload
+	}
+	fields["IBAN"] = encoded
+
+	bs, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return bs
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to the payload.
+func mergePatch(payload, patch json.RawMessage) (json.RawMessage, error) {
+	var decodedPatch interface{}
+	if err := decodeJSONNumber(patch, &decodedPatch); err != nil {
+		return nil, validationError{msg: "Ungültige Daten übergeben"}
+	}
+
+	var decodedPayload interface{}
+	if err := decodeJSONNumber(payload, &decodedPayload); err != nil {
+		return nil, fmt.Errorf("decoding payload: %w", err)
+	}
+
+	bs, err := json.Marshal(mergeValue(decodedPayload, decodedPatch))
+	if err != nil {
+		return nil, fmt.Errorf("encoding patched payload: %w", err)
+	}
+	return bs, nil
+}
+
+// mergeValue merges a decoded patch into a decoded value.
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// decodeJSONNumber decodes json and keeps numbers as json.Number.
+func decodeJSONNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// validMail returns true, if the value is a plain mail address like
+// hugo@example.com.
+//
+// Plus addressing and umlauts are allowed. Display names like
+// "Hugo <hugo@example.com>" are not allowed.
+func validMail(value string) bool {
+	value = strings.TrimSpace(value)
+
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Name != "" || addr.Address != value {
+		return false
+	}
+
+	domain := addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+	return strings.Contains(strings.Trim(domain, "."), ".")
+}
+
+// validateUniqueMail returns a validationError, if another bieter than id
+// uses the same mail address.
+func validateUniqueMail(db *Database, id string, payload json.RawMessage) error {
+	mailAddr := payloadMail(payload)
+	if mailAddr == "" {
+		return nil
+	}
+
+	for otherID, otherPayload := range db.bieter {
+		if otherID == id || !db.exists(otherID) {
+			continue
+		}
+
+		if payloadMail(otherPayload) == mailAddr {
+			return validationError{msg: "Mit dieser E-Mail-Adresse gibt es schon eine Anmeldung. Bitte melde dich mit deiner Bieternummer an", code: "MAIL_EXISTS"}
+		}
+	}
+	return nil
+}
+
+// payloadMail returns the mail address of a payload in lower case and
+// without spaces.
+func payloadMail(payload json.RawMessage) string {
+	var fields struct {
+		Mail string `json:"mail"`
+	}
+	if json.Unmarshal(payload, &fields) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(fields.Mail))
+}
+
+// isNull returns true, if the value was not set or is null.
+func isNull(v json.RawMessage) bool {
+	return len(v) == 0 || bytes.Equal(v, []byte("null"))
+}
+
+// isEmptyValue returns true, if the value is null or an empty string.
+func isEmptyValue(v json.RawMessage) bool {
+	if isNull(v) {
+		return true
+	}
+
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return strings.TrimSpace(s) == ""
+	}
+	return false
+}
+
+func isString(v json.RawMessage) bool {
+	var s string
+	return json.Unmarshal(v, &s) == nil
+}
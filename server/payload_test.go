@@ -0,0 +1,328 @@
+package server
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePayload(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		payload     string
+		expectError string
+	}{
+		{
+			"valid",
+			`{"name":"hugo","mail":"hugo@example.com","verteilstelle":1,"abbuchung":1}`,
+			"",
+		},
+		{
+			"missing mail",
+			`{"name":"hugo"}`,
+			"mail (fehlt)",
+		},
+		{
+			"missing name",
+			`{"mail":"hugo@example.com"}`,
+			"name (fehlt)",
+		},
+		{
+			"empty name",
+			`{"name":"  "}`,
+			"name (fehlt)",
+		},
+		{
+			"verteilstelle out of range",
+			`{"name":"hugo","verteilstelle":4}`,
+			"verteilstelle",
+		},
+		{
+			"verteilstelle not a number",
+			`{"name":"hugo","verteilstelle":"Villingen"}`,
+			"verteilstelle",
+		},
+		{
+			"invalid abbuchung",
+			`{"name":"hugo","abbuchung":99}`,
+			"abbuchung",
+		},
+		{
+			"not an object",
+			`[1,2,3]`,
+			"Ungültige Daten",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePayload([]byte(tt.payload), DefaultConfig())
+
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("validatePayload returned: %v", err)
+				}
+				return
+			}
+
+			var errValidation validationError
+			if !errors.As(err, &errValidation) {
+				t.Fatalf("got error %v, expected validationError", err)
+			}
+
+			if !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("got error %q, expected it to contain %q", err.Error(), tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidatePayloadConfiguredRequired(t *testing.T) {
+	config := DefaultConfig()
+	config.RequiredFields = []string{"name", "IBAN"}
+
+	err := validatePayload([]byte(`{"name":"hugo"}`), config)
+	if err == nil || !strings.Contains(err.Error(), "IBAN (fehlt)") {
+		t.Errorf("got error %v, expected missing IBAN", err)
+	}
+}
+
+func TestNewBieterValidatesPayload(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.NewBieter([]byte(`{"mail":"hugo@example.com"}`), false); err == nil {
+		t.Errorf("NewBieter without name did not return an error")
+	}
+
+	if len(db.BieterList()) != 0 {
+		t.Errorf("invalid bieter was saved")
+	}
+}
+
+func TestDuplicateMail(t *testing.T) {
+	config := DefaultConfig()
+	config.UniqueMail = true
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	_, err = db.NewBieter([]byte(`{"name":"hugo2","mail":" HUGO@example.com "}`), false)
+	var errValidation validationError
+	if !errors.As(err, &errValidation) {
+		t.Errorf("NewBieter with duplicate mail returned %v, expected a validationError", err)
+	}
+
+	if _, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), false); err != nil {
+		t.Errorf("NewBieter with unique mail: %v", err)
+	}
+
+	if _, err := db.UpdateBieter(id, strings.NewReader(`{"name":"hugo","mail":"Hugo@example.com"}`), 0, false); err != nil {
+		t.Errorf("updating the bieter with its own mail: %v", err)
+	}
+
+	if _, err := db.NewBieter([]byte(`{"name":"hugo2","mail":"hugo@example.com"}`), true); err != nil {
+		t.Errorf("NewBieter with duplicate mail as admin: %v", err)
+	}
+}
+
+func TestValidateMail(t *testing.T) {
+	for _, tt := range []struct {
+		mail  string
+		valid bool
+	}{
+		{"hugo@example.com", true},
+		{"hugo+bieterrunde@example.com", true},
+		{"hugo@müller.de", true},
+		{"  hugo@example.com ", true},
+		{"hugo", false},
+		{"hugo@", false},
+		{"hugo@example", false},
+		{"hugo @example.com", false},
+		{"Hugo <hugo@example.com>", false},
+	} {
+		payload := `{"name":"hugo","mail":"` + tt.mail + `"}`
+		err := validatePayload([]byte(payload), DefaultConfig())
+
+		if tt.valid && err != nil {
+			t.Errorf("mail %q returned: %v", tt.mail, err)
+		}
+
+		if !tt.valid && (err == nil || !strings.Contains(err.Error(), "keine gültige E-Mail-Adresse")) {
+			t.Errorf("mail %q returned %v, expected invalid mail", tt.mail, err)
+		}
+	}
+}
+
+func TestValidateMailEmpty(t *testing.T) {
+	for _, payload := range []string{`{"name":"hugo","mail":""}`, `{"name":"hugo","mail":"  "}`, `{"name":"hugo"}`} {
+		err := validatePayload([]byte(payload), DefaultConfig())
+
+		var errValidation validationError
+		if !errors.As(err, &errValidation) || !strings.Contains(err.Error(), "mail (fehlt)") {
+			t.Errorf("got error %v for %s, expected missing mail", err, payload)
+		}
+	}
+
+	config := DefaultConfig()
+	config.RequiredFields = []string{"name"}
+
+	if err := validatePayload([]byte(`{"name":"hugo","mail":""}`), config); err != nil {
+		t.Errorf("empty mail, that is not required, returned: %v", err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, tt := range []struct {
+		payload string
+		patch   string
+		expect  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{`{"a":1}`, `{"b":12345678901234567890}`, `{"a":1,"b":12345678901234567890}`},
+	} {
+		got, err := mergePatch([]byte(tt.payload), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("mergePatch(%s, %s): %v", tt.payload, tt.patch, err)
+			continue
+		}
+
+		if string(got) != tt.expect {
+			t.Errorf("mergePatch(%s, %s) = %s, expected %s", tt.payload, tt.patch, got, tt.expect)
+		}
+	}
+}
+
+func TestValidatePayloadConfiguredVerteilstelle(t *testing.T) {
+	payload := []byte(`{"name":"hugo","mail":"hugo@example.com","verteilstelle":4}`)
+
+	if err := validatePayload(payload, DefaultConfig()); err == nil {
+		t.Errorf("unknown verteilstelle 4 did not return an error")
+	}
+
+	config := DefaultConfig()
+	config.Verteilstellen = append(config.Verteilstellen, Verteilstelle{4, "Überauchen (Hof)"})
+	if err := validatePayload(payload, config); err != nil {
+		t.Errorf("configured verteilstelle 4 returned: %v", err)
+	}
+}
+
+func TestValidatePayloadConfiguredAbbuchung(t *testing.T) {
+	payload := []byte(`{"name":"hugo","mail":"hugo@example.com","abbuchung":1}`)
+
+	if err := validatePayload(payload, DefaultConfig()); err != nil {
+		t.Errorf("default abbuchung 1 returned: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.Abbuchungen = []AbbuchungOption{{0, "Monatlich"}}
+	err := validatePayload(payload, config)
+
+	var errValidation validationError
+	if !errors.As(err, &errValidation) {
+		t.Fatalf("got error %v for abbuchung outside the options, expected validationError", err)
+	}
+}
+
+func TestSanitizePayload(t *testing.T) {
+	payload := []byte(`{"name":"hugo","mail":"hugo@example.com","blob":"xxxxxxxx","extra":{"a":1}}`)
+
+	got, err := sanitizePayload(payload, unknownFieldsKeep)
+	if err != nil || string(got) != string(payload) {
+		t.Errorf("keep returned %s (%v), expected the unchanged payload", got, err)
+	}
+
+	got, err = sanitizePayload(payload, unknownFieldsStrip)
+	if err != nil {
+		t.Fatalf("strip returned: %v", err)
+	}
+	if expect := `{"mail":"hugo@example.com","name":"hugo"}`; string(got) != expect {
+		t.Errorf("strip returned %s, expected %s", got, expect)
+	}
+
+	_, err = sanitizePayload(payload, unknownFieldsReject)
+	var errValidation validationError
+	if !errors.As(err, &errValidation) || errValidation.errorCode() != "UNKNOWN_FIELDS" {
+		t.Errorf("reject returned %v, expected a validationError with UNKNOWN_FIELDS", err)
+	}
+	if !strings.Contains(err.Error(), "blob, extra") {
+		t.Errorf("error %q does not list the unknown fields", err)
+	}
+
+	known := []byte(`{"name":"hugo","IBAN":"DE02120300000000202051"}`)
+	if got, err := sanitizePayload(known, unknownFieldsReject); err != nil || string(got) != string(known) {
+		t.Errorf("reject of known fields returned %s (%v), expected the unchanged payload", got, err)
+	}
+}
+
+func TestUnknownFieldsStripOnUpdate(t *testing.T) {
+	config := DefaultConfig()
+	config.UnknownFields = unknownFieldsStrip
+	db, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com","blob":"xxxxxxxx"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	if payload, _ := db.Bieter(id); string(payload) != `{"mail":"hugo@example.com","name":"hugo"}` {
+		t.Errorf("got payload %s after create", payload)
+	}
+
+	payload, err := db.UpdateBieter(id, strings.NewReader(`{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald","other":1}`), 0, true)
+	if err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+	if expect := `{"adresse":"beim wald","mail":"hugo@example.com","name":"hugo"}`; string(payload) != expect {
+		t.Errorf("got payload %s after update, expected %s", payload, expect)
+	}
+}
+
+func TestValidatePayloadMaxLength(t *testing.T) {
+	config := DefaultConfig()
+
+	if err := validatePayload([]byte(`{"name":"Hugo Müller","mail":"hugo@example.com","adresse":"Beim Wald 1, 12345 Irgendwo"}`), config); err != nil {
+		t.Errorf("normal payload returned: %v", err)
+	}
+
+	// Umlauts count as one character.
+	name := strings.Repeat("ü", config.MaxLength.Name)
+	if err := validatePayload([]byte(`{"name":"`+name+`","mail":"hugo@example.com"}`), config); err != nil {
+		t.Errorf("name with the maximal length returned: %v", err)
+	}
+
+	err := validatePayload([]byte(`{"name":"`+name+`x","mail":"hugo@example.com"}`), config)
+	var errValidation validationError
+	if !errors.As(err, &errValidation) {
+		t.Fatalf("got error %v for a too long name, expected validationError", err)
+	}
+	if !strings.Contains(err.Error(), "name (zu lang") {
+		t.Errorf("error %q does not name the field", err)
+	}
+
+	config.MaxLength.Name = 0
+	if err := validatePayload([]byte(`{"name":"`+name+`x","mail":"hugo@example.com"}`), config); err != nil {
+		t.Errorf("name without limit returned: %v", err)
+	}
+}
+
+func TestDuplicateMailDisabled(t *testing.T) {
+	db := newTestDB(t)
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false); err != nil {
+			t.Errorf("NewBieter %d with the same mail: %v", i, err)
+		}
+	}
+}
@@ -2,17 +2,207 @@ package server
 
 import (
 	"bytes"
+	"context"
+	_ "embed"
+	"errors"
 	"fmt"
+	"image/png"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
 
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
 	"github.com/johnfercher/maroto/pkg/consts"
 	"github.com/johnfercher/maroto/pkg/pdf"
 	"github.com/johnfercher/maroto/pkg/props"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+//go:embed contract.tmpl
+var defaultContractTemplate string
+
+// contractData are the values, that can be used in the contract template.
+type contractData struct {
+	ID     string
+	Bieter pdfData
+	Config Config
+
+	// Offer is the monthly offer in cent. 0 means, there is no offer.
+	Offer int
+}
+
+// VerteilstelleName returns the name of the verteilstelle of the bieter.
+func (d contractData) VerteilstelleName() string {
+	return d.Config.verteilstelleName(int(d.Bieter.Verteilstelle))
+}
+
+// AbbuchungName returns the name of the abbuchung option of the bieter.
+func (d contractData) AbbuchungName() string {
+	return d.Config.abbuchungName(int(d.Bieter.Abbuchung))
+}
+
+// SeasonStart returns the year, in which the season starts.
+func (d contractData) SeasonStart() int {
+	return d.Config.SeasonYear
+}
+
+// SeasonEnd returns the year, in which the season ends.
+func (d contractData) SeasonEnd() int {
+	return d.Config.SeasonYear + 1
+}
+
+// SeasonName returns the season like "2021/22".
+func (d contractData) SeasonName() string {
+	return fmt.Sprintf("%d/%02d", d.SeasonStart(), d.SeasonEnd()%100)
+}
+
+// Yearly returns true, if the bieter pays the offer for the whole year at
+// once.
+func (d contractData) Yearly() bool {
+	return d.Bieter.Abbuchung == abbuchungJaehrlich
+}
+
+// YearlyOffer returns the offer for the hole year in cent.
+func (d contractData) YearlyOffer() int {
+	return d.Offer * 12
+}
+
+// loadContractTemplate loads the contract texts. The template function euro
+// formats amounts with the currency.
+//
+// The blocks of the file are parsed on top of the default template, so the
+// file only has to define the blocks it changes. If the file does not exist,
+// the default template is used.
+func loadContractTemplate(file string, currency Currency) (*template.Template, error) {
+	tmpl, err := template.New("contract").
+		Funcs(template.FuncMap{"euro": currency.format, "iban": formatIBAN}).
+		Parse(defaultContractTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parsing default contract template: %w", err)
+	}
+
+	if file == "" {
+		return tmpl, nil
+	}
+
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return tmpl, nil
+		}
+		return nil, fmt.Errorf("reading contract template: %w", err)
+	}
+
+	if _, err := tmpl.Parse(string(bs)); err != nil {
+		return nil, fmt.Errorf("parsing contract template %q: %w", file, err)
+	}
+	return tmpl, nil
+}
+
+// executeContractTemplate renders one block of the contract template.
+//
+// Whitespace is collapsed, because maroto only wraps at spaces.
+func executeContractTemplate(tmpl *template.Template, name string, data contractData) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+		return "", fmt.Errorf("executing contract template %q: %w", name, err)
+	}
+	return strings.Join(strings.Fields(buf.String()), " "), nil
+}
+
+// contractSection is a part of the bietervertrag with a heading and the
+// template blocks of its paragraphs.
+type contractSection struct {
+	Heading string
+	Blocks  []string
+}
+
+// contractSections are the texts of the bietervertrag in the order, they are
+// printed. The pdf and the html preview both use them.
+var contractSections = []contractSection{
+	{
+		Heading: "Gemüsevertrag",
+		Blocks: []string{
+			"vertrag", "vertrag_abschluss", "vertrag_bedingungen",
+			"verteilstelle", "abbuchung", "beitrag",
+		},
+	},
+	{
+		Heading: "SEPA Lastschriftmandat",
+		Blocks: []string{
+			"glaeubiger", "mandatsreferenz", "abbuchung_datum",
+			"sepa_ermaechtigung", "sepa_erstattung", "sepa_rueckbuchung",
+			"kontoinhaber", "adresse", "iban",
+		},
+	},
+}
+
+// contractTexts renders all blocks of contractSections. The key of the
+// returned map is the name of the block.
+func contractTexts(tmpl *template.Template, data contractData) (map[string]string, error) {
+	texts := make(map[string]string)
+	for _, section := range contractSections {
+		for _, block := range section.Blocks {
+			s, err := executeContractTemplate(tmpl, block, data)
+			if err != nil {
+				return nil, err
+			}
+			texts[block] = s
+		}
+	}
+	return texts, nil
+}
+
 // Bietervertrag creates the bietervertrag pdf for a bieter
-func Bietervertrag(domain string, bieterID string, headerImage string, data pdfData) (*bytes.Buffer, error) {
+func Bietervertrag(ctx context.Context, tmpl *template.Template, headerImage string, tmplData contractData) (*bytes.Buffer, error) {
+	_, span := tracer().Start(ctx, "Bietervertrag", trace.WithAttributes(attribute.String("bieter.id", tmplData.ID)))
+	buf, err := bietervertrag(tmpl, headerImage, tmplData)
+	endSpan(span, err)
+	return buf, err
+}
+
+func bietervertrag(tmpl *template.Template, headerImage string, tmplData contractData) (*bytes.Buffer, error) {
 	m := pdf.NewMaroto(consts.Portrait, consts.A4)
+	config := tmplData.Config
+	bieterID := tmplData.ID
+
+	setPDFMetadata(
+		m,
+		"Gemüsevertrag "+tmplData.Bieter.Name,
+		config.Org.Name,
+		"Gemüsejahr "+tmplData.SeasonName(),
+	)
+
+	// Footer with page number and bieter id, so printed pages can be sorted
+	// back together.
+	m.SetFirstPageNb(1)
+	m.RegisterFooter(func() {
+		m.Row(5, func() {
+			m.Col(6, func() {
+				m.Text(fmt.Sprintf("Seite %d", m.GetCurrentPage()), props.Text{
+					Size: 8,
+				})
+			})
+			m.Col(6, func() {
+				m.Text("Bieternummer: "+bieterID, props.Text{
+					Size:  8,
+					Align: consts.Right,
+				})
+			})
+		})
+	})
+
+	texts, err := contractTexts(tmpl, tmplData)
+	if err != nil {
+		return nil, err
+	}
+	text := func(name string) string {
+		return texts[name]
+	}
 
 	// TODO: Remove
 	//m.SetBorder(true)
@@ -21,12 +211,7 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 	m.Row(20, func() {
 		// Adresse
 		m.Col(6, func() {
-			for i, line := range [...]string{
-				"Solidarische Landwirtschaft Baarfood e. V",
-				"Neckarstrasse 120",
-				"78056 Villingen-Schwenningen",
-				"www.baarfood.de",
-			} {
+			for i, line := range config.Org.headerLines() {
 				m.Text(line, props.Text{
 					Size: 10,
 					Top:  float64(i) * 3.5,
@@ -36,11 +221,15 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 
 		// Baarcode
 		m.Col(3, func() {
-			m.QrCode(fmt.Sprintf("%s/bieter/%s", domain, bieterID))
+			m.QrCode(bieterURL(config.domain(), bieterID))
 		})
 
 		// Image
 		m.Col(3, func() {
+			if headerImage == "" {
+				return
+			}
+
 			err := m.Base64Image(headerImage, consts.Png, props.Rect{
 				Center: true,
 			})
@@ -54,7 +243,7 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 	// Gemüsevertrag
 	m.Row(15, func() {
 		m.Col(12, func() {
-			m.Text("Gemüsevertrag", props.Text{
+			m.Text(contractSections[0].Heading, props.Text{
 				Size:  14,
 				Style: consts.Bold,
 				Align: consts.Center,
@@ -66,30 +255,16 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 	// Vertragstext
 	m.Row(50, func() {
 		m.Col(12, func() {
-			m.Text(fmt.Sprintf(`
-				Ich, %s <%s>, bin Mitglied im des Vereins Solidarische Landwirtschaft Baarfood e.V. 
-				und möchte im Gemüsejahr 2021/22 (April 2021 – März 2022) einen Gemüseanteil beziehen.`, data.Name, data.Mail),
-			)
+			m.Text(text("vertrag"))
 			m.Text(
-				`Nach erfolgreicher Bieterrunde schließe ich mit dem Verein Solidarische Landwirtschaft 
-				Baarfood e.V. diesen Gemüsevertrag ab.`,
+				text("vertrag_abschluss"),
 				props.Text{
 					Top: 8,
 				},
 			)
 
 			m.Text(
-				`Die Gemüsevertrag gilt von April 2021 bis März 2022 (=12 Monate). 
-				Ich kann mein Gemüse wöchentlich an einer vorher festgelegten Verteilstelle abholen. 
-				Ich respektiere die in den Verteilstellen genannten Anteilsmengen und Abholfristen. 
-				Ich habe keinen Anspruch auf eine bestimmte Menge und Qualität der Produkte. 
-				Sollte es mir vorübergehend nicht möglich sein, meinen Pflichten (Abholung) nach zu kommen, 
-				so sorge ich selbst in diesem Zeitraum für einen Ersatz. Im Falle einer Urlaubsvertretung weise 
-				ich persönlich in die Abholmodalitäten ein. Ein finanzieller Ausgleich wird privat organisiert. 
-				Die endgültige Abgabe meines Anteils im laufenden Jahr ist nur möglich, wenn ein anderes 
-				Vereinsmitglied, das bisher keinen Ernteanteil bezieht, oder ein neues Mitglied, den 
-				oben genannten monatlichen finanziellen Beitrag für die verbleibenden Monate übernimmt. 
-				Erst ab diesem Zeitpunkt erfolgt der Lastschrifteinzug von diesem neuen Mitglied.`,
+				text("vertrag_bedingungen"),
 				props.Text{
 					Top: 16,
 				},
@@ -100,23 +275,28 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 	// Verteilstelle
 	m.Row(5, func() {
 		m.Col(12, func() {
-			m.Text(
-				fmt.Sprintf(`Ich hole meinen Antreil in der Verteilstelle in %s`, data.Verteilstelle),
-			)
+			m.Text(text("verteilstelle"))
 		})
 	})
 
 	// Abbuchung
 	m.Row(5, func() {
 		m.Col(12, func() {
-			m.Text(fmt.Sprintf(`Die Abbuchung meines Beitrages für den Ernteanteil erfolgt von April 2021 bis März 2022 %s`, data.Abbuchung))
+			m.Text(text("abbuchung"))
+		})
+	})
+
+	// Beitrag
+	m.Row(5, func() {
+		m.Col(12, func() {
+			m.Text(text("beitrag"))
 		})
 	})
 
 	// SEPA
 	m.Row(15, func() {
 		m.Col(12, func() {
-			m.Text("SEPA Lastschriftmandat", props.Text{
+			m.Text(contractSections[1].Heading, props.Text{
 				Size:  14,
 				Style: consts.Bold,
 				Align: consts.Center,
@@ -128,25 +308,21 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 	// Gläubiger-Identifikationsnummer
 	m.Row(5, func() {
 		m.Col(12, func() {
-			m.Text(`Gläubiger-Identifikationsnummer: DE62ZZZ00001997635`)
+			m.Text(text("glaeubiger"))
 		})
 	})
 
 	// Mandatsreferenz
 	m.Row(5, func() {
 		m.Col(12, func() {
-			m.Text(fmt.Sprintf(`Mandatsreferenz: 22%s`, bieterID))
+			m.Text(text("mandatsreferenz"))
 		})
 	})
 
 	// Abbuchung
 	m.Row(5, func() {
 		m.Col(12, func() {
-			if data.Abbuchung == 1 {
-				m.Text("Die Abbuchung erfolgt am 1. April 2022")
-			} else {
-				m.Text("Die Abbuchung erfolgt am ersten Werktag eines Monats von April 2022 bis Märt 2023")
-			}
+			m.Text(text("abbuchung_datum"))
 		})
 	})
 
@@ -183,26 +359,17 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 	// Sepa-Text
 	m.Row(30, func() {
 		m.Col(12, func() {
-			m.Text(`
-			Ich ermächtige den Verein Solidarische Landwirtschaft Baarfood e.V. 
-			Lastschriften von meinem Konto einzuziehen. Zugleich weise ich mein 
-			Kreditinstitut an, die von Solidarische Landwirtschaft Baarfood e.V. 
-			auf mein Konto gezogenen Lastschriften einzulösen.
-			`,
-			)
+			m.Text(text("sepa_ermaechtigung"))
 
 			m.Text(
-				`Ich kann innerhalb von acht Wochen, beginnend mit dem Belastungsdatum,
-				die Erstattung des belasteten Betrages verlangen. Es gelten dabei die
-				mit meinem Kreditinstitut vereinbarten Bedingungen.
-				`,
+				text("sepa_erstattung"),
 				props.Text{
 					Top: 12,
 				},
 			)
 
 			m.Text(
-				`Ist eine Abbuchung nicht möglich, so geht die Rückbuchungsgebühr zu meinen Lasten.`,
+				text("sepa_rueckbuchung"),
 				props.Text{
 					Top: 20,
 				},
@@ -212,17 +379,13 @@ func Bietervertrag(domain string, bieterID string, headerImage string, data pdfD
 
 	m.Row(10, func() {
 		m.Col(12, func() {
-			kontoinhaber := data.Kontoinhaber
-			if len(kontoinhaber) == 0 {
-				kontoinhaber = data.Name
-			}
-			m.Text(fmt.Sprintf(`Kontoinhaber: %s`, kontoinhaber))
-			m.Text(fmt.Sprintf(`Adresse: %s`, data.Adresse),
+			m.Text(text("kontoinhaber"))
+			m.Text(text("adresse"),
 				props.Text{
 					Top: 5,
 				},
 			)
-			m.Text(fmt.Sprintf(`IBAN: %s`, data.IBAN),
+			m.Text(text("iban"),
 				props.Text{
 					Top: 10,
 				},
@@ -278,25 +441,175 @@ type pdfData struct {
 	IBAN          string        `json:"IBAN"`
 }
 
+// verteilstelle is the id of a configured Verteilstelle.
 type verteilstelle int
 
-func (v verteilstelle) String() string {
-	switch v {
-	case 1:
-		return "Villingen"
-	case 2:
-		return "Schwenningen"
-	case 3:
-		return "Überauchen (Acker)"
+// abbuchung is the id of a configured AbbuchungOption.
+type abbuchung int
+
+// The abbuchung ids with a special meaning. The client sends 0 for a monthly
+// payment, so existing bieters without the field are monthly.
+const (
+	abbuchungMonatlich abbuchung = 0
+	abbuchungJaehrlich abbuchung = 1
+)
+
+// setPDFMetadata sets the title, the author and the subject of the pdf
+// document.
+func setPDFMetadata(m pdf.Maroto, title, author, subject string) {
+	pm, ok := m.(*pdf.PdfMaroto)
+	if !ok {
+		return
 	}
-	return "UNGÜLTIG"
+
+	pm.Pdf.SetTitle(title, true)
+	pm.Pdf.SetAuthor(author, true)
+	pm.Pdf.SetSubject(subject, true)
 }
 
-type abbuchung int
+// Results creates a pdf with a summary of the offers.
+func Results(headerImage string, config Config, s stats, r results) (*bytes.Buffer, error) {
+	m := pdf.NewMaroto(consts.Portrait, consts.A4)
+	setPDFMetadata(
+		m,
+		"Ergebnis der Bieterrunde",
+		config.Org.Name,
+		"Gemüsejahr "+contractData{Config: config}.SeasonName(),
+	)
+
+	// Header
+	m.Row(20, func() {
+		m.Col(9, func() {
+			for i, line := range config.Org.headerLines() {
+				m.Text(line, props.Text{
+					Size: 10,
+					Top:  float64(i) * 3.5,
+				})
+			}
+		})
+
+		m.Col(3, func() {
+			if headerImage == "" {
+				return
+			}
+
+			err := m.Base64Image(headerImage, consts.Png, props.Rect{
+				Center: true,
+			})
+			if err != nil {
+				log.Printf("loading header image: %v", err)
+				return
+			}
+		})
+	})
+
+	m.Row(15, func() {
+		m.Col(12, func() {
+			m.Text("Ergebnis der Bieterrunde", props.Text{
+				Size:  14,
+				Style: consts.Bold,
+				Align: consts.Center,
+				Top:   5,
+			})
+		})
+	})
+
+	var average int
+	if s.Total.OfferCount > 0 {
+		average = s.Total.OfferSum / s.Total.OfferCount
+	}
+
+	budgetText := "nicht erreicht"
+	if r.Reached {
+		budgetText = "erreicht"
+	}
+
+	summary := [][]string{
+		{"Anzahl Bieter", strconv.Itoa(s.Total.Count)},
+		{"Anzahl Gebote", strconv.Itoa(s.Total.OfferCount)},
+		{"Summe der Gebote (monatlich)", config.Currency.format(s.Total.OfferSum)},
+		{"Budget (monatlich)", config.Currency.format(r.Budget)},
+		{"Budget", budgetText},
+		{"Durchschnittliches Gebot", config.Currency.format(average)},
+	}
+	for _, row := range summary {
+		m.Row(7, func() {
+			m.Col(6, func() {
+				m.Text(row[0], props.Text{Style: consts.Bold})
+			})
+			m.Col(6, func() {
+				m.Text(row[1], props.Text{Align: consts.Right})
+			})
+		})
+	}
+
+	m.Row(15, func() {
+		m.Col(12, func() {
+			m.Text("Verteilstellen", props.Text{
+				Size:  12,
+				Style: consts.Bold,
+				Top:   7,
+			})
+		})
+	})
+
+	// The verteilstellen in the configured order and the invalid ones at the
+	// end.
+	var names []string
+	for _, v := range config.Verteilstellen {
+		names = append(names, v.Name)
+	}
+	if _, ok := s.Verteilstelle[config.verteilstelleName(0)]; ok {
+		names = append(names, config.verteilstelleName(0))
+	}
+
+	var rows [][]string
+	for _, name := range names {
+		group := s.Verteilstelle[name]
+		rows = append(rows, []string{
+			name,
+			strconv.Itoa(group.Count),
+			strconv.Itoa(group.OfferCount),
+			config.Currency.format(group.OfferSum),
+		})
+	}
+
+	m.TableList(
+		[]string{"Verteilstelle", "Bieter", "Gebote", "Summe"},
+		rows,
+		props.TableList{Line: true},
+	)
+
+	pdfile, err := m.Output()
+	if err != nil {
+		return nil, fmt.Errorf("creating pdf: %w", err)
+	}
+
+	return &pdfile, nil
+}
+
+// bieterURL returns the url of the bieter page in the client.
+func bieterURL(domain, bieterID string) string {
+	return fmt.Sprintf("%s/bieter/%s", domain, bieterID)
+}
+
+// qrCodePNG returns the content as QR code in a png image with the size in
+// pixels. It uses the same error correction as the QR code in the
+// bietervertrag.
+func qrCodePNG(content string, size int) ([]byte, error) {
+	code, err := qr.Encode(content, qr.H, qr.Unicode)
+	if err != nil {
+		return nil, fmt.Errorf("encoding qr code: %w", err)
+	}
+
+	code, err = barcode.Scale(code, size, size)
+	if err != nil {
+		return nil, fmt.Errorf("scaling qr code: %w", err)
+	}
 
-func (a abbuchung) String() string {
-	if a == 1 {
-		return "Jährlich"
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code); err != nil {
+		return nil, fmt.Errorf("encoding png: %w", err)
 	}
-	return "Monatlich"
+	return buf.Bytes(), nil
 }
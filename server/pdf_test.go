@@ -0,0 +1,405 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testPDFConfig returns the default config with a fixed season, so the pdfs
+// do not depend on the clock.
+func testPDFConfig() Config {
+	return defaultConfigAt(time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC))
+}
+
+func testHeaderImage(t *testing.T) string {
+	t.Helper()
+
+	bs, err := os.ReadFile("../static/images/pdf_header_image.png")
+	if err != nil {
+		t.Fatalf("reading header image: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(bs)
+}
+
+func TestHeaderImageCustomPath(t *testing.T) {
+	custom := []byte("custom image")
+	filesystem := MultiFS{
+		fs: []fs.FS{
+			fstest.MapFS{"images/logo.png": {Data: custom}},
+			os.DirFS(".."),
+		},
+	}
+
+	got := loadHeaderImage(filesystem, "images/logo.png")
+	if expect := base64.StdEncoding.EncodeToString(custom); got != expect {
+		t.Errorf("got %q, expected the custom image %q", got, expect)
+	}
+
+	// The default image is found in the second source.
+	if got := loadHeaderImage(filesystem, testPDFConfig().HeaderImage); got != testHeaderImage(t) {
+		t.Errorf("got another image than the default image")
+	}
+}
+
+func TestHeaderImageMissing(t *testing.T) {
+	got := loadHeaderImage(fstest.MapFS{}, "images/missing.png")
+	if got != "" {
+		t.Errorf("got image %q for missing file, expected empty string", got)
+	}
+
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	buf, err := Bietervertrag(context.Background(), tmpl, got, contractData{ID: "1234", Bieter: pdfData{Name: "Hugo"}, Config: testPDFConfig()})
+	if err != nil {
+		t.Fatalf("Bietervertrag without header image: %v", err)
+	}
+
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+		t.Errorf("bietervertrag is not a pdf")
+	}
+}
+
+func TestContractTemplateDefault(t *testing.T) {
+	tmpl, err := loadContractTemplate(filepath.Join(t.TempDir(), "does-not-exist.tmpl"), defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	data := contractData{
+		ID:     "1234",
+		Bieter: pdfData{Name: "Hugo", Mail: "hugo@example.com"},
+	}
+
+	got, err := executeContractTemplate(tmpl, "vertrag", data)
+	if err != nil {
+		t.Fatalf("executeContractTemplate: %v", err)
+	}
+
+	if !strings.HasPrefix(got, "Ich, Hugo <hugo@example.com>, bin Mitglied") {
+		t.Errorf("got %q, expected the default text", got)
+	}
+}
+
+func TestContractTemplateCustomFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "contract.tmpl")
+	custom := `{{define "vertrag"}}
+		Hiermit bestätigt {{.Bieter.Name}}
+		die Teilnahme an {{.Config.Domain}}.
+	{{end}}`
+	if err := os.WriteFile(file, []byte(custom), 0600); err != nil {
+		t.Fatalf("writing template: %v", err)
+	}
+
+	tmpl, err := loadContractTemplate(file, defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	config := testPDFConfig()
+	config.Domain = "https://example.com"
+	data := contractData{
+		ID:     "1234",
+		Bieter: pdfData{Name: "Hugo"},
+		Config: config,
+	}
+
+	got, err := executeContractTemplate(tmpl, "vertrag", data)
+	if err != nil {
+		t.Fatalf("executeContractTemplate: %v", err)
+	}
+
+	expect := "Hiermit bestätigt Hugo die Teilnahme an https://example.com."
+	if got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+
+	// Blocks that are not in the file are taken from the default.
+	got, err = executeContractTemplate(tmpl, "mandatsreferenz", data)
+	if err != nil {
+		t.Fatalf("executeContractTemplate: %v", err)
+	}
+	if got != "Mandatsreferenz: 221234" {
+		t.Errorf("got %q, expected default mandatsreferenz", got)
+	}
+
+	if _, err := Bietervertrag(context.Background(), tmpl, testHeaderImage(t), data); err != nil {
+		t.Errorf("Bietervertrag with custom template: %v", err)
+	}
+}
+
+func TestContractOrgInfo(t *testing.T) {
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	config := testPDFConfig()
+	config.Org = OrgInfo{
+		Name:       "Gemüsekooperative Musterdorf e.V.",
+		Street:     "Dorfstraße 1",
+		City:       "12345 Musterdorf",
+		CreditorID: "DE98ZZZ09999999999",
+	}
+	data := contractData{
+		ID:     "1234",
+		Bieter: pdfData{Name: "Hugo"},
+		Config: config,
+	}
+
+	header := config.Org.headerLines()
+	if len(header) != 3 || header[0] != config.Org.Name {
+		t.Errorf("got header %q, expected it to start with the org name", header)
+	}
+
+	for block, expect := range map[string]string{
+		"vertrag":            "Gemüsekooperative Musterdorf e.V.",
+		"sepa_ermaechtigung": "Gemüsekooperative Musterdorf e.V.",
+		"glaeubiger":         "Gläubiger-Identifikationsnummer: DE98ZZZ09999999999",
+	} {
+		got, err := executeContractTemplate(tmpl, block, data)
+		if err != nil {
+			t.Fatalf("executeContractTemplate %q: %v", block, err)
+		}
+
+		if !strings.Contains(got, expect) {
+			t.Errorf("block %q is %q, expected it to contain %q", block, got, expect)
+		}
+	}
+
+	if _, err := Bietervertrag(context.Background(), tmpl, testHeaderImage(t), data); err != nil {
+		t.Errorf("Bietervertrag: %v", err)
+	}
+}
+
+func TestContractOffer(t *testing.T) {
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		data   contractData
+		expect string
+	}{
+		{
+			"monthly",
+			contractData{Offer: 4500, Bieter: pdfData{Abbuchung: 0}},
+			"Mein monatlicher Beitrag beträgt 45,00 €.",
+		},
+		{
+			"yearly",
+			contractData{Offer: 4500, Bieter: pdfData{Abbuchung: 1}},
+			"Mein monatlicher Beitrag beträgt 45,00 €, für das ganze Jahr 540,00 €.",
+		},
+		{
+			"no offer",
+			contractData{},
+			"Mein monatlicher Beitrag beträgt: ____________ €",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeContractTemplate(tmpl, "beitrag", tt.data)
+			if err != nil {
+				t.Fatalf("executeContractTemplate: %v", err)
+			}
+
+			if got != tt.expect {
+				t.Errorf("got %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+
+	data := contractData{ID: "1234", Bieter: pdfData{Name: "Hugo"}, Config: testPDFConfig(), Offer: 4500}
+	if _, err := Bietervertrag(context.Background(), tmpl, testHeaderImage(t), data); err != nil {
+		t.Errorf("Bietervertrag: %v", err)
+	}
+}
+
+func TestFormatEuro(t *testing.T) {
+	for cent, expect := range map[int]string{
+		0:         "0,00 €",
+		4500:      "45,00 €",
+		4550:      "45,50 €",
+		104505:    "1.045,05 €",
+		123456789: "1.234.567,89 €",
+		-4500:     "-45,00 €",
+	} {
+		if got := formatEuro(cent); got != expect {
+			t.Errorf("formatEuro(%d) = %q, expected %q", cent, got, expect)
+		}
+	}
+}
+
+func TestVerteilstelleName(t *testing.T) {
+	config := testPDFConfig()
+	config.Verteilstellen = append(config.Verteilstellen, Verteilstelle{4, "Überauchen (Hof)"})
+
+	for id, expect := range map[int]string{
+		1: "Villingen",
+		2: "Schwenningen",
+		3: "Überauchen (Acker)",
+		4: "Überauchen (Hof)",
+		0: "UNGÜLTIG",
+		5: "UNGÜLTIG",
+	} {
+		if got := config.verteilstelleName(id); got != expect {
+			t.Errorf("verteilstelleName(%d) = %q, expected %q", id, got, expect)
+		}
+	}
+
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	got, err := executeContractTemplate(tmpl, "verteilstelle", contractData{
+		Bieter: pdfData{Name: "Hugo", Verteilstelle: 4},
+		Config: config,
+	})
+	if err != nil {
+		t.Fatalf("executeContractTemplate: %v", err)
+	}
+
+	if !strings.Contains(got, "Überauchen (Hof)") {
+		t.Errorf("got %q, expected the configured verteilstelle", got)
+	}
+}
+
+func TestResultsPDF(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, payload := range []string{
+		`{"name":"hugo","mail":"hugo@example.com","verteilstelle":1}`,
+		`{"name":"erik","mail":"erik@example.com","verteilstelle":2}`,
+		`{"name":"anna","mail":"anna@example.com","verteilstelle":2}`,
+	} {
+		id, err := db.NewBieter([]byte(payload), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		db.offer[id] = 5000
+	}
+
+	config := testPDFConfig()
+	config.Budget = 12000
+	bieterList := db.BieterList()
+
+	buf, err := Results(
+		testHeaderImage(t),
+		config,
+		buildStats(bieterList, db.Offer, config),
+		buildResults(bieterList, db.Offer, config.Budget),
+	)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+
+	if buf.Len() == 0 {
+		t.Errorf("results pdf is empty")
+	}
+
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+		t.Errorf("results is not a pdf")
+	}
+}
+
+func TestContractIBAN(t *testing.T) {
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	got, err := executeContractTemplate(tmpl, "iban", contractData{
+		Bieter: pdfData{Name: "Hugo", IBAN: "DE89370400440532013000"},
+		Config: testPDFConfig(),
+	})
+	if err != nil {
+		t.Fatalf("executeContractTemplate: %v", err)
+	}
+
+	if got != "IBAN: DE89 3704 0044 0532 0130 00" {
+		t.Errorf("got %q, expected the grouped IBAN", got)
+	}
+}
+
+func TestContractSeason(t *testing.T) {
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	config := testPDFConfig()
+	config.SeasonYear = 2024
+
+	for _, tt := range []struct {
+		block     string
+		abbuchung abbuchung
+		expect    string
+	}{
+		{"vertrag", 0, "Gemüsejahr 2024/25 (April 2024 – März 2025)"},
+		{"vertrag_bedingungen", 0, "von April 2024 bis März 2025"},
+		{"abbuchung", 0, "von April 2024 bis März 2025"},
+		{"abbuchung_datum", 1, "am 1. April 2024"},
+		{"abbuchung_datum", 0, "von April 2024 bis März 2025"},
+	} {
+		got, err := executeContractTemplate(tmpl, tt.block, contractData{
+			Bieter: pdfData{Name: "Hugo", Abbuchung: tt.abbuchung},
+			Config: config,
+		})
+		if err != nil {
+			t.Fatalf("executeContractTemplate: %v", err)
+		}
+
+		if !strings.Contains(got, tt.expect) {
+			t.Errorf("block %s with abbuchung %d: got %q, expected it to contain %q", tt.block, tt.abbuchung, got, tt.expect)
+		}
+	}
+}
+
+func TestContractMetadata(t *testing.T) {
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	data := contractData{ID: "1234", Bieter: pdfData{Name: "Hugo"}, Config: testPDFConfig()}
+	buf, err := Bietervertrag(context.Background(), tmpl, testHeaderImage(t), data)
+	if err != nil {
+		t.Fatalf("Bietervertrag: %v", err)
+	}
+
+	for _, key := range []string{"/Title", "/Author", "/Subject"} {
+		if !bytes.Contains(buf.Bytes(), []byte(key)) {
+			t.Errorf("pdf has no metadata %s", key)
+		}
+	}
+}
+
+func TestContractFooter(t *testing.T) {
+	tmpl, err := loadContractTemplate("", defaultCurrency)
+	if err != nil {
+		t.Fatalf("loadContractTemplate: %v", err)
+	}
+
+	data := contractData{ID: "1234", Bieter: pdfData{Name: "Hugo"}, Config: testPDFConfig()}
+	buf, err := Bietervertrag(context.Background(), tmpl, testHeaderImage(t), data)
+	if err != nil {
+		t.Fatalf("Bietervertrag: %v", err)
+	}
+
+	if pages := bytes.Count(buf.Bytes(), []byte("/Type /Page\n")); pages < 1 {
+		t.Errorf("pdf has %d pages, expected at least one", pages)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+)
+
+var previewTemplate = htmltemplate.Must(htmltemplate.New("preview").Parse(`<!DOCTYPE html>
+<html lang="de">
+<head>
+<meta charset="utf-8">
+<title>Vorschau Gemüsevertrag {{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 45em; margin: 2em auto; line-height: 1.4; }
+.org { color: #555; }
+</style>
+</head>
+<body>
+<p class="org">{{range .Org}}{{.}}<br>{{end}}</p>
+{{range .Sections}}
+<h2>{{.Heading}}</h2>
+{{range .Paragraphs}}<p>{{.}}</p>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// ContractPreview renders the texts of the bietervertrag as html. It uses the
+// same template blocks as the pdf, so the wording can be checked without
+// creating a pdf.
+func ContractPreview(tmpl *template.Template, data contractData) (*bytes.Buffer, error) {
+	texts, err := contractTexts(tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+
+	type section struct {
+		Heading    string
+		Paragraphs []string
+	}
+
+	var sections []section
+	for _, s := range contractSections {
+		paragraphs := make([]string, len(s.Blocks))
+		for i, block := range s.Blocks {
+			paragraphs[i] = texts[block]
+		}
+		sections = append(sections, section{s.Heading, paragraphs})
+	}
+
+	buf := new(bytes.Buffer)
+	err = previewTemplate.Execute(buf, struct {
+		Name     string
+		Org      []string
+		Sections []section
+	}{
+		data.Bieter.Name,
+		data.Config.Org.headerLines(),
+		sections,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("executing preview template: %w", err)
+	}
+	return buf, nil
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// resultEntry is one bieter in the results.
+type resultEntry struct {
+	Rank  int    `json:"rank"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Offer int    `json:"offer"`
+
+	// Sum is the sum of the offers up to this bieter.
+	Sum int `json:"sum"`
+
+	// In is true, if the offer is needed to reach the budget.
+	In bool `json:"in"`
+}
+
+// results are the offers ranked from the highest to the lowest.
+type results struct {
+	Budget  int           `json:"budget"`
+	Sum     int           `json:"sum"`
+	Reached bool          `json:"reached"`
+	Entries []resultEntry `json:"entries"`
+}
+
+// buildResults ranks the bieters with an offer. Bieters with the same offer are
+// sorted by id.
+//
+// The entries are in, until the cumulative sum reaches the budget. The entry,
+// that reaches the budget, is also in.
+func buildResults(bieterList map[string]json.RawMessage, offer func(id string) int, budget int) results {
+	entries := make([]resultEntry, 0, len(bieterList))
+	for id, payload := range bieterList {
+		o := offer(id)
+		if o <= 0 {
+			continue
+		}
+
+		var data struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(payload, &data)
+
+		entries = append(entries, resultEntry{ID: id, Name: data.Name, Offer: o})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Offer != entries[j].Offer {
+			return entries[i].Offer > entries[j].Offer
+		}
+		return entries[i].ID < entries[j].ID
+	})
+
+	r := results{Budget: budget, Entries: entries}
+	for i := range entries {
+		entries[i].Rank = i + 1
+		entries[i].In = !r.Reached
+
+		r.Sum += entries[i].Offer
+		entries[i].Sum = r.Sum
+		if r.Sum >= budget {
+			r.Reached = true
+		}
+	}
+	return r
+}
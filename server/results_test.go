@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildResults(t *testing.T) {
+	bieterList := map[string]json.RawMessage{
+		"A": []byte(`{"name":"anna","mail":"anna@example.com"}`),
+		"B": []byte(`{"name":"bert","mail":"bert@example.com"}`),
+		"C": []byte(`{"name":"carl","mail":"carl@example.com"}`),
+		"D": []byte(`{"name":"dora","mail":"dora@example.com"}`),
+		"E": []byte(`{"name":"emil","mail":"emil@example.com"}`),
+	}
+	offers := map[string]int{"A": 5000, "B": 7000, "C": 5000, "D": 6000}
+	offer := func(id string) int { return offers[id] }
+
+	for _, tt := range []struct {
+		name      string
+		budget    int
+		expectIn  []string
+		expectOut []string
+		reached   bool
+	}{
+		{"exactly", 18000, []string{"B", "D", "A"}, []string{"C"}, true},
+		{"overshoot", 17000, []string{"B", "D", "A"}, []string{"C"}, true},
+		{"undershoot", 30000, []string{"B", "D", "A", "C"}, nil, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildResults(bieterList, offer, tt.budget)
+
+			if got.Reached != tt.reached {
+				t.Errorf("got reached %t, expected %t", got.Reached, tt.reached)
+			}
+
+			if got.Sum != 23000 {
+				t.Errorf("got sum %d, expected 23000", got.Sum)
+			}
+
+			expectOrder := append(append([]string{}, tt.expectIn...), tt.expectOut...)
+			if len(got.Entries) != len(expectOrder) {
+				t.Fatalf("got %d entries, expected %d", len(got.Entries), len(expectOrder))
+			}
+
+			for i, entry := range got.Entries {
+				if entry.ID != expectOrder[i] || entry.Rank != i+1 {
+					t.Errorf("got entry %d: %+v, expected id %s", i, entry, expectOrder[i])
+				}
+
+				if expectIn := i < len(tt.expectIn); entry.In != expectIn {
+					t.Errorf("entry %s: got in %t, expected %t", entry.ID, entry.In, expectIn)
+				}
+			}
+		})
+	}
+}
+
+func TestResultsHandler(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	if resp := doRequest(router, "GET", "/api/results", "", false); resp.Code != 401 {
+		t.Errorf("results without admin: got status %d, expected 401", resp.Code)
+	}
+
+	resp := doRequest(router, "GET", "/api/results", "", true)
+	var got results
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding results %q: %v", resp.Body.String(), err)
+	}
+
+	if len(got.Entries) != 0 {
+		t.Errorf("got %d entries for an empty database", len(got.Entries))
+	}
+}
@@ -5,7 +5,15 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -18,39 +26,261 @@ type DefaultFiles struct {
 }
 
 // Run starts the server until the context is canceled.
+//
+// The server starts listening before the database is loaded. Until then, only
+// the health checks are answered.
+//
+// On SIGHUP, the config is reloaded. See reloadConfig for the values, that
+// can be changed.
 func Run(ctx context.Context, configFile, dbFile string, defaultFiles DefaultFiles) error {
 	config, err := LoadConfig(configFile)
 	if err != nil {
 		return fmt.Errorf("reading config: %w", err)
 	}
 
-	db, err := NewDB(dbFile)
+	// All handlers and the database share the values, that are changed on
+	// a reload.
+	config = config.withLive()
+
+	slog.SetDefault(newLogger(os.Stderr, config.LogFormat))
+
+	shutdownTracing, err := setupTracing(ctx)
 	if err != nil {
-		return fmt.Errorf("open database file: %w", err)
+		return err
 	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Printf("Error: flushing traces: %v", err)
+		}
+	}()
 
-	router := mux.NewRouter()
-	registerHandlers(router, config, db, defaultFiles)
+	handler := new(swapHandler)
+	handler.set(startupRouter())
+
+	srv := &http.Server{
+		Addr:    config.ListenAddr,
+		Handler: handler,
+
+		// Long running requests like the event stream stop, when the context
+		// is canceled.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
 
-	srv := &http.Server{Addr: config.ListenAddr, Handler: router}
+	// Bind the address before anything else is started, so a wrong or used
+	// address stops the server immediately.
+	listener, err := listen(config.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	if (config.TLSCert == "") != (config.TLSKey == "") {
+		log.Println("Warning: tls_cert and tls_key have to be set both. Use http.")
+	}
+
+	var redirectSrv *http.Server
+	if config.useTLS() && config.TLSRedirectAddr != "" {
+		redirectSrv = &http.Server{
+			Addr:    config.TLSRedirectAddr,
+			Handler: redirectHandler(config),
+		}
+
+		go func() {
+			log.Printf("Redirect to https on: %s", config.TLSRedirectAddr)
+			if err := redirectSrv.ListenAndServe(); err != http.ErrServerClosed {
+				log.Printf("Error: redirect server: %v", err)
+			}
+		}()
+	}
 
 	// Shutdown logic in separate goroutine.
-	wait := make(chan error)
+	wait := make(chan error, 1)
 	go func() {
 		// Wait for the context to be closed.
 		<-ctx.Done()
 
-		if err := srv.Shutdown(context.Background()); err != nil {
+		timeout := time.Duration(config.ShutdownTimeout) * time.Second
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if redirectSrv != nil {
+			redirectSrv.Shutdown(shutdownCtx)
+		}
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			srv.Close()
 			wait <- fmt.Errorf("HTTP server shutdown: %w", err)
 			return
 		}
 		wait <- nil
 	}()
 
-	log.Printf("Listen on: %s", config.ListenAddr)
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	listenErr := make(chan error, 1)
+	go func() {
+		if config.useTLS() {
+			log.Printf("Listen with TLS on: %s", listener.Addr())
+			listenErr <- srv.ServeTLS(listener, config.TLSCert, config.TLSKey)
+			return
+		}
+
+		log.Printf("Listen on: %s", listener.Addr())
+		listenErr <- srv.Serve(listener)
+	}()
+
+	db, err := NewDB(dbFile, config)
+	if err != nil {
+		srv.Close()
+		return fmt.Errorf("open database file: %w", err)
+	}
+
+	go db.finishAtDeadline(ctx)
+
+	backupDone := make(chan struct{})
+	go func() {
+		defer close(backupDone)
+		db.backupRegularly(ctx, config.BackupDir, time.Duration(config.BackupInterval)*time.Second, config.BackupKeep)
+	}()
+
+	campaigns, err := openCampaigns(config.Campaigns)
+	if err != nil {
+		srv.Close()
+		db.Close()
+		return fmt.Errorf("open campaigns: %w", err)
+	}
+	defer closeCampaigns(campaigns)
+
+	for _, c := range campaigns {
+		go c.db.finishAtDeadline(ctx)
+	}
+
+	// The signal has to be registered before the server is ready. In other
+	// case, an early SIGHUP would stop the process.
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	go func() {
+		current := config
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sighup:
+			}
+
+			reloaded, err := reloadConfig(current, configFile)
+			if err != nil {
+				log.Printf("Error: reloading config: %v", err)
+				continue
+			}
+
+			// The handlers are not rebuilt, so the rate limiters and the
+			// cached files are kept.
+			current = reloaded
+			current.setLive(current)
+			log.Println("Config reloaded")
+		}
+	}()
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, defaultFiles)
+	handleCampaigns(router, campaigns, staticFS(defaultFiles, config.StaticSources))
+	handler.set(securityHeadersMiddleware(config)(corsMiddleware(config.CORSOrigins)(router)))
+
+	if err := <-listenErr; err != http.ErrServerClosed {
+		db.Close()
 		return fmt.Errorf("HTTP Server failed: %v", err)
 	}
 
-	return <-wait
+	shutdownErr := <-wait
+
+	// A backup, that is written right now, is finished first.
+	<-backupDone
+
+	// Requests, that are still running after the timeout, can not write
+	// events anymore.
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("closing database: %w", err)
+	}
+
+	return shutdownErr
+}
+
+// listen validates the address and binds it.
+func listen(addr string) (net.Listener, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid listen_addr %q: %w", addr, err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("can not listen on %q: %w", addr, err)
+	}
+	return listener, nil
+}
+
+// WithShutdown returns a context, that is canceled on SIGINT or SIGTERM.
+//
+// If a signal is received for the second time, the process exits
+// immediately.
+func WithShutdown(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sig)
+
+		select {
+		case <-sig:
+			log.Println("Shutting down. Send the signal again to exit immediately.")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+
+		// If the signal was send for the second time, make a hard cut.
+		<-sig
+		os.Exit(1)
+	}()
+	return ctx, cancel
+}
+
+// redirectHandler redirects all requests to the same path on the domain.
+func redirectHandler(config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain := strings.TrimSuffix(config.domain(), "/")
+		http.Redirect(w, r, domain+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// startupRouter answers requests while the database is loading.
+func startupRouter() *mux.Router {
+	router := mux.NewRouter()
+	handleHealth(router, false)
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleError(w, clientError{msg: "Der Server startet gerade", status: 503, code: "STARTING"})
+	})
+	return router
+}
+
+// swapHandler is a http.Handler, that can be replaced while the server is
+// running.
+type swapHandler struct {
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+func (h *swapHandler) set(handler http.Handler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler = handler
+}
+
+func (h *swapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	handler := h.handler
+	h.mu.RUnlock()
+
+	handler.ServeHTTP(w, r)
 }
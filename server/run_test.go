@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// freeAddr returns a local address with a free port.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// waitReady waits until the server answers the readiness check.
+func waitReady(t *testing.T, client *http.Client, url string) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		resp, err := client.Get(url + "/api/readyz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == 200 {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("server at %s did not get ready", url)
+}
+
+func TestRunShutdownOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	addr := freeAddr(t)
+
+	configFile := filepath.Join(dir, "config.toml")
+	config := fmt.Sprintf("admin_password = %q\nlisten_addr = %q\nshutdown_timeout = 1\n", testAdminPW, addr)
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	ctx, cancel := WithShutdown(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, configFile, filepath.Join(dir, "db.jsonl"), DefaultFiles{Static: fstest.MapFS{}})
+	}()
+
+	waitReady(t, http.DefaultClient, "http://"+addr)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("sending signal: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after SIGTERM")
+	}
+}
+
+// writeTestCert writes a self signed certificate for 127.0.0.1.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bieterrunde test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certFile, keyFile, pool
+}
+
+func TestRunTLS(t *testing.T) {
+	dir := t.TempDir()
+	addr := freeAddr(t)
+	redirectAddr := freeAddr(t)
+	certFile, keyFile, pool := writeTestCert(t, dir)
+
+	configFile := filepath.Join(dir, "config.toml")
+	config := fmt.Sprintf(
+		"listen_addr = %q\ndomain = %q\ntls_cert = %q\ntls_key = %q\ntls_redirect_addr = %q\n",
+		addr, "https://"+addr, certFile, keyFile, redirectAddr,
+	)
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, configFile, filepath.Join(dir, "db.jsonl"), DefaultFiles{Static: fstest.MapFS{}})
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	waitReady(t, client, "https://"+addr)
+
+	resp, err := client.Get("http://" + redirectAddr + "/api/healthz")
+	if err != nil {
+		t.Fatalf("request to redirect server: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := resp.Header.Get("Location"); got != "https://"+addr+"/api/healthz" {
+		t.Errorf("got redirect to %q, expected https://%s/api/healthz", got, addr)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after cancel")
+	}
+}
+
+func TestRunListenAddr(t *testing.T) {
+	dir := t.TempDir()
+
+	writeConfig := func(t *testing.T, addr string) string {
+		t.Helper()
+		configFile := filepath.Join(t.TempDir(), "config.toml")
+		config := fmt.Sprintf("admin_password = %q\nlisten_addr = %q\nshutdown_timeout = 1\n", testAdminPW, addr)
+		if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		return configFile
+	}
+
+	t.Run("binds configured address", func(t *testing.T) {
+		addr := freeAddr(t)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- Run(ctx, writeConfig(t, addr), filepath.Join(dir, "db.jsonl"), DefaultFiles{Static: fstest.MapFS{}})
+		}()
+
+		waitReady(t, http.DefaultClient, "http://"+addr)
+		cancel()
+
+		if err := <-done; err != nil {
+			t.Errorf("Run returned: %v", err)
+		}
+	})
+
+	t.Run("address in use", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer l.Close()
+
+		err = Run(context.Background(), writeConfig(t, l.Addr().String()), filepath.Join(dir, "db.jsonl"), DefaultFiles{Static: fstest.MapFS{}})
+		if err == nil {
+			t.Errorf("Run returned no error for an used address")
+		}
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		err := Run(context.Background(), writeConfig(t, "localhost"), filepath.Join(dir, "db.jsonl"), DefaultFiles{Static: fstest.MapFS{}})
+		if err == nil {
+			t.Errorf("Run returned no error for an address without port")
+		}
+	})
+}
+
+func TestRunReloadOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	addr := freeAddr(t)
+
+	configFile := filepath.Join(dir, "config.toml")
+	writeConfig := func(password string) {
+		config := fmt.Sprintf("admin_password = %q\nlisten_addr = %q\nshutdown_timeout = 1\n", password, addr)
+		if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	writeConfig("old-password")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, configFile, filepath.Join(dir, "db.jsonl"), DefaultFiles{Static: fstest.MapFS{}})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	url := "http://" + addr
+	waitReady(t, http.DefaultClient, url)
+
+	status := func(password string) int {
+		req, err := http.NewRequest("GET", url+"/api/bieter", nil)
+		if err != nil {
+			t.Fatalf("creating request: %v", err)
+		}
+		req.Header.Set("Auth", password)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("sending request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status("old-password"); got != 200 {
+		t.Fatalf("old password before reload: got status %d, expected 200", got)
+	}
+
+	writeConfig("new-password")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("sending signal: %v", err)
+	}
+
+	for i := 0; i < 100 && status("new-password") != 200; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if got := status("new-password"); got != 200 {
+		t.Errorf("new password after reload: got status %d, expected 200", got)
+	}
+
+	if got := status("old-password"); got != 401 {
+		t.Errorf("old password after reload: got status %d, expected 401", got)
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshot is the state of the database after the events up to Offset. For
+// the file storage, Offset is the number of bytes of the database file. For
+// sqlite, it is the id of the last event.
+type snapshot struct {
+	Offset int64                      `json:"offset"`
+	Bieter map[string]json.RawMessage `json:"bieter"`
+	Times  map[string]BieterTimes     `json:"times"`
+	Offer  map[string]int             `json:"offer"`
+	State  ServiceState               `json:"state"`
+	Banner string                     `json:"banner"`
+
+	Deleted  map[string]time.Time `json:"deleted"`
+	Versions map[string]int       `json:"versions"`
+	Rounds   []map[string]int     `json:"rounds,omitempty"`
+}
+
+func snapshotFile(dbFile string) string {
+	return dbFile + ".snapshot"
+}
+
+// loadSnapshot returns the database from the snapshot file and the offset of
+// the first event in the database file, that is not part of the snapshot.
+//
+// If the snapshot does not exist, an empty database and the offset 0 is
+// returned.
+func loadSnapshot(file string) (*Database, int64, error) {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return emptyDatabase(), 0, nil
+		}
+		return nil, 0, fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return nil, 0, fmt.Errorf("decoding snapshot: %w", err)
+	}
+
+	db := emptyDatabase()
+	db.restoreSnapshot(s)
+	return db, s.Offset, nil
+}
+
+// restoreSnapshot sets the data of the database from the snapshot. The maps
+// are not copied.
+func (db *Database) restoreSnapshot(s snapshot) {
+	if s.Bieter != nil {
+		db.bieter = s.Bieter
+	}
+	if s.Times != nil {
+		db.times = s.Times
+	}
+	if s.Offer != nil {
+		db.offer = s.Offer
+	}
+	if s.Deleted != nil {
+		db.deleted = s.Deleted
+	}
+	if s.Versions != nil {
+		db.versions = s.Versions
+	}
+	db.rounds = s.Rounds
+	db.state = s.State
+	db.banner = s.Banner
+}
+
+// currentSnapshot returns the current state of the database. The maps are not
+// copied.
+//
+// Has to be called with the lock.
+func (db *Database) currentSnapshot() snapshot {
+	return snapshot{
+		Offset: db.store.offset(),
+		Bieter: db.bieter,
+		Times:  db.times,
+		Offer:  db.offer,
+		State:  db.state,
+		Banner: db.banner,
+
+		Deleted:  db.deleted,
+		Versions: db.versions,
+		Rounds:   db.rounds,
+	}
+}
+
+// backup is the state of the database, that can be downloaded by an admin.
+type backup struct {
+	CreatedAt time.Time `json:"created_at"`
+	snapshot
+}
+
+// Backup returns the current state of the database as JSON.
+func (db *Database) Backup() ([]byte, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	bs, err := json.Marshal(backup{
+		CreatedAt: time.Now(),
+		snapshot:  db.currentSnapshot(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding backup: %w", err)
+	}
+	return bs, nil
+}
+
+// RestoreBackup replaces all data with a backup from Backup.
+//
+// The backup is checked completely, before anything is changed.
+func (db *Database) RestoreBackup(r io.Reader) error {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("reading backup: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &fields); err != nil {
+		return validationError{msg: "Die Sicherung ist kein gültiges JSON", code: "INVALID_BACKUP"}
+	}
+
+	for _, required := range []string{"bieter", "offer", "state"} {
+		if _, ok := fields[required]; !ok {
+			return validationError{msg: fmt.Sprintf("Der Sicherung fehlt das Feld %q", required), code: "INVALID_BACKUP"}
+		}
+	}
+
+	var b backup
+	if err := json.Unmarshal(bs, &b); err != nil {
+		return validationError{msg: fmt.Sprintf("Die Sicherung ist ungültig: %v", err), code: "INVALID_BACKUP"}
+	}
+
+	if err := b.validate(); err != nil {
+		return err
+	}
+
+	event := eventDataRestore{
+		eventMeta: newEventMeta(true),
+		Bieter:    copyMap(b.Bieter),
+		Times:     copyMap(b.Times),
+		Offer:     copyMap(b.Offer),
+		State:     b.State,
+		Deleted:   copyMap(b.Deleted),
+		Versions:  copyMap(b.Versions),
+		Rounds:    copyRounds(b.Rounds),
+		Banner:    b.Banner,
+	}
+
+	if err := db.writeEvent(event); err != nil {
+		return fmt.Errorf("writing restore event: %w", err)
+	}
+	return nil
+}
+
+// validate checks, that the data of the backup fit together.
+func (b backup) validate() error {
+	if b.State < stateRegistration || b.State > stateFinished {
+		return validationError{msg: fmt.Sprintf("Die Sicherung hat den ungültigen Status %d", b.State), code: "INVALID_BACKUP"}
+	}
+
+	for id, payload := range b.Bieter {
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &data); err != nil {
+			return validationError{msg: fmt.Sprintf("Die Daten von Bieter %q sind ungültig", id), code: "INVALID_BACKUP"}
+		}
+	}
+
+	for id := range b.Offer {
+		if _, ok := b.Bieter[id]; !ok {
+			return validationError{msg: fmt.Sprintf("Die Sicherung hat ein Gebot für den unbekannten Bieter %q", id), code: "INVALID_BACKUP"}
+		}
+	}
+
+	for i, offers := range b.Rounds {
+		for id := range offers {
+			if _, ok := b.Bieter[id]; !ok {
+				return validationError{msg: fmt.Sprintf("Die Sicherung hat in Runde %d ein Gebot für den unbekannten Bieter %q", i+1, id), code: "INVALID_BACKUP"}
+			}
+		}
+	}
+
+	for id := range b.Deleted {
+		if _, ok := b.Bieter[id]; !ok {
+			return validationError{msg: fmt.Sprintf("Die Sicherung hat den unbekannten gelöschten Bieter %q", id), code: "INVALID_BACKUP"}
+		}
+	}
+	return nil
+}
+
+// writeSnapshot saves the current state of the database.
+//
+// Has to be called with the write lock.
+func (db *Database) writeSnapshot() error {
+	bs, err := json.Marshal(db.currentSnapshot())
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+
+	if err := writeFileAtomic(snapshotFile(db.file), bs); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+
+	db.eventsSinceSnapshot = 0
+	return nil
+}
+
+// writeFileAtomic writes the content to a temporary file and then renames it,
+// so a crash can not leave a half written file.
+func writeFileAtomic(file string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("replacing file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotAndTail(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db.jsonl")
+	config := DefaultConfig()
+	config.SnapshotEvery = 3
+
+	db, err := NewDB(file, config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	var ids []string
+	for _, name := range []string{"hugo", "erik", "anna", "paul"} {
+		id, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := db.DeleteBieter(ids[1], true); err != nil {
+		t.Fatalf("DeleteBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(ids[0], strings.NewReader(`{"offer":5000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if _, err := os.Stat(snapshotFile(file)); err != nil {
+		t.Fatalf("snapshot was not written: %v", err)
+	}
+
+	// Full replay without the snapshot.
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("open db file: %v", err)
+	}
+	defer f.Close()
+	full, err := loadDatabase(f)
+	if err != nil {
+		t.Fatalf("loadDatabase: %v", err)
+	}
+
+	reopened, err := NewDB(file, config)
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+
+	if !reflect.DeepEqual(reopened.bieter, full.bieter) {
+		t.Errorf("got bieter %q, expected %q", reopened.bieter, full.bieter)
+	}
+
+	if !reflect.DeepEqual(reopened.offer, full.offer) {
+		t.Errorf("got offers %v, expected %v", reopened.offer, full.offer)
+	}
+
+	if reopened.state != full.state {
+		t.Errorf("got state %s, expected %s", reopened.state, full.state)
+	}
+}
+
+func TestSnapshotIsUsed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db.jsonl")
+	config := DefaultConfig()
+	config.SnapshotEvery = 1
+
+	db, err := NewDB(file, config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true); err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	// Make the events in the file invalid. If the snapshot is used, they are
+	// not read.
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("stat db file: %v", err)
+	}
+	if err := os.WriteFile(file, []byte(strings.Repeat(" ", int(info.Size()-1))+"\n"), 0600); err != nil {
+		t.Fatalf("overwriting db file: %v", err)
+	}
+
+	reopened, err := NewDB(file, config)
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+
+	if len(reopened.bieter) != 1 {
+		t.Errorf("got %d bieter, expected the one from the snapshot", len(reopened.bieter))
+	}
+}
+
+func TestRestoreBigBackup(t *testing.T) {
+	db := newTestDB(t)
+
+	// The restore event is longer than the default limit of a line scanner.
+	notes := strings.Repeat("x", 17<<20)
+	backup := `{"bieter":{"ABC":{"name":"hugo","mail":"hugo@example.com","notes":"` + notes + `"}},"offer":{},"state":1}`
+	if err := db.RestoreBackup(strings.NewReader(backup)); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+
+	events, err := db.EventLog()
+	if err != nil {
+		t.Fatalf("EventLog after a big restore: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("got %d events, expected 1", len(events))
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewDB(db.file, DefaultConfig())
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+	defer reopened.Close()
+
+	if _, exist := reopened.Bieter("ABC"); !exist {
+		t.Errorf("restored bieter is missing after reopening")
+	}
+}
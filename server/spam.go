@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errRateLimit is returned, when a client created too many bieters.
+var errRateLimit = clientError{msg: "Zu viele Anmeldungen. Bitte versuche es später noch einmal", status: 429}
+
+// errHoneypot is returned, when the honeypot field was filled. Only bots fill
+// the field, because it is hidden in the form.
+var errHoneypot = validationError{msg: "Die Anmeldung wurde als Spam erkannt", code: "SPAM"}
+
+// rateLimiter allows limit requests per client in each window.
+//
+// A nil rateLimiter allows all requests.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]rateWindow
+	lastPrune time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// newRateLimiter returns a rateLimiter or nil, if limit is 0 or less.
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		clients: make(map[string]rateWindow),
+	}
+}
+
+// allow counts a request from the client and returns false, if the client
+// has reached the limit in the current window.
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > l.window {
+		for c, w := range l.clients {
+			if now.Sub(w.start) > l.window {
+				delete(l.clients, c)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	w := l.clients[client]
+	if now.Sub(w.start) > l.window {
+		w = rateWindow{start: now}
+	}
+
+	if w.count >= l.limit {
+		return false
+	}
+
+	w.count++
+	l.clients[client] = w
+	return true
+}
+
+// clientIP returns the ip address of the request without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkHoneypot returns errHoneypot, if the field is set in the payload. An
+// empty field is removed from the payload. With an empty field name, the
+// payload is returned unchanged.
+func checkHoneypot(payload json.RawMessage, field string) (json.RawMessage, error) {
+	if field == "" {
+		return payload, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		// The invalid payload is rejected by NewBieter.
+		return payload, nil
+	}
+
+	value, ok := fields[field]
+	if !ok {
+		return payload, nil
+	}
+
+	var s string
+	if !isNull(value) && (json.Unmarshal(value, &s) != nil || s != "") {
+		return nil, errHoneypot
+	}
+
+	delete(fields, field)
+	cleaned, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return cleaned, nil
+}
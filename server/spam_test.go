@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newSpamTestRouter(t *testing.T, db *Database, rateLimit int, honeypot string) *mux.Router {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.AdminPW = testAdminPW
+	config.CreateRateLimit = rateLimit
+	config.Honeypot = honeypot
+
+	router := mux.NewRouter()
+	registerHandlers(router, config, db, DefaultFiles{Static: os.DirFS("..")})
+	return router
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	if !l.allow("a", now) || !l.allow("a", now) {
+		t.Fatalf("first two requests were not allowed")
+	}
+
+	if l.allow("a", now) {
+		t.Errorf("third request in the window was allowed")
+	}
+
+	if !l.allow("b", now) {
+		t.Errorf("request from other client was not allowed")
+	}
+
+	if !l.allow("a", now.Add(time.Minute+time.Second)) {
+		t.Errorf("request in the next window was not allowed")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	l := newRateLimiter(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		if !l.allow("a", time.Now()) {
+			t.Fatalf("disabled rate limiter rejected request %d", i)
+		}
+	}
+}
+
+func TestCreateRateLimit(t *testing.T) {
+	router := newSpamTestRouter(t, newTestDB(t), 2, "")
+
+	for i := 0; i < 2; i++ {
+		if rec := doRequest(router, "POST", "/api/bieter", `{"name":"hugo","mail":"hugo@example.com"}`, false); rec.Code != 200 {
+			t.Fatalf("create %d: got status %d: %s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	// The limit is shared with the versioned api.
+	rec := doRequest(router, "POST", "/api/v1/bieter", `{"name":"hugo","mail":"hugo@example.com"}`, false)
+	if rec.Code != 429 {
+		t.Errorf("got status %d for third create, expected 429", rec.Code)
+	}
+
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("response has no Retry-After header")
+	}
+
+	if rec := doRequest(router, "POST", "/api/bieter", `{"name":"hugo","mail":"hugo@example.com"}`, true); rec.Code != 200 {
+		t.Errorf("got status %d for admin, expected 200", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/api/bieter", strings.NewReader(`{"name":"erik","mail":"erik@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "198.51.100.7:4321"
+	other := httptest.NewRecorder()
+	router.ServeHTTP(other, req)
+	if other.Code != 200 {
+		t.Errorf("got status %d for other ip, expected 200", other.Code)
+	}
+}
+
+func TestHoneypot(t *testing.T) {
+	db := newTestDB(t)
+	router := newSpamTestRouter(t, db, 0, "website")
+
+	rec := doRequest(router, "POST", "/api/bieter", `{"name":"bot","mail":"bot@example.com","website":"http://spam.example.com"}`, false)
+	if rec.Code != 400 {
+		t.Errorf("got status %d for filled honeypot, expected 400", rec.Code)
+	}
+
+	if n, _ := db.Count(); n != 0 {
+		t.Errorf("got %d bieters after spam, expected 0", n)
+	}
+
+	rec = doRequest(router, "POST", "/api/bieter", `{"name":"hugo","mail":"hugo@example.com","website":""}`, false)
+	if rec.Code != 200 {
+		t.Fatalf("got status %d for empty honeypot: %s", rec.Code, rec.Body.String())
+	}
+
+	if strings.Contains(rec.Body.String(), "website") {
+		t.Errorf("empty honeypot field was saved: %s", rec.Body.String())
+	}
+}
+
+func TestHoneypotDisabled(t *testing.T) {
+	router := newSpamTestRouter(t, newTestDB(t), 0, "")
+
+	rec := doRequest(router, "POST", "/api/bieter", `{"name":"hugo","mail":"hugo@example.com","website":"http://example.com"}`, false)
+	if rec.Code != 200 {
+		t.Errorf("got status %d without honeypot config, expected 200: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	// Registers the pure go sqlite driver.
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore saves the events in the table events of a sqlite database.
+type sqliteStore struct {
+	conn *sql.DB
+
+	// lastID is the id of the last saved event.
+	lastID int64
+}
+
+func openSQLiteStore(file string) (*sqliteStore, error) {
+	conn, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+
+	// The database is only written with the write lock of the Database. One
+	// connection is enough and prevents "database is locked" errors.
+	conn.SetMaxOpenConns(1)
+
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		data TEXT NOT NULL
+	)`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("creating events table: %w", err)
+	}
+
+	s := &sqliteStore{conn: conn}
+	if err := conn.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM events`).Scan(&s.lastID); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading last event id: %w", err)
+	}
+	return s, nil
+}
+
+// openSQLiteDB loads the database from the snapshot and the events in the
+// sqlite database, that were written after the snapshot.
+func openSQLiteDB(file string) (*Database, error) {
+	store, err := openSQLiteStore(file)
+	if err != nil {
+		return nil, err
+	}
+
+	db, offset, err := loadSnapshot(snapshotFile(file))
+	if err != nil {
+		store.close()
+		return nil, fmt.Errorf("loading snapshot: %w", err)
+	}
+
+	if offset > store.lastID {
+		log.Printf("Warning: Snapshot does not match %s. Ignoring it.", file)
+		db = emptyDatabase()
+		offset = 0
+	}
+
+	events, err := store.eventsAfter(offset)
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+
+	for _, line := range events {
+		event, err := decodeEvent(line)
+		if err != nil {
+			store.close()
+			return nil, err
+		}
+
+		if err := event.execute(db); err != nil {
+			store.close()
+			return nil, fmt.Errorf("executing event %q: %w", event.Name(), err)
+		}
+	}
+
+	db.store = store
+	return db, nil
+}
+
+func (s *sqliteStore) append(event []byte) error {
+	result, err := s.conn.Exec(`INSERT INTO events (data) VALUES (?)`, string(event))
+	if err != nil {
+		return fmt.Errorf("writing event to sqlite: %q: %w", event, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("reading id of event: %w", err)
+	}
+	s.lastID = id
+	return nil
+}
+
+func (s *sqliteStore) events() ([][]byte, error) {
+	return s.eventsAfter(0)
+}
+
+// eventsAfter returns the events with an id greater than id.
+func (s *sqliteStore) eventsAfter(id int64) ([][]byte, error) {
+	rows, err := s.conn.Query(`SELECT data FROM events WHERE id > ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("reading events: %w", err)
+	}
+	defer rows.Close()
+
+	var events [][]byte
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("scanning event: %w", err)
+		}
+		events = append(events, []byte(data))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *sqliteStore) offset() int64 {
+	return s.lastID
+}
+
+// sync does nothing. Sqlite writes each event in its own transaction.
+func (s *sqliteStore) sync() error {
+	return nil
+}
+
+func (s *sqliteStore) close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sqliteConfig(file string) Config {
+	config := DefaultConfig()
+	config.Storage = storageSQLite
+	config.SQLiteFile = file
+	return config
+}
+
+func TestSQLitePersistence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.sqlite")
+	config := sqliteConfig(file)
+	config.SnapshotEvery = 0
+
+	db, err := NewDB(filepath.Join(dir, "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	id1, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	id2, err := db.NewBieter([]byte(`{"name":"erik","mail":"erik@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	if _, err := db.UpdateBieter(id1, strings.NewReader(`{"name":"hugo","mail":"hugo@example.com","adresse":"beim wald"}`), 0, true); err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+	if err := db.DeleteBieter(id2, true); err != nil {
+		t.Fatalf("DeleteBieter: %v", err)
+	}
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	if err := db.UpdateOffer(id1, strings.NewReader(`{"offer":5000}`), false); err != nil {
+		t.Fatalf("UpdateOffer: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "db.jsonl")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("database file was written with the sqlite storage")
+	}
+
+	reopened, err := NewDB(filepath.Join(dir, "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+	defer reopened.Close()
+
+	if !reflect.DeepEqual(reopened.bieter, db.bieter) {
+		t.Errorf("got bieter %q, expected %q", reopened.bieter, db.bieter)
+	}
+
+	if !reflect.DeepEqual(reopened.offer, db.offer) {
+		t.Errorf("got offers %v, expected %v", reopened.offer, db.offer)
+	}
+
+	if _, ok := reopened.deleted[id2]; !ok {
+		t.Errorf("bieter %s is not deleted", id2)
+	}
+
+	if reopened.state != stateOffer {
+		t.Errorf("got state %s, expected %s", reopened.state, stateOffer)
+	}
+
+	events, err := reopened.EventLog()
+	if err != nil {
+		t.Fatalf("EventLog: %v", err)
+	}
+	if len(events) != 6 {
+		t.Errorf("got %d events, expected 6", len(events))
+	}
+}
+
+func TestSQLiteSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	config := sqliteConfig(filepath.Join(dir, "db.sqlite"))
+	config.SnapshotEvery = 2
+
+	db, err := NewDB(filepath.Join(dir, "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	for _, name := range []string{"hugo", "erik", "anna"} {
+		if _, err := db.NewBieter([]byte(`{"name":"`+name+`","mail":"`+name+`@example.com"}`), true); err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+	}
+
+	// Close would write a snapshot with all events. Drop the store without
+	// it, so the last event has to be replayed from sqlite.
+	if err := db.store.close(); err != nil {
+		t.Fatalf("closing store: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "db.sqlite.snapshot")); err != nil {
+		t.Fatalf("snapshot was not written: %v", err)
+	}
+
+	reopened, err := NewDB(filepath.Join(dir, "db.jsonl"), config)
+	if err != nil {
+		t.Fatalf("reopening db: %v", err)
+	}
+	defer reopened.Close()
+
+	if !reflect.DeepEqual(reopened.bieter, db.bieter) {
+		t.Errorf("got bieter %q, expected %q", reopened.bieter, db.bieter)
+	}
+}
+
+func TestStorageFileName(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config Config
+		expect string
+	}{
+		{"file", Config{Storage: storageFile}, "data/db.jsonl"},
+		{"sqlite default", Config{Storage: storageSQLite}, "data/db.sqlite"},
+		{"sqlite file", Config{Storage: storageSQLite, SQLiteFile: "other.db"}, "other.db"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storageFileName("data/db.jsonl", tt.config); got != tt.expect {
+				t.Errorf("got %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestUnknownStorage(t *testing.T) {
+	config := DefaultConfig()
+	config.Storage = "mysql"
+	if _, err := NewDB(filepath.Join(t.TempDir(), "db.jsonl"), config); err == nil {
+		t.Errorf("NewDB with unknown storage did not return an error")
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// statsGroup are the numbers of a group of bieters.
+type statsGroup struct {
+	Count int `json:"count"`
+
+	// OfferCount is the number of bieters with an offer.
+	OfferCount int `json:"offer_count"`
+
+	// OfferSum is the sum of all monthly offers in cent.
+	OfferSum int `json:"offer_sum"`
+}
+
+func (g *statsGroup) add(offer int) {
+	g.Count++
+	if offer > 0 {
+		g.OfferCount++
+		g.OfferSum += offer
+	}
+}
+
+// stats are the numbers of all bieters grouped by verteilstelle and
+// abbuchung.
+type stats struct {
+	Total         statsGroup            `json:"total"`
+	Verteilstelle map[string]statsGroup `json:"verteilstelle"`
+	Abbuchung     map[string]statsGroup `json:"abbuchung"`
+}
+
+// buildStats calculates the stats for the bieters. offer returns the offer of
+// a bieter.
+//
+// Bieters, that can not be decoded, are skipped.
+func buildStats(bieterList map[string]json.RawMessage, offer func(id string) int, config Config) stats {
+	s := stats{
+		Verteilstelle: make(map[string]statsGroup),
+		Abbuchung:     make(map[string]statsGroup),
+	}
+
+	for id, payload := range bieterList {
+		var data pdfData
+		if err := json.Unmarshal(payload, &data); err != nil {
+			log.Printf("Warning: decode bieter %q for stats: %v", id, err)
+			continue
+		}
+
+		o := offer(id)
+		s.Total.add(o)
+
+		name := config.verteilstelleName(int(data.Verteilstelle))
+		group := s.Verteilstelle[name]
+		group.add(o)
+		s.Verteilstelle[name] = group
+
+		name = config.abbuchungName(int(data.Abbuchung))
+		group = s.Abbuchung[name]
+		group.add(o)
+		s.Abbuchung[name] = group
+	}
+
+	return s
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	db := newTestDB(t)
+	router := newTestRouter(t, db)
+
+	offers := map[string]int{}
+	for _, tt := range []struct {
+		payload string
+		offer   int
+	}{
+		{`{"name":"hugo","mail":"hugo@example.com","verteilstelle":1,"abbuchung":0}`, 5000},
+		{`{"name":"erik","mail":"erik@example.com","verteilstelle":1,"abbuchung":1}`, 6000},
+		{`{"name":"anna","mail":"anna@example.com","verteilstelle":2,"abbuchung":0}`, 7000},
+		{`{"name":"paul","mail":"paul@example.com","verteilstelle":2,"abbuchung":0}`, 0},
+	} {
+		id, err := db.NewBieter([]byte(tt.payload), true)
+		if err != nil {
+			t.Fatalf("NewBieter: %v", err)
+		}
+		offers[id] = tt.offer
+	}
+
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	for id, offer := range offers {
+		if offer == 0 {
+			continue
+		}
+		body := strings.NewReader(`{"offer":` + strconv.Itoa(offer) + `}`)
+		if err := db.UpdateOffer(id, body, true); err != nil {
+			t.Fatalf("UpdateOffer: %v", err)
+		}
+	}
+
+	if resp := doRequest(router, "GET", "/api/stats", "", false); resp.Code != 401 {
+		t.Errorf("stats without admin: got status %d, expected 401", resp.Code)
+	}
+
+	resp := doRequest(router, "GET", "/api/stats", "", true)
+	var got stats
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding stats %q: %v", resp.Body.String(), err)
+	}
+
+	expect := stats{
+		Total: statsGroup{Count: 4, OfferCount: 3, OfferSum: 18000},
+		Verteilstelle: map[string]statsGroup{
+			"Villingen":    {Count: 2, OfferCount: 2, OfferSum: 11000},
+			"Schwenningen": {Count: 2, OfferCount: 1, OfferSum: 7000},
+		},
+		Abbuchung: map[string]statsGroup{
+			"Monatlich": {Count: 3, OfferCount: 2, OfferSum: 12000},
+			"Jährlich":  {Count: 1, OfferCount: 1, OfferSum: 6000},
+		},
+	}
+
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got stats %+v, expected %+v", got, expect)
+	}
+}
+
+func TestStatsSkipsInvalidPayload(t *testing.T) {
+	bieterList := map[string]json.RawMessage{
+		"1": []byte(`{"name":"hugo","mail":"hugo@example.com","verteilstelle":1}`),
+		"2": []byte(`{"name":42}`),
+	}
+
+	got := buildStats(bieterList, func(string) int { return 0 }, DefaultConfig())
+	if got.Total.Count != 1 {
+		t.Errorf("got %d bieter, expected 1", got.Total.Count)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	storageFile   = "file"
+	storageSQLite = "sqlite"
+)
+
+// eventStore saves the encoded events of the database.
+type eventStore interface {
+	// append saves one encoded event.
+	append(event []byte) error
+
+	// events returns all saved events in the order they were written.
+	events() ([][]byte, error)
+
+	// offset returns the position after the last saved event. It is saved
+	// in the snapshot to find the events, that were written after it.
+	offset() int64
+
+	// sync flushes the saved events to disk.
+	sync() error
+
+	// close releases the resources of the store.
+	close() error
+}
+
+// storageFileName returns the file for the configured storage.
+func storageFileName(file string, config Config) string {
+	if config.Storage != storageSQLite {
+		return file
+	}
+
+	if config.SQLiteFile != "" {
+		return config.SQLiteFile
+	}
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".sqlite"
+}
+
+// fileStore saves the events in a file with one event per line.
+type fileStore struct {
+	file string
+
+	// size is the size of the valid events in the file.
+	size int64
+}
+
+func (s *fileStore) append(event []byte) (err error) {
+	f, err := os.OpenFile(s.file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open db file: %w", err)
+	}
+	defer func() {
+		wErr := f.Close()
+		if err == nil {
+			err = wErr
+		}
+	}()
+
+	line := append(event, '\n')
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("writing event to file: %q: %w", line, err)
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+func (s *fileStore) events() ([][]byte, error) {
+	f, err := os.Open(s.file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open database file: %w", err)
+	}
+	defer f.Close()
+
+	// The lines are not limited. A restore event is as big as the backup.
+	var events [][]byte
+	reader := bufio.NewReader(io.LimitReader(f, s.size))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading events: %w", err)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			events = append(events, line)
+		}
+
+		if err == io.EOF {
+			return events, nil
+		}
+	}
+}
+
+func (s *fileStore) offset() int64 {
+	return s.size
+}
+
+func (s *fileStore) sync() error {
+	f, err := os.OpenFile(s.file, os.O_WRONLY, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("open db file: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync db file: %w", err)
+	}
+	return nil
+}
+
+func (s *fileStore) close() error {
+	return nil
+}
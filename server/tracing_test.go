@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans sets a tracer provider, that keeps all spans in memory, until
+// the end of the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	original := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(original)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingRequest(t *testing.T) {
+	exporter := recordSpans(t)
+	db := newTestDB(t)
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	exporter.Reset()
+
+	if rec := doRequest(newTestRouter(t, db), "GET", "/api/bieter/"+id+"/pdf", "", false); rec.Code != 200 {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	request, ok := byName["GET /api/bieter/{id}/pdf"]
+	if !ok {
+		t.Fatalf("no span for the request, got %v", spans.Snapshots())
+	}
+
+	if got := spanAttribute(request, "http.response.status_code").AsInt64(); got != 200 {
+		t.Errorf("got status attribute %d, expected 200", got)
+	}
+
+	if got := spanAttribute(request, "url.path").AsString(); got != "/api/bieter/"+id+"/pdf" {
+		t.Errorf("got path attribute %q", got)
+	}
+
+	pdfSpan, ok := byName["Bietervertrag"]
+	if !ok {
+		t.Fatalf("no span for the pdf")
+	}
+
+	if pdfSpan.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Errorf("pdf span is not a child of the request span")
+	}
+}
+
+func TestTracingEvent(t *testing.T) {
+	exporter := recordSpans(t)
+	db := newTestDB(t)
+
+	if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), true); err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+
+	for _, expect := range []string{"event update", "validate", "execute"} {
+		if !containsString(names, expect) {
+			t.Errorf("no span %q, got %v", expect, names)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// webhookClient is the http client for the webhooks. The timeout is for one
+// attempt.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Defaults of the webhookSender.
+const (
+	webhookAttempts   = 3
+	webhookRetryDelay = 2 * time.Second
+)
+
+// webhookSender posts json messages to urls in the background.
+type webhookSender struct {
+	// attempts is how often a webhook is sent, until it is given up.
+	attempts int
+
+	// retryDelay is the time between two attempts.
+	retryDelay time.Duration
+
+	// inFlight are the webhooks, that are not sent yet.
+	inFlight sync.WaitGroup
+}
+
+func newWebhookSender() *webhookSender {
+	return &webhookSender{
+		attempts:   webhookAttempts,
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// send posts the payload. On errors, it is retried until s.attempts are
+// reached.
+func (s *webhookSender) send(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding webhook payload: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(url, body)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= s.attempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		time.Sleep(s.retryDelay)
+	}
+}
+
+func postWebhook(url string, body []byte) error {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	return nil
+}
+
+// sendAsync sends the payload in the background. Errors are only logged, so
+// a broken webhook does not break the request, that triggered it.
+//
+// It does nothing, if the url is empty.
+func (s *webhookSender) sendAsync(url string, payload any) {
+	if url == "" {
+		return
+	}
+
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		if err := s.send(url, payload); err != nil {
+			log.Printf("Error: sending webhook: %v", err)
+		}
+	}()
+}
+
+// wait blocks until all webhooks are sent or given up.
+func (s *webhookSender) wait() {
+	s.inFlight.Wait()
+}
+
+// webhookRegistration is sent, when a new bieter registered.
+type webhookRegistration struct {
+	Event         string    `json:"event"`
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Verteilstelle string    `json:"verteilstelle"`
+	Time          time.Time `json:"time"`
+}
+
+// webhookStateChange is sent, when the service state changed.
+type webhookStateChange struct {
+	Event    string    `json:"event"`
+	OldState string    `json:"old_state"`
+	NewState string    `json:"new_state"`
+	Actor    string    `json:"actor"`
+	Time     time.Time `json:"time"`
+}
+
+// webhookStateNames are the names of the states in the webhooks.
+var webhookStateNames = map[ServiceState]string{
+	stateRegistration: "registration",
+	stateValidation:   "validation",
+	stateOffer:        "offer",
+	stateFinished:     "finished",
+}
+
+// webhookNotification returns the url and the payload of the webhook for the
+// event. The url is empty, if the event does not trigger a webhook.
+//
+// It has to be called before the event is executed.
+func webhookNotification(db *Database, e Event) (string, any) {
+	switch e := e.(type) {
+	case eventServiceState:
+		if db.config.StateWebhookURL == "" || e.NewState == db.state {
+			return "", nil
+		}
+
+		return db.config.StateWebhookURL, webhookStateChange{
+			Event:    "state.changed",
+			OldState: webhookStateNames[db.state],
+			NewState: webhookStateNames[e.NewState],
+			Actor:    e.Actor,
+			Time:     e.CreatedAt,
+		}
+
+	case eventUpdate:
+		if _, exist := db.bieter[e.ID]; exist || db.config.WebhookURL == "" {
+			return "", nil
+		}
+
+		var data pdfData
+		json.Unmarshal(e.Payload, &data)
+
+		var verteilstelle string
+		if data.Verteilstelle != 0 {
+			verteilstelle = db.config.verteilstelleName(int(data.Verteilstelle))
+		}
+
+		return db.config.WebhookURL, webhookRegistration{
+			Event:         "bieter.created",
+			ID:            e.ID,
+			Name:          data.Name,
+			Verteilstelle: verteilstelle,
+			Time:          e.CreatedAt,
+		}
+	}
+	return "", nil
+}
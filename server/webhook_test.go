@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookServer starts a server, that writes all request bodies to the
+// returned channel. The first failures requests are answered with status 500.
+func webhookServer(t *testing.T, failures int32) (string, <-chan []byte) {
+	t.Helper()
+
+	received := make(chan []byte, 10)
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+
+		if count.Add(1) <= failures {
+			w.WriteHeader(500)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, received
+}
+
+func waitForWebhook(t *testing.T, received <-chan []byte) []byte {
+	t.Helper()
+
+	select {
+	case body := <-received:
+		return body
+	case <-time.After(time.Second):
+		t.Fatalf("webhook was not called")
+		return nil
+	}
+}
+
+func expectNoWebhook(t *testing.T, received <-chan []byte) {
+	t.Helper()
+
+	select {
+	case body := <-received:
+		t.Errorf("unexpected webhook: %s", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newWebhookTestDB(t *testing.T, file string, url string) *Database {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.WebhookURL = url
+	return openWebhookTestDB(t, file, config)
+}
+
+// openWebhookTestDB opens a database with a short retry delay for the
+// webhooks. The database is closed at the end of the test, so no webhook
+// outlives the test.
+func openWebhookTestDB(t *testing.T, file string, config Config) *Database {
+	t.Helper()
+
+	db, err := NewDB(file, config)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	db.webhooks.retryDelay = time.Millisecond
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWebhookRegistration(t *testing.T) {
+	url, received := webhookServer(t, 0)
+	file := filepath.Join(t.TempDir(), "db.jsonl")
+	db := newWebhookTestDB(t, file, url)
+
+	id, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com","verteilstelle":2}`), false)
+	if err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	var got webhookRegistration
+	if err := json.Unmarshal(waitForWebhook(t, received), &got); err != nil {
+		t.Fatalf("decoding webhook: %v", err)
+	}
+
+	if got.Event != "bieter.created" || got.ID != id || got.Name != "hugo" || got.Verteilstelle != "Schwenningen" {
+		t.Errorf("got webhook %+v", got)
+	}
+
+	if time.Since(got.Time) > time.Minute {
+		t.Errorf("got time %v, expected now", got.Time)
+	}
+
+	// Updates do not call the webhook.
+	if _, err := db.UpdateBieter(id, strings.NewReader(`{"name":"hugo","mail":"hugo@example.com","verteilstelle":1}`), 0, false); err != nil {
+		t.Fatalf("UpdateBieter: %v", err)
+	}
+	expectNoWebhook(t, received)
+
+	// Loading the events does not call the webhook again.
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	reopened := newWebhookTestDB(t, file, url)
+	defer reopened.Close()
+	expectNoWebhook(t, received)
+}
+
+func TestWebhookRetry(t *testing.T) {
+	url, received := webhookServer(t, 2)
+	db := newWebhookTestDB(t, filepath.Join(t.TempDir(), "db.jsonl"), url)
+
+	if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false); err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		waitForWebhook(t, received)
+	}
+	expectNoWebhook(t, received)
+}
+
+func TestWebhookBroken(t *testing.T) {
+	db := newWebhookTestDB(t, filepath.Join(t.TempDir(), "db.jsonl"), "http://127.0.0.1:1/hook")
+
+	if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false); err != nil {
+		t.Errorf("NewBieter with broken webhook: %v", err)
+	}
+
+	// Close returns after all attempts are given up.
+	if err := db.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestWebhookStateChange(t *testing.T) {
+	url, received := webhookServer(t, 0)
+	config := DefaultConfig()
+	config.StateWebhookURL = url
+	db := openWebhookTestDB(t, filepath.Join(t.TempDir(), "db.jsonl"), config)
+
+	// New bieters only call the registration webhook.
+	if _, err := db.NewBieter([]byte(`{"name":"hugo","mail":"hugo@example.com"}`), false); err != nil {
+		t.Fatalf("NewBieter: %v", err)
+	}
+	expectNoWebhook(t, received)
+
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+
+	var got webhookStateChange
+	if err := json.Unmarshal(waitForWebhook(t, received), &got); err != nil {
+		t.Fatalf("decoding webhook: %v", err)
+	}
+
+	if got.Event != "state.changed" || got.OldState != "registration" || got.NewState != "offer" || got.Actor != actorAdmin {
+		t.Errorf("got webhook %+v", got)
+	}
+
+	// Close waits for the delivery, so nothing is sent afterwards.
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	expectNoWebhook(t, received)
+}
+
+func TestWebhookStateChangeDisabled(t *testing.T) {
+	url, received := webhookServer(t, 0)
+	db := newWebhookTestDB(t, filepath.Join(t.TempDir(), "db.jsonl"), url)
+
+	if err := db.SetState(strings.NewReader(`{"state":3}`)); err != nil {
+		t.Fatalf("SetState: %v", err)
+	}
+	expectNoWebhook(t, received)
+}
@@ -0,0 +1,14 @@
+var bieter_id = localStorage.getItem('bieter_id')
+var app = Elm.Main.init({ flags: bieter_id });
+
+app.ports.fromElm.subscribe(function (msg) {
+	if (msg.tag == "store-id") {
+		localStorage.setItem('bieter_id', msg.data);
+	} else if (msg.tag == "remove-id") {
+		localStorage.removeItem('bieter_id');
+	} else if (msg.tag == "get-id") {
+		app.ports.toElm.send(localStorage.getItem('bieter_id'));
+	} else {
+		console.log("unknown message type: ", msg.tag)
+	}
+});